@@ -0,0 +1,13 @@
+//
+// Code generated by go-jet DO NOT EDIT.
+//
+// WARNING: Changes to this file may cause incorrect behavior
+// and will be lost if the code is regenerated
+//
+
+package model
+
+type AuthRolePermission struct {
+	Role       string `sql:"primary_key"`
+	Permission string `sql:"primary_key"`
+}
@@ -12,12 +12,14 @@ import (
 )
 
 type AuthUser struct {
-	ID        int64 `sql:"primary_key"`
-	Username  string
-	Email     string
-	Role      string
-	Password  string
-	CreatedAt time.Time
-	LastLogin time.Time
-	Attr      string
+	ID            int64 `sql:"primary_key"`
+	Username      string
+	Email         string
+	Role          string
+	Password      string
+	CreatedAt     time.Time
+	LastLogin     time.Time
+	Attr          string
+	RoleExpiresAt *time.Time
+	PreviousRole  *string
 }
@@ -0,0 +1,96 @@
+//
+// Code generated by go-jet DO NOT EDIT.
+//
+// WARNING: Changes to this file may cause incorrect behavior
+// and will be lost if the code is regenerated
+//
+
+package table
+
+import (
+	"github.com/go-jet/jet/v2/postgres"
+)
+
+var AuthClient = newAuthClientTable("public", "auth_client", "")
+
+type authClientTable struct {
+	postgres.Table
+
+	// Columns
+	ID         postgres.ColumnInteger
+	ClientID   postgres.ColumnString
+	Name       postgres.ColumnString
+	Secret     postgres.ColumnString
+	CreatedAt  postgres.ColumnTimestampz
+	DisabledAt postgres.ColumnTimestampz
+	Scopes     postgres.ColumnString
+
+	AllColumns     postgres.ColumnList
+	MutableColumns postgres.ColumnList
+	DefaultColumns postgres.ColumnList
+}
+
+type AuthClientTable struct {
+	authClientTable
+
+	EXCLUDED authClientTable
+}
+
+// AS creates new AuthClientTable with assigned alias
+func (a AuthClientTable) AS(alias string) *AuthClientTable {
+	return newAuthClientTable(a.SchemaName(), a.TableName(), alias)
+}
+
+// Schema creates new AuthClientTable with assigned schema name
+func (a AuthClientTable) FromSchema(schemaName string) *AuthClientTable {
+	return newAuthClientTable(schemaName, a.TableName(), a.Alias())
+}
+
+// WithPrefix creates new AuthClientTable with assigned table prefix
+func (a AuthClientTable) WithPrefix(prefix string) *AuthClientTable {
+	return newAuthClientTable(a.SchemaName(), prefix+a.TableName(), a.TableName())
+}
+
+// WithSuffix creates new AuthClientTable with assigned table suffix
+func (a AuthClientTable) WithSuffix(suffix string) *AuthClientTable {
+	return newAuthClientTable(a.SchemaName(), a.TableName()+suffix, a.TableName())
+}
+
+func newAuthClientTable(schemaName, tableName, alias string) *AuthClientTable {
+	return &AuthClientTable{
+		authClientTable: newAuthClientTableImpl(schemaName, tableName, alias),
+		EXCLUDED:        newAuthClientTableImpl("", "excluded", ""),
+	}
+}
+
+func newAuthClientTableImpl(schemaName, tableName, alias string) authClientTable {
+	var (
+		IDColumn         = postgres.IntegerColumn("id")
+		ClientIDColumn   = postgres.StringColumn("client_id")
+		NameColumn       = postgres.StringColumn("name")
+		SecretColumn     = postgres.StringColumn("secret")
+		CreatedAtColumn  = postgres.TimestampzColumn("created_at")
+		DisabledAtColumn = postgres.TimestampzColumn("disabled_at")
+		ScopesColumn     = postgres.StringColumn("scopes")
+		allColumns       = postgres.ColumnList{IDColumn, ClientIDColumn, NameColumn, SecretColumn, CreatedAtColumn, DisabledAtColumn, ScopesColumn}
+		mutableColumns   = postgres.ColumnList{ClientIDColumn, NameColumn, SecretColumn, CreatedAtColumn, DisabledAtColumn, ScopesColumn}
+		defaultColumns   = postgres.ColumnList{CreatedAtColumn, ScopesColumn}
+	)
+
+	return authClientTable{
+		Table: postgres.NewTable(schemaName, tableName, alias, allColumns...),
+
+		//Columns
+		ID:         IDColumn,
+		ClientID:   ClientIDColumn,
+		Name:       NameColumn,
+		Secret:     SecretColumn,
+		CreatedAt:  CreatedAtColumn,
+		DisabledAt: DisabledAtColumn,
+		Scopes:     ScopesColumn,
+
+		AllColumns:     allColumns,
+		MutableColumns: mutableColumns,
+		DefaultColumns: defaultColumns,
+	}
+}
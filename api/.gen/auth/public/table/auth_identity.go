@@ -0,0 +1,93 @@
+//
+// Code generated by go-jet DO NOT EDIT.
+//
+// WARNING: Changes to this file may cause incorrect behavior
+// and will be lost if the code is regenerated
+//
+
+package table
+
+import (
+	"github.com/go-jet/jet/v2/postgres"
+)
+
+var AuthIdentity = newAuthIdentityTable("public", "auth_identity", "")
+
+type authIdentityTable struct {
+	postgres.Table
+
+	// Columns
+	ID        postgres.ColumnInteger
+	UserID    postgres.ColumnInteger
+	Provider  postgres.ColumnString
+	Subject   postgres.ColumnString
+	Email     postgres.ColumnString
+	CreatedAt postgres.ColumnTimestampz
+
+	AllColumns     postgres.ColumnList
+	MutableColumns postgres.ColumnList
+	DefaultColumns postgres.ColumnList
+}
+
+type AuthIdentityTable struct {
+	authIdentityTable
+
+	EXCLUDED authIdentityTable
+}
+
+// AS creates new AuthIdentityTable with assigned alias
+func (a AuthIdentityTable) AS(alias string) *AuthIdentityTable {
+	return newAuthIdentityTable(a.SchemaName(), a.TableName(), alias)
+}
+
+// Schema creates new AuthIdentityTable with assigned schema name
+func (a AuthIdentityTable) FromSchema(schemaName string) *AuthIdentityTable {
+	return newAuthIdentityTable(schemaName, a.TableName(), a.Alias())
+}
+
+// WithPrefix creates new AuthIdentityTable with assigned table prefix
+func (a AuthIdentityTable) WithPrefix(prefix string) *AuthIdentityTable {
+	return newAuthIdentityTable(a.SchemaName(), prefix+a.TableName(), a.TableName())
+}
+
+// WithSuffix creates new AuthIdentityTable with assigned table suffix
+func (a AuthIdentityTable) WithSuffix(suffix string) *AuthIdentityTable {
+	return newAuthIdentityTable(a.SchemaName(), a.TableName()+suffix, a.TableName())
+}
+
+func newAuthIdentityTable(schemaName, tableName, alias string) *AuthIdentityTable {
+	return &AuthIdentityTable{
+		authIdentityTable: newAuthIdentityTableImpl(schemaName, tableName, alias),
+		EXCLUDED:          newAuthIdentityTableImpl("", "excluded", ""),
+	}
+}
+
+func newAuthIdentityTableImpl(schemaName, tableName, alias string) authIdentityTable {
+	var (
+		IDColumn        = postgres.IntegerColumn("id")
+		UserIDColumn    = postgres.IntegerColumn("user_id")
+		ProviderColumn  = postgres.StringColumn("provider")
+		SubjectColumn   = postgres.StringColumn("subject")
+		EmailColumn     = postgres.StringColumn("email")
+		CreatedAtColumn = postgres.TimestampzColumn("created_at")
+		allColumns      = postgres.ColumnList{IDColumn, UserIDColumn, ProviderColumn, SubjectColumn, EmailColumn, CreatedAtColumn}
+		mutableColumns  = postgres.ColumnList{UserIDColumn, ProviderColumn, SubjectColumn, EmailColumn, CreatedAtColumn}
+		defaultColumns  = postgres.ColumnList{EmailColumn, CreatedAtColumn}
+	)
+
+	return authIdentityTable{
+		Table: postgres.NewTable(schemaName, tableName, alias, allColumns...),
+
+		//Columns
+		ID:        IDColumn,
+		UserID:    UserIDColumn,
+		Provider:  ProviderColumn,
+		Subject:   SubjectColumn,
+		Email:     EmailColumn,
+		CreatedAt: CreatedAtColumn,
+
+		AllColumns:     allColumns,
+		MutableColumns: mutableColumns,
+		DefaultColumns: defaultColumns,
+	}
+}
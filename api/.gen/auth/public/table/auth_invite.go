@@ -0,0 +1,102 @@
+//
+// Code generated by go-jet DO NOT EDIT.
+//
+// WARNING: Changes to this file may cause incorrect behavior
+// and will be lost if the code is regenerated
+//
+
+package table
+
+import (
+	"github.com/go-jet/jet/v2/postgres"
+)
+
+var AuthInvite = newAuthInviteTable("public", "auth_invite", "")
+
+type authInviteTable struct {
+	postgres.Table
+
+	// Columns
+	ID        postgres.ColumnInteger
+	Code      postgres.ColumnString
+	CreatedBy postgres.ColumnInteger
+	Note      postgres.ColumnString
+	MaxUses   postgres.ColumnInteger
+	Uses      postgres.ColumnInteger
+	ExpiresAt postgres.ColumnTimestampz
+	CreatedAt postgres.ColumnTimestampz
+	RevokedAt postgres.ColumnTimestampz
+
+	AllColumns     postgres.ColumnList
+	MutableColumns postgres.ColumnList
+	DefaultColumns postgres.ColumnList
+}
+
+type AuthInviteTable struct {
+	authInviteTable
+
+	EXCLUDED authInviteTable
+}
+
+// AS creates new AuthInviteTable with assigned alias
+func (a AuthInviteTable) AS(alias string) *AuthInviteTable {
+	return newAuthInviteTable(a.SchemaName(), a.TableName(), alias)
+}
+
+// Schema creates new AuthInviteTable with assigned schema name
+func (a AuthInviteTable) FromSchema(schemaName string) *AuthInviteTable {
+	return newAuthInviteTable(schemaName, a.TableName(), a.Alias())
+}
+
+// WithPrefix creates new AuthInviteTable with assigned table prefix
+func (a AuthInviteTable) WithPrefix(prefix string) *AuthInviteTable {
+	return newAuthInviteTable(a.SchemaName(), prefix+a.TableName(), a.TableName())
+}
+
+// WithSuffix creates new AuthInviteTable with assigned table suffix
+func (a AuthInviteTable) WithSuffix(suffix string) *AuthInviteTable {
+	return newAuthInviteTable(a.SchemaName(), a.TableName()+suffix, a.TableName())
+}
+
+func newAuthInviteTable(schemaName, tableName, alias string) *AuthInviteTable {
+	return &AuthInviteTable{
+		authInviteTable: newAuthInviteTableImpl(schemaName, tableName, alias),
+		EXCLUDED:        newAuthInviteTableImpl("", "excluded", ""),
+	}
+}
+
+func newAuthInviteTableImpl(schemaName, tableName, alias string) authInviteTable {
+	var (
+		IDColumn        = postgres.IntegerColumn("id")
+		CodeColumn      = postgres.StringColumn("code")
+		CreatedByColumn = postgres.IntegerColumn("created_by")
+		NoteColumn      = postgres.StringColumn("note")
+		MaxUsesColumn   = postgres.IntegerColumn("max_uses")
+		UsesColumn      = postgres.IntegerColumn("uses")
+		ExpiresAtColumn = postgres.TimestampzColumn("expires_at")
+		CreatedAtColumn = postgres.TimestampzColumn("created_at")
+		RevokedAtColumn = postgres.TimestampzColumn("revoked_at")
+		allColumns      = postgres.ColumnList{IDColumn, CodeColumn, CreatedByColumn, NoteColumn, MaxUsesColumn, UsesColumn, ExpiresAtColumn, CreatedAtColumn, RevokedAtColumn}
+		mutableColumns  = postgres.ColumnList{CodeColumn, CreatedByColumn, NoteColumn, MaxUsesColumn, UsesColumn, ExpiresAtColumn, CreatedAtColumn, RevokedAtColumn}
+		defaultColumns  = postgres.ColumnList{NoteColumn, UsesColumn, CreatedAtColumn}
+	)
+
+	return authInviteTable{
+		Table: postgres.NewTable(schemaName, tableName, alias, allColumns...),
+
+		//Columns
+		ID:        IDColumn,
+		Code:      CodeColumn,
+		CreatedBy: CreatedByColumn,
+		Note:      NoteColumn,
+		MaxUses:   MaxUsesColumn,
+		Uses:      UsesColumn,
+		ExpiresAt: ExpiresAtColumn,
+		CreatedAt: CreatedAtColumn,
+		RevokedAt: RevokedAtColumn,
+
+		AllColumns:     allColumns,
+		MutableColumns: mutableColumns,
+		DefaultColumns: defaultColumns,
+	}
+}
@@ -0,0 +1,102 @@
+//
+// Code generated by go-jet DO NOT EDIT.
+//
+// WARNING: Changes to this file may cause incorrect behavior
+// and will be lost if the code is regenerated
+//
+
+package table
+
+import (
+	"github.com/go-jet/jet/v2/postgres"
+)
+
+var AuthPersonalToken = newAuthPersonalTokenTable("public", "auth_personal_token", "")
+
+type authPersonalTokenTable struct {
+	postgres.Table
+
+	// Columns
+	ID         postgres.ColumnInteger
+	UserID     postgres.ColumnInteger
+	Name       postgres.ColumnString
+	TokenHash  postgres.ColumnString
+	Scopes     postgres.ColumnString
+	CreatedAt  postgres.ColumnTimestampz
+	ExpiresAt  postgres.ColumnTimestampz
+	LastUsedAt postgres.ColumnTimestampz
+	RevokedAt  postgres.ColumnTimestampz
+
+	AllColumns     postgres.ColumnList
+	MutableColumns postgres.ColumnList
+	DefaultColumns postgres.ColumnList
+}
+
+type AuthPersonalTokenTable struct {
+	authPersonalTokenTable
+
+	EXCLUDED authPersonalTokenTable
+}
+
+// AS creates new AuthPersonalTokenTable with assigned alias
+func (a AuthPersonalTokenTable) AS(alias string) *AuthPersonalTokenTable {
+	return newAuthPersonalTokenTable(a.SchemaName(), a.TableName(), alias)
+}
+
+// Schema creates new AuthPersonalTokenTable with assigned schema name
+func (a AuthPersonalTokenTable) FromSchema(schemaName string) *AuthPersonalTokenTable {
+	return newAuthPersonalTokenTable(schemaName, a.TableName(), a.Alias())
+}
+
+// WithPrefix creates new AuthPersonalTokenTable with assigned table prefix
+func (a AuthPersonalTokenTable) WithPrefix(prefix string) *AuthPersonalTokenTable {
+	return newAuthPersonalTokenTable(a.SchemaName(), prefix+a.TableName(), a.TableName())
+}
+
+// WithSuffix creates new AuthPersonalTokenTable with assigned table suffix
+func (a AuthPersonalTokenTable) WithSuffix(suffix string) *AuthPersonalTokenTable {
+	return newAuthPersonalTokenTable(a.SchemaName(), a.TableName()+suffix, a.TableName())
+}
+
+func newAuthPersonalTokenTable(schemaName, tableName, alias string) *AuthPersonalTokenTable {
+	return &AuthPersonalTokenTable{
+		authPersonalTokenTable: newAuthPersonalTokenTableImpl(schemaName, tableName, alias),
+		EXCLUDED:               newAuthPersonalTokenTableImpl("", "excluded", ""),
+	}
+}
+
+func newAuthPersonalTokenTableImpl(schemaName, tableName, alias string) authPersonalTokenTable {
+	var (
+		IDColumn         = postgres.IntegerColumn("id")
+		UserIDColumn     = postgres.IntegerColumn("user_id")
+		NameColumn       = postgres.StringColumn("name")
+		TokenHashColumn  = postgres.StringColumn("token_hash")
+		ScopesColumn     = postgres.StringColumn("scopes")
+		CreatedAtColumn  = postgres.TimestampzColumn("created_at")
+		ExpiresAtColumn  = postgres.TimestampzColumn("expires_at")
+		LastUsedAtColumn = postgres.TimestampzColumn("last_used_at")
+		RevokedAtColumn  = postgres.TimestampzColumn("revoked_at")
+		allColumns       = postgres.ColumnList{IDColumn, UserIDColumn, NameColumn, TokenHashColumn, ScopesColumn, CreatedAtColumn, ExpiresAtColumn, LastUsedAtColumn, RevokedAtColumn}
+		mutableColumns   = postgres.ColumnList{UserIDColumn, NameColumn, TokenHashColumn, ScopesColumn, CreatedAtColumn, ExpiresAtColumn, LastUsedAtColumn, RevokedAtColumn}
+		defaultColumns   = postgres.ColumnList{ScopesColumn, CreatedAtColumn}
+	)
+
+	return authPersonalTokenTable{
+		Table: postgres.NewTable(schemaName, tableName, alias, allColumns...),
+
+		//Columns
+		ID:         IDColumn,
+		UserID:     UserIDColumn,
+		Name:       NameColumn,
+		TokenHash:  TokenHashColumn,
+		Scopes:     ScopesColumn,
+		CreatedAt:  CreatedAtColumn,
+		ExpiresAt:  ExpiresAtColumn,
+		LastUsedAt: LastUsedAtColumn,
+		RevokedAt:  RevokedAtColumn,
+
+		AllColumns:     allColumns,
+		MutableColumns: mutableColumns,
+		DefaultColumns: defaultColumns,
+	}
+}
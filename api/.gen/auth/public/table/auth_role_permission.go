@@ -0,0 +1,81 @@
+//
+// Code generated by go-jet DO NOT EDIT.
+//
+// WARNING: Changes to this file may cause incorrect behavior
+// and will be lost if the code is regenerated
+//
+
+package table
+
+import (
+	"github.com/go-jet/jet/v2/postgres"
+)
+
+var AuthRolePermission = newAuthRolePermissionTable("public", "auth_role_permission", "")
+
+type authRolePermissionTable struct {
+	postgres.Table
+
+	// Columns
+	Role       postgres.ColumnString
+	Permission postgres.ColumnString
+
+	AllColumns     postgres.ColumnList
+	MutableColumns postgres.ColumnList
+	DefaultColumns postgres.ColumnList
+}
+
+type AuthRolePermissionTable struct {
+	authRolePermissionTable
+
+	EXCLUDED authRolePermissionTable
+}
+
+// AS creates new AuthRolePermissionTable with assigned alias
+func (a AuthRolePermissionTable) AS(alias string) *AuthRolePermissionTable {
+	return newAuthRolePermissionTable(a.SchemaName(), a.TableName(), alias)
+}
+
+// Schema creates new AuthRolePermissionTable with assigned schema name
+func (a AuthRolePermissionTable) FromSchema(schemaName string) *AuthRolePermissionTable {
+	return newAuthRolePermissionTable(schemaName, a.TableName(), a.Alias())
+}
+
+// WithPrefix creates new AuthRolePermissionTable with assigned table prefix
+func (a AuthRolePermissionTable) WithPrefix(prefix string) *AuthRolePermissionTable {
+	return newAuthRolePermissionTable(a.SchemaName(), prefix+a.TableName(), a.TableName())
+}
+
+// WithSuffix creates new AuthRolePermissionTable with assigned table suffix
+func (a AuthRolePermissionTable) WithSuffix(suffix string) *AuthRolePermissionTable {
+	return newAuthRolePermissionTable(a.SchemaName(), a.TableName()+suffix, a.TableName())
+}
+
+func newAuthRolePermissionTable(schemaName, tableName, alias string) *AuthRolePermissionTable {
+	return &AuthRolePermissionTable{
+		authRolePermissionTable: newAuthRolePermissionTableImpl(schemaName, tableName, alias),
+		EXCLUDED:                newAuthRolePermissionTableImpl("", "excluded", ""),
+	}
+}
+
+func newAuthRolePermissionTableImpl(schemaName, tableName, alias string) authRolePermissionTable {
+	var (
+		RoleColumn       = postgres.StringColumn("role")
+		PermissionColumn = postgres.StringColumn("permission")
+		allColumns       = postgres.ColumnList{RoleColumn, PermissionColumn}
+		mutableColumns   = postgres.ColumnList{}
+		defaultColumns   = postgres.ColumnList{}
+	)
+
+	return authRolePermissionTable{
+		Table: postgres.NewTable(schemaName, tableName, alias, allColumns...),
+
+		//Columns
+		Role:       RoleColumn,
+		Permission: PermissionColumn,
+
+		AllColumns:     allColumns,
+		MutableColumns: mutableColumns,
+		DefaultColumns: defaultColumns,
+	}
+}
@@ -0,0 +1,102 @@
+//
+// Code generated by go-jet DO NOT EDIT.
+//
+// WARNING: Changes to this file may cause incorrect behavior
+// and will be lost if the code is regenerated
+//
+
+package table
+
+import (
+	"github.com/go-jet/jet/v2/postgres"
+)
+
+var AuthStrike = newAuthStrikeTable("public", "auth_strike", "")
+
+type authStrikeTable struct {
+	postgres.Table
+
+	// Columns
+	ID            postgres.ColumnInteger
+	UserID        postgres.ColumnInteger
+	ActorUser     postgres.ColumnInteger
+	Reason        postgres.ColumnString
+	Evidence      postgres.ColumnString
+	CreatedAt     postgres.ColumnTimestampz
+	RetractedAt   postgres.ColumnTimestampz
+	RetractedBy   postgres.ColumnInteger
+	RetractReason postgres.ColumnString
+
+	AllColumns     postgres.ColumnList
+	MutableColumns postgres.ColumnList
+	DefaultColumns postgres.ColumnList
+}
+
+type AuthStrikeTable struct {
+	authStrikeTable
+
+	EXCLUDED authStrikeTable
+}
+
+// AS creates new AuthStrikeTable with assigned alias
+func (a AuthStrikeTable) AS(alias string) *AuthStrikeTable {
+	return newAuthStrikeTable(a.SchemaName(), a.TableName(), alias)
+}
+
+// Schema creates new AuthStrikeTable with assigned schema name
+func (a AuthStrikeTable) FromSchema(schemaName string) *AuthStrikeTable {
+	return newAuthStrikeTable(schemaName, a.TableName(), a.Alias())
+}
+
+// WithPrefix creates new AuthStrikeTable with assigned table prefix
+func (a AuthStrikeTable) WithPrefix(prefix string) *AuthStrikeTable {
+	return newAuthStrikeTable(a.SchemaName(), prefix+a.TableName(), a.TableName())
+}
+
+// WithSuffix creates new AuthStrikeTable with assigned table suffix
+func (a AuthStrikeTable) WithSuffix(suffix string) *AuthStrikeTable {
+	return newAuthStrikeTable(a.SchemaName(), a.TableName()+suffix, a.TableName())
+}
+
+func newAuthStrikeTable(schemaName, tableName, alias string) *AuthStrikeTable {
+	return &AuthStrikeTable{
+		authStrikeTable: newAuthStrikeTableImpl(schemaName, tableName, alias),
+		EXCLUDED:        newAuthStrikeTableImpl("", "excluded", ""),
+	}
+}
+
+func newAuthStrikeTableImpl(schemaName, tableName, alias string) authStrikeTable {
+	var (
+		IDColumn            = postgres.IntegerColumn("id")
+		UserIDColumn        = postgres.IntegerColumn("user_id")
+		ActorUserColumn     = postgres.IntegerColumn("actor_user")
+		ReasonColumn        = postgres.StringColumn("reason")
+		EvidenceColumn      = postgres.StringColumn("evidence")
+		CreatedAtColumn     = postgres.TimestampzColumn("created_at")
+		RetractedAtColumn   = postgres.TimestampzColumn("retracted_at")
+		RetractedByColumn   = postgres.IntegerColumn("retracted_by")
+		RetractReasonColumn = postgres.StringColumn("retract_reason")
+		allColumns          = postgres.ColumnList{IDColumn, UserIDColumn, ActorUserColumn, ReasonColumn, EvidenceColumn, CreatedAtColumn, RetractedAtColumn, RetractedByColumn, RetractReasonColumn}
+		mutableColumns      = postgres.ColumnList{UserIDColumn, ActorUserColumn, ReasonColumn, EvidenceColumn, CreatedAtColumn, RetractedAtColumn, RetractedByColumn, RetractReasonColumn}
+		defaultColumns      = postgres.ColumnList{CreatedAtColumn}
+	)
+
+	return authStrikeTable{
+		Table: postgres.NewTable(schemaName, tableName, alias, allColumns...),
+
+		//Columns
+		ID:            IDColumn,
+		UserID:        UserIDColumn,
+		ActorUser:     ActorUserColumn,
+		Reason:        ReasonColumn,
+		Evidence:      EvidenceColumn,
+		CreatedAt:     CreatedAtColumn,
+		RetractedAt:   RetractedAtColumn,
+		RetractedBy:   RetractedByColumn,
+		RetractReason: RetractReasonColumn,
+
+		AllColumns:     allColumns,
+		MutableColumns: mutableColumns,
+		DefaultColumns: defaultColumns,
+	}
+}
@@ -10,6 +10,12 @@ package table
 // UseSchema sets a new schema name for all generated table SQL builder types. It is recommended to invoke
 // this method only once at the beginning of the program.
 func UseSchema(schema string) {
+	AuthClient = AuthClient.FromSchema(schema)
 	AuthEvent = AuthEvent.FromSchema(schema)
+	AuthIdentity = AuthIdentity.FromSchema(schema)
+	AuthInvite = AuthInvite.FromSchema(schema)
+	AuthPersonalToken = AuthPersonalToken.FromSchema(schema)
+	AuthRolePermission = AuthRolePermission.FromSchema(schema)
+	AuthStrike = AuthStrike.FromSchema(schema)
 	AuthUser = AuthUser.FromSchema(schema)
 }
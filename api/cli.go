@@ -0,0 +1,252 @@
+package main
+
+import (
+	"auth/internal/infra"
+	"auth/internal/repository"
+	"auth/internal/service"
+	"auth/internal/util"
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func runMigrate(app *application, args []string) error {
+	if err := infra.Migrate(app.db); err != nil {
+		return err
+	}
+	fmt.Println("数据库迁移完成")
+	return nil
+}
+
+func runUser(app *application, args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	switch args[0] {
+	case "create":
+		return runUserCreate(app, args[1:])
+	case "set-password":
+		return runUserSetPassword(app, args[1:])
+	case "ban":
+		return runUserBan(app, args[1:])
+	default:
+		return errors.New(usage)
+	}
+}
+
+// 与注册接口相同的校验规则
+type userInput struct {
+	Username string `validate:"required,min=2,max=16"`
+	Email    string `validate:"required,email"`
+	Password string `validate:"required,min=8,max=100"`
+}
+
+func (input userInput) validate() error {
+	if err := validator.New().Struct(input); err != nil {
+		return fmt.Errorf("参数无效: %w", err)
+	}
+	if err := util.ValidUsername(input.Username); err != nil {
+		return fmt.Errorf("用户名无效: %w", err)
+	}
+	return validatePassword(input.Password)
+}
+
+func validatePassword(password string) error {
+	if err := validator.New().Var(password, "required,min=8,max=100"); err != nil {
+		return errors.New("密码长度需要在8到100个字符之间")
+	}
+	if err := util.ValidPassword(password); err != nil {
+		return fmt.Errorf("密码无效: %w", err)
+	}
+	return nil
+}
+
+// 密码从标准输入读取，避免出现在进程列表和命令历史中
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "密码: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", errors.New("未能从标准输入读取密码")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func runUserCreate(app *application, args []string) error {
+	flags := flag.NewFlagSet("user create", flag.ExitOnError)
+	username := flags.String("username", "", "用户名")
+	email := flags.String("email", "", "邮箱")
+	role := flags.String("role", repository.RoleMember, "角色")
+	flags.Parse(args)
+
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+	input := userInput{Username: *username, Email: *email, Password: password}
+	if err := input.validate(); err != nil {
+		return err
+	}
+	switch *role {
+	case repository.RoleAdmin, repository.RoleModerator, repository.RoleTrusted, repository.RoleMember:
+	default:
+		return fmt.Errorf("不支持的角色: %s", *role)
+	}
+
+	hashedPassword, err := util.GenerateHash(password)
+	if err != nil {
+		return err
+	}
+
+	user := &repository.User{
+		Username:  *username,
+		Email:     *email,
+		Role:      *role,
+		Password:  hashedPassword,
+		CreatedAt: time.Now(),
+		LastLogin: time.Now(),
+		Attr:      "{}",
+	}
+	if err := app.userRepo.Save(user); err != nil {
+		return err
+	}
+
+	app.eventRepo.Save(
+		service.EventRegister,
+		&struct {
+			App        string `json:"app"`
+			ActorUser  int64  `json:"actor_user"`
+			TargetUser int64  `json:"target_user"`
+			Role       string `json:"role"`
+		}{
+			App:        "cli",
+			ActorUser:  repository.SystemUserId,
+			TargetUser: user.ID,
+			Role:       user.Role,
+		},
+	)
+
+	fmt.Printf("已创建用户 %s (id=%d, role=%s)\n", user.Username, user.ID, user.Role)
+	return nil
+}
+
+func runUserSetPassword(app *application, args []string) error {
+	flags := flag.NewFlagSet("user set-password", flag.ExitOnError)
+	username := flags.String("username", "", "用户名")
+	flags.Parse(args)
+
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+
+	user, err := app.userRepo.FindByUsername(*username)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("用户不存在: %s", *username)
+	}
+
+	user.Password, err = util.GenerateHash(password)
+	if err != nil {
+		return err
+	}
+	if err := app.userRepo.UpdateHashedPassword(user); err != nil {
+		return err
+	}
+	if err := app.sessionRepo.RevokeUserSessions(user.ID); err != nil {
+		return err
+	}
+
+	app.eventRepo.Save(
+		service.EventResetPassword,
+		&struct {
+			ActorUser  int64 `json:"actor_user"`
+			TargetUser int64 `json:"target_user"`
+		}{
+			ActorUser:  repository.SystemUserId,
+			TargetUser: user.ID,
+		},
+	)
+
+	fmt.Printf("已重置用户 %s 的密码\n", user.Username)
+	return nil
+}
+
+func runUserBan(app *application, args []string) error {
+	flags := flag.NewFlagSet("user ban", flag.ExitOnError)
+	username := flags.String("username", "", "用户名")
+	reason := flags.String("reason", "", "封禁原因")
+	duration := flags.String("duration", "", "封禁时长，例如7d，为空表示永久")
+	flags.Parse(args)
+
+	if *reason == "" {
+		return errors.New("封禁原因不能为空")
+	}
+
+	var expiresAt *time.Time
+	if *duration != "" {
+		d, err := util.ParseDuration(*duration)
+		if err != nil {
+			return err
+		}
+		t := time.Now().Add(d)
+		expiresAt = &t
+	}
+
+	if err := app.adminService.Ban(repository.SystemUserId, *username, *reason, expiresAt); err != nil {
+		return err
+	}
+	fmt.Printf("已封禁用户 %s\n", *username)
+	return nil
+}
+
+func runClient(app *application, args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	switch args[0] {
+	case "create":
+		return runClientCreate(app, args[1:])
+	default:
+		return errors.New(usage)
+	}
+}
+
+func runClientCreate(app *application, args []string) error {
+	flags := flag.NewFlagSet("client create", flag.ExitOnError)
+	clientId := flags.String("client-id", "", "客户端ID")
+	name := flags.String("name", "", "名称")
+	scopes := flags.String("scopes", "", "逗号分隔的权限，例如user:read,user:ban")
+	flags.Parse(args)
+
+	if *clientId == "" || *name == "" {
+		return errors.New("客户端ID和名称不能为空")
+	}
+
+	var scopeList []string
+	for _, scope := range strings.Split(*scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopeList = append(scopeList, scope)
+		}
+	}
+
+	client, secret, err := app.adminService.RegisterClient(repository.SystemUserId, *clientId, *name, scopeList)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已创建客户端 %s\nclient_id: %s\nclient_secret: %s\n密钥只显示这一次，请妥善保存\n", client.Name, client.ClientID, secret)
+	return nil
+}
@@ -0,0 +1,35 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSiteVerifyCaptcha(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": r.Form.Get("secret") == "secret" &&
+				r.Form.Get("response") == "good-token" &&
+				r.Form.Get("remoteip") == "192.0.2.1",
+		})
+	}))
+	defer server.Close()
+
+	captcha := newSiteVerifyCaptcha("turnstile", server.URL, "site", "secret")
+	ok, err := captcha.Verify(context.Background(), "good-token", "192.0.2.1")
+	if err != nil || !ok {
+		t.Errorf("expected valid token, got %v, %v", ok, err)
+	}
+	ok, err = captcha.Verify(context.Background(), "bad-token", "192.0.2.1")
+	if err != nil || ok {
+		t.Errorf("expected invalid token, got %v, %v", ok, err)
+	}
+
+	if _, err := NewCaptchaVerifier("unknown", "site", "secret"); err == nil {
+		t.Error("expected unknown provider error")
+	}
+}
@@ -0,0 +1,345 @@
+package infra
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 第三方账号的基本信息，Subject在同一登录方式下唯一且不变
+type ExternalProfile struct {
+	Subject  string
+	Username string
+	// 只保存第三方已验证的邮箱，未验证时为空
+	Email string
+}
+
+// 第三方登录方式，使用OAuth2授权码流程
+type IdentityProvider interface {
+	Name() string
+	// 构造跳转到第三方授权页面的地址，codeVerifier用于PKCE
+	AuthCodeURL(state string, codeVerifier string, redirectUri string) string
+	// 用回调中的授权码换取第三方账号信息
+	Exchange(ctx context.Context, code string, codeVerifier string, redirectUri string) (*ExternalProfile, error)
+}
+
+var ErrProviderResponse = errors.New("unexpected identity provider response")
+
+// PKCE的S256 code_challenge
+func codeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type oauthToken struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type oauthProvider struct {
+	name         string
+	clientId     string
+	clientSecret string
+	authUrl      string
+	tokenUrl     string
+	scopes       []string
+	// QQ的令牌接口只接受GET请求，且需要fmt=json才返回JSON
+	tokenByGet bool
+	profile    func(ctx context.Context, p *oauthProvider, token *oauthToken) (*ExternalProfile, error)
+	client     *http.Client
+}
+
+func newOAuthProvider(name, clientId, clientSecret, authUrl, tokenUrl string, scopes []string) *oauthProvider {
+	return &oauthProvider{
+		name:         name,
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		authUrl:      authUrl,
+		tokenUrl:     tokenUrl,
+		scopes:       scopes,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *oauthProvider) Name() string {
+	return p.name
+}
+
+func (p *oauthProvider) AuthCodeURL(state string, codeVerifier string, redirectUri string) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.clientId},
+		"redirect_uri":          {redirectUri},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge(codeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+	if len(p.scopes) > 0 {
+		query.Set("scope", strings.Join(p.scopes, " "))
+	}
+	separator := "?"
+	if strings.Contains(p.authUrl, "?") {
+		separator = "&"
+	}
+	return p.authUrl + separator + query.Encode()
+}
+
+func (p *oauthProvider) Exchange(ctx context.Context, code string, codeVerifier string, redirectUri string) (*ExternalProfile, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectUri},
+		"client_id":     {p.clientId},
+		"client_secret": {p.clientSecret},
+		"code_verifier": {codeVerifier},
+	}
+
+	var req *http.Request
+	var err error
+	if p.tokenByGet {
+		form.Set("fmt", "json")
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, p.tokenUrl+"?"+form.Encode(), nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, p.tokenUrl, strings.NewReader(form.Encode()))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if req.Method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	var token oauthToken
+	if err := p.doJson(req, &token); err != nil {
+		return nil, err
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrProviderResponse, token.Error, token.ErrorDescription)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("%w: missing access token", ErrProviderResponse)
+	}
+
+	profile, err := p.profile(ctx, p, &token)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrProviderResponse)
+	}
+	return profile, nil
+}
+
+func (p *oauthProvider) get(ctx context.Context, endpoint string, token *oauthToken, dest any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if token != nil {
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	}
+	return p.doJson(req, dest)
+}
+
+func (p *oauthProvider) doJson(req *http.Request, dest any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s returned status %d", ErrProviderResponse, req.URL.Path, resp.StatusCode)
+	}
+	if err := json.Unmarshal(body, dest); err != nil {
+		return fmt.Errorf("%w: %v", ErrProviderResponse, err)
+	}
+	return nil
+}
+
+func NewGitHubProvider(clientId string, clientSecret string) IdentityProvider {
+	p := newOAuthProvider(
+		"github",
+		clientId,
+		clientSecret,
+		"https://github.com/login/oauth/authorize",
+		"https://github.com/login/oauth/access_token",
+		[]string{"read:user", "user:email"},
+	)
+	p.profile = githubProfile("https://api.github.com")
+	return p
+}
+
+func githubProfile(apiUrl string) func(context.Context, *oauthProvider, *oauthToken) (*ExternalProfile, error) {
+	return func(ctx context.Context, p *oauthProvider, token *oauthToken) (*ExternalProfile, error) {
+		var user struct {
+			Id    int64  `json:"id"`
+			Login string `json:"login"`
+		}
+		if err := p.get(ctx, apiUrl+"/user", token, &user); err != nil {
+			return nil, err
+		}
+		if user.Id == 0 {
+			return nil, fmt.Errorf("%w: missing user id", ErrProviderResponse)
+		}
+
+		// 公开邮箱不一定经过验证，以邮箱列表中已验证的主邮箱为准
+		var emails []struct {
+			Email    string `json:"email"`
+			Primary  bool   `json:"primary"`
+			Verified bool   `json:"verified"`
+		}
+		if err := p.get(ctx, apiUrl+"/user/emails", token, &emails); err != nil {
+			return nil, err
+		}
+		profile := &ExternalProfile{
+			Subject:  strconv.FormatInt(user.Id, 10),
+			Username: user.Login,
+		}
+		for _, email := range emails {
+			if email.Primary && email.Verified {
+				profile.Email = email.Email
+			}
+		}
+		return profile, nil
+	}
+}
+
+func NewGoogleProvider(clientId string, clientSecret string) IdentityProvider {
+	return newOIDCProvider("google", clientId, clientSecret, oidcConfiguration{
+		AuthorizationEndpoint: "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenEndpoint:         "https://oauth2.googleapis.com/token",
+		UserinfoEndpoint:      "https://openidconnect.googleapis.com/v1/userinfo",
+	})
+}
+
+type oidcConfiguration struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// 通用的OpenID Connect登录方式，启动时从issuer的发现文档读取各接口地址
+func NewOIDCProvider(ctx context.Context, name string, issuer string, clientId string, clientSecret string) (IdentityProvider, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	p := &oauthProvider{client: &http.Client{Timeout: 10 * time.Second}}
+
+	var config oidcConfiguration
+	if err := p.get(ctx, issuer+"/.well-known/openid-configuration", nil, &config); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(config.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("%w: issuer mismatch %q", ErrProviderResponse, config.Issuer)
+	}
+	if config.AuthorizationEndpoint == "" || config.TokenEndpoint == "" || config.UserinfoEndpoint == "" {
+		return nil, fmt.Errorf("%w: incomplete discovery document", ErrProviderResponse)
+	}
+	return newOIDCProvider(name, clientId, clientSecret, config), nil
+}
+
+func newOIDCProvider(name, clientId, clientSecret string, config oidcConfiguration) IdentityProvider {
+	p := newOAuthProvider(
+		name,
+		clientId,
+		clientSecret,
+		config.AuthorizationEndpoint,
+		config.TokenEndpoint,
+		[]string{"openid", "profile", "email"},
+	)
+	// 用户信息直接从第三方的userinfo接口获取，因此不需要校验id_token的签名
+	p.profile = func(ctx context.Context, p *oauthProvider, token *oauthToken) (*ExternalProfile, error) {
+		var userinfo struct {
+			Sub               string `json:"sub"`
+			PreferredUsername string `json:"preferred_username"`
+			Name              string `json:"name"`
+			Email             string `json:"email"`
+			EmailVerified     any    `json:"email_verified"`
+		}
+		if err := p.get(ctx, config.UserinfoEndpoint, token, &userinfo); err != nil {
+			return nil, err
+		}
+		profile := &ExternalProfile{
+			Subject:  userinfo.Sub,
+			Username: userinfo.PreferredUsername,
+		}
+		if profile.Username == "" {
+			profile.Username = userinfo.Name
+		}
+		// 部分实现将email_verified返回为字符串
+		if verified, _ := userinfo.EmailVerified.(bool); verified || userinfo.EmailVerified == "true" {
+			profile.Email = userinfo.Email
+		}
+		return profile, nil
+	}
+	return p
+}
+
+// QQ互联：令牌接口不返回用户标识，需要再调用/me获取openid
+func NewQQProvider(clientId string, clientSecret string) IdentityProvider {
+	p := newOAuthProvider(
+		"qq",
+		clientId,
+		clientSecret,
+		"https://graph.qq.com/oauth2.0/authorize",
+		"https://graph.qq.com/oauth2.0/token",
+		[]string{"get_user_info"},
+	)
+	p.tokenByGet = true
+	p.profile = qqProfile("https://graph.qq.com")
+	return p
+}
+
+func qqProfile(apiUrl string) func(context.Context, *oauthProvider, *oauthToken) (*ExternalProfile, error) {
+	return func(ctx context.Context, p *oauthProvider, token *oauthToken) (*ExternalProfile, error) {
+		var me struct {
+			ClientId string `json:"client_id"`
+			OpenId   string `json:"openid"`
+		}
+		query := url.Values{"access_token": {token.AccessToken}, "fmt": {"json"}}
+		if err := p.get(ctx, apiUrl+"/oauth2.0/me?"+query.Encode(), nil, &me); err != nil {
+			return nil, err
+		}
+		if me.ClientId != p.clientId {
+			return nil, fmt.Errorf("%w: token issued to another client", ErrProviderResponse)
+		}
+
+		var info struct {
+			Ret      int    `json:"ret"`
+			Msg      string `json:"msg"`
+			Nickname string `json:"nickname"`
+		}
+		query = url.Values{
+			"access_token":       {token.AccessToken},
+			"oauth_consumer_key": {p.clientId},
+			"openid":             {me.OpenId},
+		}
+		if err := p.get(ctx, apiUrl+"/user/get_user_info?"+query.Encode(), nil, &info); err != nil {
+			return nil, err
+		}
+		if info.Ret != 0 {
+			return nil, fmt.Errorf("%w: %d %s", ErrProviderResponse, info.Ret, info.Msg)
+		}
+		// QQ不提供邮箱
+		return &ExternalProfile{
+			Subject:  me.OpenId,
+			Username: info.Nickname,
+		}, nil
+	}
+}
@@ -0,0 +1,119 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// 本地的假OIDC服务，只实现授权码流程需要的接口
+func newFakeOIDCServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"userinfo_endpoint":      server.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "good-code" ||
+			r.Form.Get("client_secret") != "secret" ||
+			codeChallenge(r.Form.Get("code_verifier")) != codeChallenge("verifier") {
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer at" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"sub":                "user-1",
+			"preferred_username": "alice",
+			"email":              "alice@example.com",
+			"email_verified":     true,
+		})
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOIDCProvider(t *testing.T) {
+	server := newFakeOIDCServer(t)
+	ctx := context.Background()
+
+	provider, err := NewOIDCProvider(ctx, "fake", server.URL, "client", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authUrl, err := url.Parse(provider.AuthCodeURL("state-1", "verifier", "http://localhost/callback"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authUrl.Query()
+	if authUrl.Path != "/authorize" ||
+		query.Get("state") != "state-1" ||
+		query.Get("client_id") != "client" ||
+		query.Get("code_challenge") != codeChallenge("verifier") ||
+		query.Get("scope") != "openid profile email" {
+		t.Errorf("unexpected authorization url %s", authUrl)
+	}
+
+	profile, err := provider.Exchange(ctx, "good-code", "verifier", "http://localhost/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Subject != "user-1" || profile.Username != "alice" || profile.Email != "alice@example.com" {
+		t.Errorf("unexpected profile %+v", profile)
+	}
+
+	if _, err := provider.Exchange(ctx, "bad-code", "verifier", "http://localhost/callback"); err == nil {
+		t.Error("expected error for invalid code")
+	}
+	if _, err := provider.Exchange(ctx, "good-code", "other", "http://localhost/callback"); err == nil {
+		t.Error("expected error for wrong code verifier")
+	}
+}
+
+func TestOIDCIssuerMismatch(t *testing.T) {
+	server := newFakeOIDCServer(t)
+	if _, err := NewOIDCProvider(context.Background(), "fake", server.URL+"/other", "client", "secret"); err == nil {
+		t.Error("expected error for issuer mismatch")
+	}
+}
+
+func TestGitHubProfile(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"id": 42, "login": "octocat"})
+	})
+	mux.HandleFunc("/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]map[string]any{
+			{"email": "public@example.com", "primary": false, "verified": true},
+			{"email": "primary@example.com", "primary": true, "verified": true},
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	p := newOAuthProvider("github", "client", "secret", "", "", nil)
+	profile, err := githubProfile(server.URL)(context.Background(), p, &oauthToken{AccessToken: "at"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Subject != "42" || profile.Username != "octocat" || profile.Email != "primary@example.com" {
+		t.Errorf("unexpected profile %+v", profile)
+	}
+}
@@ -0,0 +1,142 @@
+package infra
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var (
+	ErrDirectoryUserNotFound       = errors.New("directory user not found")
+	ErrDirectoryInvalidCredentials = errors.New("directory credentials invalid")
+)
+
+// 目录中的用户条目
+type DirectoryEntry struct {
+	DN       string
+	Username string
+	Email    string
+	Groups   []string
+}
+
+// 外部目录服务，例如LDAP或Active Directory
+type Directory interface {
+	// 查找用户并以其身份校验密码
+	Authenticate(username string, password string) (*DirectoryEntry, error)
+}
+
+type LdapConfig struct {
+	Url          string
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// 查找用户的过滤器，%s替换为转义后的用户名，例如(uid=%s)
+	UserFilter   string
+	UsernameAttr string
+	EmailAttr    string
+	GroupAttr    string
+	StartTLS     bool
+}
+
+type ldapDirectory struct {
+	config LdapConfig
+}
+
+func NewLdapDirectory(config LdapConfig) Directory {
+	if config.UserFilter == "" {
+		config.UserFilter = "(uid=%s)"
+	}
+	if config.UsernameAttr == "" {
+		config.UsernameAttr = "uid"
+	}
+	if config.EmailAttr == "" {
+		config.EmailAttr = "mail"
+	}
+	if config.GroupAttr == "" {
+		config.GroupAttr = "memberOf"
+	}
+	return &ldapDirectory{config: config}
+}
+
+func (d *ldapDirectory) connect() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(d.config.Url, ldap.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(10 * time.Second)
+	if d.config.StartTLS {
+		u, err := url.Parse(d.config.Url)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: u.Hostname()}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (d *ldapDirectory) Authenticate(username string, password string) (*DirectoryEntry, error) {
+	// 空密码会被视为匿名绑定而成功
+	if password == "" {
+		return nil, ErrDirectoryInvalidCredentials
+	}
+
+	conn, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if d.config.BindDN != "" {
+		if err := conn.Bind(d.config.BindDN, d.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("service bind: %w", err)
+		}
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		d.config.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2,
+		10,
+		false,
+		fmt.Sprintf(d.config.UserFilter, ldap.EscapeFilter(username)),
+		[]string{d.config.UsernameAttr, d.config.EmailAttr, d.config.GroupAttr},
+		nil,
+	))
+	// 基准DN不存在说明配置有误，不能据此认为用户已被删除
+	if err != nil {
+		return nil, fmt.Errorf("search user: %w", err)
+	}
+	if len(result.Entries) == 0 {
+		return nil, ErrDirectoryUserNotFound
+	}
+	// 用户名对应多个条目时无法确定是谁
+	if len(result.Entries) > 1 {
+		return nil, fmt.Errorf("search user: %d entries match %q", len(result.Entries), username)
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrDirectoryInvalidCredentials
+		}
+		return nil, err
+	}
+
+	return &DirectoryEntry{
+		DN:       entry.DN,
+		Username: strings.TrimSpace(entry.GetAttributeValue(d.config.UsernameAttr)),
+		Email:    strings.TrimSpace(entry.GetAttributeValue(d.config.EmailAttr)),
+		Groups:   entry.GetAttributeValues(d.config.GroupAttr),
+	}, nil
+}
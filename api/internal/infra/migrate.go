@@ -0,0 +1,112 @@
+package infra
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+)
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// 多个副本同时启动时，通过该advisory lock保证迁移只执行一次
+const migrationLockId = 7291001
+
+// 按编号顺序执行尚未应用的迁移，已应用的迁移内容被修改时报错
+func Migrate(db *sql.DB) error {
+	return migrate(db, migrationFS)
+}
+
+func migrate(db *sql.DB, migrations fs.FS) error {
+	ctx := context.Background()
+
+	// advisory lock属于会话，加锁和解锁必须使用同一个连接
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockId); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockId)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version varchar(255) primary key,
+    checksum varchar(64) not null,
+    applied_at timestamptz not null default current_timestamp
+)`)
+	if err != nil {
+		return err
+	}
+
+	applied := make(map[string]string)
+	rows, err := conn.QueryContext(ctx, "SELECT version, checksum FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var version, checksum string
+		if err := rows.Scan(&version, &checksum); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = checksum
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	files, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		content, err := fs.ReadFile(migrations, file)
+		if err != nil {
+			return err
+		}
+		version := file[len("migrations/") : len(file)-len(".sql")]
+		sum := sha256.Sum256(content)
+		checksum := hex.EncodeToString(sum[:])
+
+		if appliedChecksum, ok := applied[version]; ok {
+			if appliedChecksum != checksum {
+				return fmt.Errorf("migration %s was modified after being applied", version)
+			}
+			continue
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, string(content)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %s failed: %w", version, err)
+		}
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, checksum) VALUES ($1, $2)",
+			version, checksum,
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		slog.Info("Applied migration", "version", version)
+	}
+	return nil
+}
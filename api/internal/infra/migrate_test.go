@@ -0,0 +1,212 @@
+package infra
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+)
+
+// 只认识Migrate所用语句的假数据库，记录每条语句及其所在的连接
+type fakeMigrationDb struct {
+	mu      sync.Mutex
+	applied map[string]string
+	log     []string
+	conns   int
+	// 执行内容包含该字符串的迁移时失败
+	failOn string
+}
+
+func (d *fakeMigrationDb) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.conns++
+	return &fakeMigrationConn{db: d, id: d.conns}, nil
+}
+
+func (d *fakeMigrationDb) record(conn int, statement string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.log = append(d.log, fmt.Sprintf("%d %s", conn, statement))
+}
+
+type fakeMigrationConn struct {
+	db *fakeMigrationDb
+	id int
+}
+
+func (c *fakeMigrationConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeMigrationStmt{conn: c, query: query}, nil
+}
+func (c *fakeMigrationConn) Close() error { return nil }
+func (c *fakeMigrationConn) Begin() (driver.Tx, error) {
+	c.db.record(c.id, "BEGIN")
+	return c, nil
+}
+func (c *fakeMigrationConn) Commit() error {
+	c.db.record(c.id, "COMMIT")
+	return nil
+}
+func (c *fakeMigrationConn) Rollback() error {
+	c.db.record(c.id, "ROLLBACK")
+	return nil
+}
+
+type fakeMigrationStmt struct {
+	conn  *fakeMigrationConn
+	query string
+}
+
+func (s *fakeMigrationStmt) Close() error  { return nil }
+func (s *fakeMigrationStmt) NumInput() int { return -1 }
+
+func (s *fakeMigrationStmt) Exec(args []driver.Value) (driver.Result, error) {
+	db := s.conn.db
+	db.record(s.conn.id, s.query)
+	switch {
+	case strings.HasPrefix(s.query, "INSERT INTO schema_migrations"):
+		db.mu.Lock()
+		db.applied[args[0].(string)] = args[1].(string)
+		db.mu.Unlock()
+	case db.failOn != "" && strings.Contains(s.query, db.failOn):
+		return nil, errors.New("syntax error")
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (s *fakeMigrationStmt) Query(args []driver.Value) (driver.Rows, error) {
+	db := s.conn.db
+	db.record(s.conn.id, s.query)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	rows := &fakeMigrationRows{}
+	for version, checksum := range db.applied {
+		rows.values = append(rows.values, []driver.Value{version, checksum})
+	}
+	return rows, nil
+}
+
+type fakeMigrationRows struct {
+	values [][]driver.Value
+}
+
+func (r *fakeMigrationRows) Columns() []string { return []string{"version", "checksum"} }
+func (r *fakeMigrationRows) Close() error      { return nil }
+func (r *fakeMigrationRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// 驱动不能重复注册，每个测试使用不同的名称
+var fakeMigrationDrivers atomic.Int32
+
+func openFakeMigrationDb(t *testing.T, fake *fakeMigrationDb) *sql.DB {
+	t.Helper()
+	name := fmt.Sprintf("fake-migration-%d", fakeMigrationDrivers.Add(1))
+	sql.Register(name, fake)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+var testMigrations = fstest.MapFS{
+	"migrations/0001_users.sql":  {Data: []byte("CREATE TABLE users ()")},
+	"migrations/0002_events.sql": {Data: []byte("CREATE TABLE events ()")},
+}
+
+func checksumOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// 所有语句都在加锁的连接上执行，并且以解锁结束
+func requireLocked(t *testing.T, log []string) {
+	t.Helper()
+	if len(log) < 2 ||
+		!strings.HasSuffix(log[0], "SELECT pg_advisory_lock($1)") ||
+		!strings.HasSuffix(log[len(log)-1], "SELECT pg_advisory_unlock($1)") {
+		t.Fatalf("expected statements to be wrapped in advisory lock, got %q", log)
+	}
+	conn, _, _ := strings.Cut(log[0], " ")
+	for _, entry := range log {
+		if !strings.HasPrefix(entry, conn+" ") {
+			t.Errorf("statement ran outside the locked connection: %q", entry)
+		}
+	}
+}
+
+func executed(log []string, statement string) bool {
+	return slices.ContainsFunc(log, func(entry string) bool {
+		return strings.HasSuffix(entry, " "+statement)
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	fake := &fakeMigrationDb{applied: map[string]string{}}
+	db := openFakeMigrationDb(t, fake)
+
+	if err := migrate(db, testMigrations); err != nil {
+		t.Fatal(err)
+	}
+	requireLocked(t, fake.log)
+	if fake.applied["0001_users"] != checksumOf("CREATE TABLE users ()") ||
+		fake.applied["0002_events"] != checksumOf("CREATE TABLE events ()") {
+		t.Errorf("unexpected applied migrations %v", fake.applied)
+	}
+
+	// 已应用的迁移不再执行
+	fake.log = nil
+	if err := migrate(db, testMigrations); err != nil {
+		t.Fatal(err)
+	}
+	requireLocked(t, fake.log)
+	if executed(fake.log, "CREATE TABLE users ()") || executed(fake.log, "CREATE TABLE events ()") {
+		t.Errorf("applied migrations ran again: %q", fake.log)
+	}
+}
+
+func TestMigrateChecksumMismatch(t *testing.T) {
+	fake := &fakeMigrationDb{applied: map[string]string{"0001_users": checksumOf("CREATE TABLE users (id int)")}}
+	db := openFakeMigrationDb(t, fake)
+
+	err := migrate(db, testMigrations)
+	if err == nil || !strings.Contains(err.Error(), "0001_users was modified") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+	requireLocked(t, fake.log)
+	if executed(fake.log, "CREATE TABLE events ()") {
+		t.Error("later migrations ran after checksum mismatch")
+	}
+}
+
+func TestMigrateFailure(t *testing.T) {
+	fake := &fakeMigrationDb{applied: map[string]string{}, failOn: "events"}
+	db := openFakeMigrationDb(t, fake)
+
+	if err := migrate(db, testMigrations); err == nil || !strings.Contains(err.Error(), "0002_events failed") {
+		t.Fatalf("expected migration failure, got %v", err)
+	}
+	requireLocked(t, fake.log)
+	if _, ok := fake.applied["0002_events"]; ok {
+		t.Error("failed migration was recorded")
+	}
+	if !executed(fake.log, "ROLLBACK") {
+		t.Error("failed migration was not rolled back")
+	}
+}
@@ -13,4 +13,4 @@ CREATE TABLE IF NOT EXISTS auth_event (
     action varchar(128) not null,
     detail jsonb not null default '{}'::jsonb,
     created_at timestamptz not null default current_timestamp
-);
\ No newline at end of file
+);
@@ -0,0 +1,12 @@
+-- 将事件中以用户名记录的 actor_user/target_user 替换为 auth_user.id
+UPDATE auth_event e
+SET detail = jsonb_set(e.detail, '{actor_user}', to_jsonb(u.id))
+FROM auth_user u
+WHERE jsonb_typeof(e.detail -> 'actor_user') = 'string'
+  AND e.detail ->> 'actor_user' = u.username;
+
+UPDATE auth_event e
+SET detail = jsonb_set(e.detail, '{target_user}', to_jsonb(u.id))
+FROM auth_user u
+WHERE jsonb_typeof(e.detail -> 'target_user') = 'string'
+  AND e.detail ->> 'target_user' = u.username;
@@ -0,0 +1,5 @@
+CREATE INDEX IF NOT EXISTS auth_event_action_idx ON auth_event (action);
+CREATE INDEX IF NOT EXISTS auth_event_created_at_idx ON auth_event (created_at);
+CREATE INDEX IF NOT EXISTS auth_event_actor_user_idx ON auth_event ((detail ->> 'actor_user'));
+CREATE INDEX IF NOT EXISTS auth_event_target_user_idx ON auth_event ((detail ->> 'target_user'));
+CREATE INDEX IF NOT EXISTS auth_event_ip_idx ON auth_event ((detail ->> 'ip'));
@@ -0,0 +1,3 @@
+ALTER TABLE auth_user ADD COLUMN IF NOT EXISTS role_expires_at timestamptz;
+ALTER TABLE auth_user ADD COLUMN IF NOT EXISTS previous_role varchar(128);
+CREATE INDEX IF NOT EXISTS auth_user_role_expires_at_idx ON auth_user (role_expires_at) WHERE role_expires_at IS NOT NULL;
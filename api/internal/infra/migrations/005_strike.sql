@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS auth_strike (
+    id bigint generated always as identity primary key,
+    user_id bigint not null references auth_user (id) on delete cascade,
+    actor_user bigint not null,
+    reason text not null,
+    evidence text not null,
+    created_at timestamptz not null default current_timestamp,
+    retracted_at timestamptz,
+    retracted_by bigint,
+    retract_reason text
+);
+CREATE INDEX IF NOT EXISTS auth_strike_user_id_idx ON auth_strike (user_id, created_at);
+
+-- 之前的警告被错误地记录为 restrict-user 事件，通过 evidence 字段识别并迁移
+INSERT INTO auth_strike (user_id, actor_user, reason, evidence, created_at)
+SELECT (e.detail ->> 'target_user')::bigint,
+       (e.detail ->> 'actor_user')::bigint,
+       e.detail ->> 'reason',
+       e.detail ->> 'evidence',
+       e.created_at
+FROM auth_event e
+JOIN auth_user u ON e.detail ->> 'target_user' = u.id::text
+WHERE e.action = 'restrict-user'
+  AND e.detail ? 'evidence'
+  AND e.detail ->> 'actor_user' ~ '^[0-9]+$'
+  AND NOT EXISTS (
+    SELECT 1 FROM auth_strike s
+    WHERE s.user_id = u.id AND s.created_at = e.created_at
+  );
+
+UPDATE auth_event
+SET action = 'strike-user'
+WHERE action = 'restrict-user'
+  AND detail ? 'evidence';
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS auth_role_permission (
+    role varchar(128) not null,
+    permission varchar(128) not null,
+    primary key (role, permission)
+);
+INSERT INTO auth_role_permission (role, permission) VALUES
+    ('admin', 'user:read'),
+    ('admin', 'user:strike'),
+    ('admin', 'user:restrict'),
+    ('admin', 'user:ban'),
+    ('admin', 'events:read'),
+    ('admin', 'clients:write'),
+    ('moderator', 'user:read'),
+    ('moderator', 'user:strike'),
+    ('moderator', 'user:restrict'),
+    ('moderator', 'events:read')
+ON CONFLICT DO NOTHING;
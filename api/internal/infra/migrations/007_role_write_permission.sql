@@ -0,0 +1,3 @@
+INSERT INTO auth_role_permission (role, permission) VALUES
+    ('admin', 'roles:write')
+ON CONFLICT DO NOTHING;
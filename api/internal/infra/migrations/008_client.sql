@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS auth_client (
+    id bigint generated always as identity primary key,
+    client_id text not null unique,
+    name text not null,
+    secret text not null,
+    created_at timestamptz not null default current_timestamp,
+    disabled_at timestamptz
+);
@@ -0,0 +1,2 @@
+-- 以空格分隔的权限列表，客户端凭据签发的令牌只能包含这些权限
+ALTER TABLE auth_client ADD COLUMN IF NOT EXISTS scopes text not null default '';
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS auth_personal_token (
+    id bigint generated always as identity primary key,
+    user_id bigint not null references auth_user (id) on delete cascade,
+    name text not null,
+    token_hash text not null unique,
+    scopes text not null default '',
+    created_at timestamptz not null default current_timestamp,
+    expires_at timestamptz not null,
+    last_used_at timestamptz,
+    revoked_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS auth_personal_token_user_id_idx ON auth_personal_token (user_id);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS auth_identity (
+    id bigint generated always as identity primary key,
+    user_id bigint not null references auth_user (id) on delete cascade,
+    provider varchar(64) not null,
+    subject text not null,
+    email text not null default '',
+    created_at timestamptz not null default current_timestamp,
+    unique (provider, subject),
+    unique (user_id, provider)
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS auth_invite (
+    id bigint generated always as identity primary key,
+    code varchar(64) not null unique,
+    created_by bigint not null,
+    note text not null default '',
+    max_uses integer not null,
+    uses integer not null default 0,
+    expires_at timestamptz,
+    created_at timestamptz not null default current_timestamp,
+    revoked_at timestamptz
+);
+INSERT INTO auth_role_permission (role, permission) VALUES
+    ('admin', 'invites:write')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"auth/.gen/auth/public/model"
+	. "auth/.gen/auth/public/table"
+	"database/sql"
+	"strings"
+	"time"
+
+	. "github.com/go-jet/jet/v2/postgres"
+	"github.com/go-jet/jet/v2/qrm"
+)
+
+// 调用内省、撤销等接口的下游服务，使用client_id和secret认证
+// Scopes为以空格分隔的权限列表，限制客户端凭据签发的令牌
+type Client = model.AuthClient
+
+func ClientScopes(client *Client) []string {
+	return strings.Fields(client.Scopes)
+}
+
+type ClientRepository interface {
+	List() ([]*Client, error)
+	FindByClientId(clientId string) (*Client, error)
+	Save(client *Client) error
+	Disable(client *Client) error
+	UpdateSecret(client *Client) error
+}
+
+type clientRepository struct {
+	db *sql.DB
+}
+
+func NewClientRepository(db *sql.DB) ClientRepository {
+	return &clientRepository{db: db}
+}
+
+func (r *clientRepository) List() ([]*Client, error) {
+	stmt := SELECT(AuthClient.AllColumns).
+		FROM(AuthClient).
+		ORDER_BY(AuthClient.ID.ASC())
+
+	var dest []*Client
+	err := stmt.Query(r.db, &dest)
+	if err == qrm.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+func (r *clientRepository) FindByClientId(clientId string) (*Client, error) {
+	stmt := SELECT(AuthClient.AllColumns).
+		FROM(AuthClient).
+		WHERE(AuthClient.ClientID.EQ(String(clientId)))
+
+	var dest Client
+	err := stmt.Query(r.db, &dest)
+	if err == qrm.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &dest, nil
+}
+
+func (r *clientRepository) Save(client *Client) error {
+	stmt := AuthClient.INSERT(AuthClient.MutableColumns).
+		MODEL(client).
+		RETURNING(AuthClient.AllColumns)
+
+	return stmt.Query(r.db, client)
+}
+
+func (r *clientRepository) Disable(client *Client) error {
+	now := time.Now()
+	stmt := AuthClient.UPDATE(AuthClient.DisabledAt).
+		SET(TimestampzT(now)).
+		WHERE(AuthClient.ID.EQ(Int(client.ID)))
+
+	if _, err := stmt.Exec(r.db); err != nil {
+		return err
+	}
+	client.DisabledAt = &now
+	return nil
+}
+
+func (r *clientRepository) UpdateSecret(client *Client) error {
+	stmt := AuthClient.UPDATE(AuthClient.Secret).
+		SET(String(client.Secret)).
+		WHERE(AuthClient.ID.EQ(Int(client.ID)))
+
+	_, err := stmt.Exec(r.db)
+	return err
+}
@@ -5,6 +5,7 @@ import (
 	. "auth/.gen/auth/public/table"
 	"database/sql"
 	"encoding/json"
+	"strconv"
 	"time"
 
 	. "github.com/go-jet/jet/v2/postgres"
@@ -13,16 +14,21 @@ import (
 
 type Event = model.AuthEvent
 
+// 由系统自动执行的操作以此作为actor_user
+const SystemUserId int64 = 0
+
+// ActorUser和TargetUser为nil时不过滤，系统用户的id为0
 type EventFilter struct {
-	ActorUser     string
-	TargetUser    string
+	ActorUser     *int64
+	TargetUser    *int64
 	Action        string
+	Ip            string
 	CreatedAfter  time.Time
 	CreatedBefore time.Time
 }
 
 type EventRepository interface {
-	List(filter EventFilter, pageNumber, pageSize int64) ([]*Event, error)
+	List(filter EventFilter, beforeId, limit int64) ([]*Event, error)
 	Save(action string, detail interface{}) error
 }
 
@@ -36,32 +42,40 @@ func NewEventRepository(db *sql.DB) EventRepository {
 	}
 }
 
-func (r *eventRepository) List(filter EventFilter, pageNumber, pageSize int64) ([]*Event, error) {
-	stmt := SELECT(AuthEvent.AllColumns).
-		FROM(AuthEvent)
+// 按id倒序返回事件，beforeId不为0时只返回id小于它的事件
+func (r *eventRepository) List(filter EventFilter, beforeId, limit int64) ([]*Event, error) {
+	condition := Bool(true)
 
-	if filter.ActorUser != "" {
-		stmt = stmt.WHERE(RawBool("detail ->> 'actor_user' = $user",
-			map[string]interface{}{"$user": filter.ActorUser}))
+	if filter.ActorUser != nil {
+		condition = condition.AND(RawBool("detail ->> 'actor_user' = $actor",
+			map[string]interface{}{"$actor": strconv.FormatInt(*filter.ActorUser, 10)}))
 	}
-	if filter.TargetUser != "" {
-		stmt = stmt.WHERE(RawBool("detail ->> 'target_user' = $user",
-			map[string]interface{}{"$user": filter.TargetUser}))
+	if filter.TargetUser != nil {
+		condition = condition.AND(RawBool("detail ->> 'target_user' = $target",
+			map[string]interface{}{"$target": strconv.FormatInt(*filter.TargetUser, 10)}))
+	}
+	if filter.Ip != "" {
+		condition = condition.AND(RawBool("detail ->> 'ip' = $ip",
+			map[string]interface{}{"$ip": filter.Ip}))
 	}
 	if filter.Action != "" {
-		stmt = stmt.WHERE(AuthEvent.Action.EQ(String(filter.Action)))
+		condition = condition.AND(AuthEvent.Action.EQ(String(filter.Action)))
 	}
 	if !filter.CreatedAfter.IsZero() {
-		stmt = stmt.WHERE(AuthEvent.CreatedAt.GT(TimestampzT(filter.CreatedAfter)))
+		condition = condition.AND(AuthEvent.CreatedAt.GT(TimestampzT(filter.CreatedAfter)))
 	}
 	if !filter.CreatedBefore.IsZero() {
-		stmt = stmt.WHERE(AuthEvent.CreatedAt.LT(TimestampzT(filter.CreatedBefore)))
+		condition = condition.AND(AuthEvent.CreatedAt.LT(TimestampzT(filter.CreatedBefore)))
+	}
+	if beforeId != 0 {
+		condition = condition.AND(AuthEvent.ID.LT(Int(beforeId)))
 	}
 
-	stmt = stmt.
-		ORDER_BY(AuthUser.ID.ASC()).
-		LIMIT(pageSize).
-		OFFSET(pageNumber * pageSize)
+	stmt := SELECT(AuthEvent.AllColumns).
+		FROM(AuthEvent).
+		WHERE(condition).
+		ORDER_BY(AuthEvent.ID.DESC()).
+		LIMIT(limit)
 
 	var dest []*Event
 	err := stmt.Query(r.db, &dest)
@@ -86,3 +100,26 @@ func (r *eventRepository) Save(action string, detail interface{}) error {
 	_, err := stmt.Exec(r.db)
 	return err
 }
+
+type actorClientEventRepository struct {
+	EventRepository
+	clientId string
+}
+
+// 保存的事件详情中附加actor_client，用于区分机器令牌代表的客户端
+func WithActorClient(eventRepo EventRepository, clientId string) EventRepository {
+	return &actorClientEventRepository{
+		EventRepository: eventRepo,
+		clientId:        clientId,
+	}
+}
+
+func (r *actorClientEventRepository) Save(action string, detail interface{}) error {
+	encoded, err := json.Marshal(detail)
+	var fields map[string]json.RawMessage
+	if err != nil || json.Unmarshal(encoded, &fields) != nil || fields == nil {
+		return r.EventRepository.Save(action, detail)
+	}
+	fields["actor_client"], _ = json.Marshal(r.clientId)
+	return r.EventRepository.Save(action, fields)
+}
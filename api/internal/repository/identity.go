@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"auth/.gen/auth/public/model"
+	. "auth/.gen/auth/public/table"
+	"database/sql"
+
+	. "github.com/go-jet/jet/v2/postgres"
+	"github.com/go-jet/jet/v2/qrm"
+)
+
+// 第三方登录账号与本地用户的绑定，每个用户在每个登录方式下最多绑定一个账号
+type Identity = model.AuthIdentity
+
+type IdentityRepository interface {
+	ListByUser(userId int64) ([]*Identity, error)
+	Find(provider string, subject string) (*Identity, error)
+	Save(identity *Identity) error
+	Delete(userId int64, provider string) error
+}
+
+type identityRepository struct {
+	db *sql.DB
+}
+
+func NewIdentityRepository(db *sql.DB) IdentityRepository {
+	return &identityRepository{db: db}
+}
+
+func (r *identityRepository) ListByUser(userId int64) ([]*Identity, error) {
+	stmt := SELECT(AuthIdentity.AllColumns).
+		FROM(AuthIdentity).
+		WHERE(AuthIdentity.UserID.EQ(Int(userId))).
+		ORDER_BY(AuthIdentity.ID.ASC())
+
+	var dest []*Identity
+	err := stmt.Query(r.db, &dest)
+	if err == qrm.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+func (r *identityRepository) Find(provider string, subject string) (*Identity, error) {
+	stmt := SELECT(AuthIdentity.AllColumns).
+		FROM(AuthIdentity).
+		WHERE(
+			AuthIdentity.Provider.EQ(String(provider)).
+				AND(AuthIdentity.Subject.EQ(String(subject))),
+		)
+
+	var dest Identity
+	err := stmt.Query(r.db, &dest)
+	if err == qrm.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &dest, nil
+}
+
+func (r *identityRepository) Save(identity *Identity) error {
+	stmt := AuthIdentity.INSERT(AuthIdentity.MutableColumns).
+		MODEL(identity).
+		RETURNING(AuthIdentity.AllColumns)
+
+	return stmt.Query(r.db, identity)
+}
+
+func (r *identityRepository) Delete(userId int64, provider string) error {
+	stmt := AuthIdentity.DELETE().
+		WHERE(
+			AuthIdentity.UserID.EQ(Int(userId)).
+				AND(AuthIdentity.Provider.EQ(String(provider))),
+		)
+
+	_, err := stmt.Exec(r.db)
+	return err
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"auth/.gen/auth/public/model"
+	. "auth/.gen/auth/public/table"
+	"database/sql"
+	"time"
+
+	. "github.com/go-jet/jet/v2/postgres"
+	"github.com/go-jet/jet/v2/qrm"
+)
+
+// 管理员创建的注册邀请码，可限制使用次数和有效期
+type Invite = model.AuthInvite
+
+type InviteRepository interface {
+	List() ([]*Invite, error)
+	FindByCode(code string) (*Invite, error)
+	Save(invite *Invite) error
+	// 占用一次邀请码，邀请码无效、已过期、已撤销或已用完时返回nil
+	Use(code string) (*Invite, error)
+	// 注册失败时归还占用的次数
+	Release(invite *Invite) error
+	Revoke(invite *Invite) error
+}
+
+type inviteRepository struct {
+	db *sql.DB
+}
+
+func NewInviteRepository(db *sql.DB) InviteRepository {
+	return &inviteRepository{db: db}
+}
+
+func (r *inviteRepository) List() ([]*Invite, error) {
+	stmt := SELECT(AuthInvite.AllColumns).
+		FROM(AuthInvite).
+		ORDER_BY(AuthInvite.ID.DESC())
+
+	var dest []*Invite
+	err := stmt.Query(r.db, &dest)
+	if err == qrm.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+func (r *inviteRepository) FindByCode(code string) (*Invite, error) {
+	stmt := SELECT(AuthInvite.AllColumns).
+		FROM(AuthInvite).
+		WHERE(AuthInvite.Code.EQ(String(code)))
+
+	var dest Invite
+	err := stmt.Query(r.db, &dest)
+	if err == qrm.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &dest, nil
+}
+
+func (r *inviteRepository) Save(invite *Invite) error {
+	stmt := AuthInvite.INSERT(AuthInvite.MutableColumns).
+		MODEL(invite).
+		RETURNING(AuthInvite.AllColumns)
+
+	return stmt.Query(r.db, invite)
+}
+
+func (r *inviteRepository) Use(code string) (*Invite, error) {
+	// 在同一条语句中检查并增加次数，避免并发注册超过上限
+	stmt := AuthInvite.UPDATE(AuthInvite.Uses).
+		SET(AuthInvite.Uses.ADD(Int(1))).
+		WHERE(
+			AuthInvite.Code.EQ(String(code)).
+				AND(AuthInvite.RevokedAt.IS_NULL()).
+				AND(AuthInvite.Uses.LT(AuthInvite.MaxUses)).
+				AND(AuthInvite.ExpiresAt.IS_NULL().OR(AuthInvite.ExpiresAt.GT(TimestampzT(time.Now())))),
+		).
+		RETURNING(AuthInvite.AllColumns)
+
+	var dest Invite
+	err := stmt.Query(r.db, &dest)
+	if err == qrm.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &dest, nil
+}
+
+func (r *inviteRepository) Release(invite *Invite) error {
+	stmt := AuthInvite.UPDATE(AuthInvite.Uses).
+		SET(AuthInvite.Uses.SUB(Int(1))).
+		WHERE(
+			AuthInvite.ID.EQ(Int(invite.ID)).
+				AND(AuthInvite.Uses.GT(Int(0))),
+		)
+
+	_, err := stmt.Exec(r.db)
+	return err
+}
+
+func (r *inviteRepository) Revoke(invite *Invite) error {
+	now := time.Now()
+	stmt := AuthInvite.UPDATE(AuthInvite.RevokedAt).
+		SET(TimestampzT(now)).
+		WHERE(AuthInvite.ID.EQ(Int(invite.ID)))
+
+	if _, err := stmt.Exec(r.db); err != nil {
+		return err
+	}
+	invite.RevokedAt = &now
+	return nil
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"auth/.gen/auth/public/model"
+	. "auth/.gen/auth/public/table"
+	"database/sql"
+	"sync"
+	"time"
+
+	. "github.com/go-jet/jet/v2/postgres"
+)
+
+const (
+	PermUserRead     string = "user:read"
+	PermUserStrike   string = "user:strike"
+	PermUserRestrict string = "user:restrict"
+	PermUserBan      string = "user:ban"
+	PermEventsRead   string = "events:read"
+	PermClientsWrite string = "clients:write"
+	PermRolesWrite   string = "roles:write"
+	PermInvitesWrite string = "invites:write"
+)
+
+// 全部权限，也是客户端可以申请的scope
+var AllPermissions = []string{
+	PermUserRead,
+	PermUserStrike,
+	PermUserRestrict,
+	PermUserBan,
+	PermEventsRead,
+	PermClientsWrite,
+	PermRolesWrite,
+	PermInvitesWrite,
+}
+
+type PermissionRepository interface {
+	ListByRole(role string) ([]string, error)
+}
+
+type cachedPermissions struct {
+	permissions []string
+	loadedAt    time.Time
+}
+
+type permissionRepository struct {
+	db    *sql.DB
+	mu    sync.Mutex
+	cache map[string]cachedPermissions
+}
+
+// 角色权限很少变化，缓存一段时间以免每个请求都查询数据库
+const permissionCacheTTL = time.Minute
+
+func NewPermissionRepository(db *sql.DB) PermissionRepository {
+	return &permissionRepository{
+		db:    db,
+		cache: make(map[string]cachedPermissions),
+	}
+}
+
+func (r *permissionRepository) ListByRole(role string) ([]string, error) {
+	r.mu.Lock()
+	cached, ok := r.cache[role]
+	r.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < permissionCacheTTL {
+		return cached.permissions, nil
+	}
+
+	stmt := SELECT(AuthRolePermission.Permission).
+		FROM(AuthRolePermission).
+		WHERE(AuthRolePermission.Role.EQ(String(role)))
+
+	var dest []model.AuthRolePermission
+	err := stmt.Query(r.db, &dest)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := make([]string, len(dest))
+	for i, row := range dest {
+		permissions[i] = row.Permission
+	}
+
+	r.mu.Lock()
+	r.cache[role] = cachedPermissions{permissions: permissions, loadedAt: time.Now()}
+	r.mu.Unlock()
+	return permissions, nil
+}
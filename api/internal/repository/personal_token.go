@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"auth/.gen/auth/public/model"
+	. "auth/.gen/auth/public/table"
+	"database/sql"
+	"strings"
+	"time"
+
+	. "github.com/go-jet/jet/v2/postgres"
+	"github.com/go-jet/jet/v2/qrm"
+)
+
+// 用户自行创建的长期令牌，只保存令牌的哈希
+type PersonalToken = model.AuthPersonalToken
+
+func PersonalTokenScopes(token *PersonalToken) []string {
+	return strings.Fields(token.Scopes)
+}
+
+type PersonalTokenRepository interface {
+	ListByUser(userId int64) ([]*PersonalToken, error)
+	FindById(id int64) (*PersonalToken, error)
+	FindByHash(tokenHash string) (*PersonalToken, error)
+	Save(token *PersonalToken) error
+	Revoke(token *PersonalToken) error
+	RevokeByUser(userId int64) error
+	UpdateLastUsed(token *PersonalToken) error
+}
+
+type personalTokenRepository struct {
+	db *sql.DB
+}
+
+func NewPersonalTokenRepository(db *sql.DB) PersonalTokenRepository {
+	return &personalTokenRepository{db: db}
+}
+
+func (r *personalTokenRepository) ListByUser(userId int64) ([]*PersonalToken, error) {
+	stmt := SELECT(AuthPersonalToken.AllColumns).
+		FROM(AuthPersonalToken).
+		WHERE(AuthPersonalToken.UserID.EQ(Int(userId))).
+		ORDER_BY(AuthPersonalToken.ID.DESC())
+
+	var dest []*PersonalToken
+	err := stmt.Query(r.db, &dest)
+	if err == qrm.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+func (r *personalTokenRepository) FindById(id int64) (*PersonalToken, error) {
+	stmt := SELECT(AuthPersonalToken.AllColumns).
+		FROM(AuthPersonalToken).
+		WHERE(AuthPersonalToken.ID.EQ(Int(id)))
+
+	var dest PersonalToken
+	err := stmt.Query(r.db, &dest)
+	if err == qrm.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &dest, nil
+}
+
+func (r *personalTokenRepository) FindByHash(tokenHash string) (*PersonalToken, error) {
+	stmt := SELECT(AuthPersonalToken.AllColumns).
+		FROM(AuthPersonalToken).
+		WHERE(AuthPersonalToken.TokenHash.EQ(String(tokenHash)))
+
+	var dest PersonalToken
+	err := stmt.Query(r.db, &dest)
+	if err == qrm.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &dest, nil
+}
+
+func (r *personalTokenRepository) Save(token *PersonalToken) error {
+	stmt := AuthPersonalToken.INSERT(AuthPersonalToken.MutableColumns).
+		MODEL(token).
+		RETURNING(AuthPersonalToken.AllColumns)
+
+	return stmt.Query(r.db, token)
+}
+
+func (r *personalTokenRepository) Revoke(token *PersonalToken) error {
+	now := time.Now()
+	stmt := AuthPersonalToken.UPDATE(AuthPersonalToken.RevokedAt).
+		SET(TimestampzT(now)).
+		WHERE(AuthPersonalToken.ID.EQ(Int(token.ID)))
+
+	if _, err := stmt.Exec(r.db); err != nil {
+		return err
+	}
+	token.RevokedAt = &now
+	return nil
+}
+
+// 撤销用户所有尚未撤销的令牌
+func (r *personalTokenRepository) RevokeByUser(userId int64) error {
+	stmt := AuthPersonalToken.UPDATE(AuthPersonalToken.RevokedAt).
+		SET(TimestampzT(time.Now())).
+		WHERE(
+			AuthPersonalToken.UserID.EQ(Int(userId)).
+				AND(AuthPersonalToken.RevokedAt.IS_NULL()),
+		)
+
+	_, err := stmt.Exec(r.db)
+	return err
+}
+
+func (r *personalTokenRepository) UpdateLastUsed(token *PersonalToken) error {
+	now := time.Now()
+	stmt := AuthPersonalToken.UPDATE(AuthPersonalToken.LastUsedAt).
+		SET(TimestampzT(now)).
+		WHERE(AuthPersonalToken.ID.EQ(Int(token.ID)))
+
+	if _, err := stmt.Exec(r.db); err != nil {
+		return err
+	}
+	token.LastUsedAt = &now
+	return nil
+}
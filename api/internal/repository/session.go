@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type SessionRepository interface {
+	RevokeUserSessions(userId int64) error
+	UserSessionsRevokedAt(userId int64) (time.Time, error)
+}
+
+// 与最长的令牌有效期一致，过期后旧令牌本身也已失效
+const sessionRevokedTTL = 100 * 24 * time.Hour
+
+type sessionRepository struct {
+	rdb *redis.Client
+}
+
+func NewSessionRepository(rdb *redis.Client) SessionRepository {
+	return &sessionRepository{
+		rdb: rdb,
+	}
+}
+
+func sessionRevokedKey(userId int64) string {
+	return fmt.Sprintf("session_revoked:%d", userId)
+}
+
+func (r *sessionRepository) RevokeUserSessions(userId int64) error {
+	err := r.rdb.Set(ctx, sessionRevokedKey(userId), time.Now().UnixMilli(), sessionRevokedTTL).Err()
+	if err != nil {
+		slog.Error("Failed to revoke sessions in Redis", "user_id", userId, "error", err)
+		return err
+	}
+	return nil
+}
+
+// 返回用户会话最近一次被撤销的时间，在此之前签发的令牌均无效
+func (r *sessionRepository) UserSessionsRevokedAt(userId int64) (time.Time, error) {
+	val, err := r.rdb.Get(ctx, sessionRevokedKey(userId)).Result()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	} else if err != nil {
+		slog.Error("Failed to get session revocation from Redis", "user_id", userId, "error", err)
+		return time.Time{}, err
+	}
+	milli, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// 早期以秒为单位保存
+	if milli < 1e12 {
+		return time.Unix(milli, 0), nil
+	}
+	return time.UnixMilli(milli), nil
+}
+
+// 令牌的签发时间只精确到秒，与撤销在同一秒内签发的令牌视为撤销之后签发，
+// 否则撤销后立即重新登录得到的令牌也会被拒绝
+func SessionRevoked(issuedAt time.Time, revokedAt time.Time) bool {
+	return issuedAt.Before(revokedAt.Truncate(time.Second))
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 第三方登录的授权请求和待完成的首次注册只在Redis中短暂保存
+const SocialStateTTL = 10 * time.Minute
+
+// 跳转到第三方授权页面时保存，回调时以state取回
+type SocialLogin struct {
+	Provider     string `json:"provider"`
+	App          string `json:"app"`
+	CodeVerifier string `json:"code_verifier"`
+	// 浏览器Cookie中随机值的哈希，回调时必须一致，防止state被用于其他浏览器
+	NonceHash string `json:"nonce_hash"`
+	// 不为0时表示将第三方账号绑定到该用户，而不是登录
+	LinkUserId int64 `json:"link_user_id,omitempty"`
+}
+
+// 第三方账号首次登录但无法自动注册时保存，由用户补充用户名或邮箱后完成注册
+type SocialSignup struct {
+	Provider string `json:"provider"`
+	App      string `json:"app"`
+	Subject  string `json:"subject"`
+	Username string `json:"username"`
+	// 第三方已验证的邮箱，为空时需要用户提供邮箱并通过验证码验证
+	Email string `json:"email"`
+}
+
+type SocialRepository interface {
+	SaveLogin(state string, login *SocialLogin) error
+	// 取回后即删除，同一个state只能使用一次
+	TakeLogin(state string) (*SocialLogin, error)
+	SaveSignup(ticket string, signup *SocialSignup) error
+	FindSignup(ticket string) (*SocialSignup, error)
+	DeleteSignup(ticket string) error
+}
+
+type socialRepository struct {
+	rdb *redis.Client
+}
+
+func NewSocialRepository(rdb *redis.Client) SocialRepository {
+	return &socialRepository{
+		rdb: rdb,
+	}
+}
+
+func socialLoginKey(state string) string {
+	return fmt.Sprintf("social_login:%s", state)
+}
+
+func socialSignupKey(ticket string) string {
+	return fmt.Sprintf("social_signup:%s", ticket)
+}
+
+func (r *socialRepository) set(key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if err := r.rdb.Set(ctx, key, data, SocialStateTTL).Err(); err != nil {
+		slog.Error("Failed to save social state in Redis", "error", err)
+		return err
+	}
+	return nil
+}
+
+func (r *socialRepository) SaveLogin(state string, login *SocialLogin) error {
+	return r.set(socialLoginKey(state), login)
+}
+
+func (r *socialRepository) TakeLogin(state string) (*SocialLogin, error) {
+	data, err := r.rdb.GetDel(ctx, socialLoginKey(state)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		slog.Error("Failed to get social login from Redis", "error", err)
+		return nil, err
+	}
+	var login SocialLogin
+	if err := json.Unmarshal(data, &login); err != nil {
+		return nil, err
+	}
+	return &login, nil
+}
+
+func (r *socialRepository) SaveSignup(ticket string, signup *SocialSignup) error {
+	return r.set(socialSignupKey(ticket), signup)
+}
+
+func (r *socialRepository) FindSignup(ticket string) (*SocialSignup, error) {
+	data, err := r.rdb.Get(ctx, socialSignupKey(ticket)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		slog.Error("Failed to get social signup from Redis", "error", err)
+		return nil, err
+	}
+	var signup SocialSignup
+	if err := json.Unmarshal(data, &signup); err != nil {
+		return nil, err
+	}
+	return &signup, nil
+}
+
+func (r *socialRepository) DeleteSignup(ticket string) error {
+	return r.rdb.Del(ctx, socialSignupKey(ticket)).Err()
+}
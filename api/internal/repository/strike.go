@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"auth/.gen/auth/public/model"
+	. "auth/.gen/auth/public/table"
+	"database/sql"
+	"time"
+
+	. "github.com/go-jet/jet/v2/postgres"
+	"github.com/go-jet/jet/v2/qrm"
+)
+
+type Strike = model.AuthStrike
+
+type StrikeRepository interface {
+	ListByUser(userId int64) ([]*Strike, error)
+	FindById(id int64) (*Strike, error)
+	CountActive(userId int64, since time.Time) (int64, error)
+	Save(strike *Strike) error
+	Retract(strike *Strike) error
+}
+
+type strikeRepository struct {
+	db *sql.DB
+}
+
+func NewStrikeRepository(db *sql.DB) StrikeRepository {
+	return &strikeRepository{db: db}
+}
+
+func (r *strikeRepository) ListByUser(userId int64) ([]*Strike, error) {
+	stmt := SELECT(AuthStrike.AllColumns).
+		FROM(AuthStrike).
+		WHERE(AuthStrike.UserID.EQ(Int(userId))).
+		ORDER_BY(AuthStrike.ID.DESC())
+
+	var dest []*Strike
+	err := stmt.Query(r.db, &dest)
+	if err == qrm.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+func (r *strikeRepository) FindById(id int64) (*Strike, error) {
+	stmt := SELECT(AuthStrike.AllColumns).
+		FROM(AuthStrike).
+		WHERE(AuthStrike.ID.EQ(Int(id)))
+
+	var dest Strike
+	err := stmt.Query(r.db, &dest)
+	if err == qrm.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &dest, nil
+}
+
+// 统计since之后且未被撤销的警告数量
+func (r *strikeRepository) CountActive(userId int64, since time.Time) (int64, error) {
+	stmt := SELECT(COUNT(STAR).AS("count")).
+		FROM(AuthStrike).
+		WHERE(
+			AuthStrike.UserID.EQ(Int(userId)).
+				AND(AuthStrike.CreatedAt.GT(TimestampzT(since))).
+				AND(AuthStrike.RetractedAt.IS_NULL()),
+		)
+
+	var dest struct {
+		Count int64
+	}
+	err := stmt.Query(r.db, &dest)
+	if err != nil {
+		return 0, err
+	}
+	return dest.Count, nil
+}
+
+func (r *strikeRepository) Save(strike *Strike) error {
+	stmt := AuthStrike.INSERT(AuthStrike.MutableColumns).
+		MODEL(strike).
+		RETURNING(AuthStrike.AllColumns)
+
+	return stmt.Query(r.db, strike)
+}
+
+func (r *strikeRepository) Retract(strike *Strike) error {
+	stmt := AuthStrike.UPDATE(AuthStrike.RetractedAt, AuthStrike.RetractedBy, AuthStrike.RetractReason).
+		MODEL(strike).
+		WHERE(AuthStrike.ID.EQ(Int(strike.ID)))
+
+	_, err := stmt.Exec(r.db)
+	return err
+}
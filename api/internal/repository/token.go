@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 被撤销的令牌按jti记录在Redis中，直到令牌本身过期
+type TokenRepository interface {
+	RevokeToken(jti string, expiresAt time.Time) error
+	IsTokenRevoked(jti string) (bool, error)
+}
+
+type tokenRepository struct {
+	rdb *redis.Client
+}
+
+func NewTokenRepository(rdb *redis.Client) TokenRepository {
+	return &tokenRepository{
+		rdb: rdb,
+	}
+}
+
+func tokenRevokedKey(jti string) string {
+	return fmt.Sprintf("token_revoked:%s", jti)
+}
+
+func (r *tokenRepository) RevokeToken(jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	err := r.rdb.Set(ctx, tokenRevokedKey(jti), time.Now().Unix(), ttl).Err()
+	if err != nil {
+		slog.Error("Failed to revoke token in Redis", "jti", jti, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (r *tokenRepository) IsTokenRevoked(jti string) (bool, error) {
+	n, err := r.rdb.Exists(ctx, tokenRevokedKey(jti)).Result()
+	if err != nil {
+		slog.Error("Failed to check token revocation in Redis", "jti", jti, "error", err)
+		return false, err
+	}
+	return n > 0, nil
+}
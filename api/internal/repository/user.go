@@ -4,6 +4,7 @@ import (
 	"auth/.gen/auth/public/model"
 	. "auth/.gen/auth/public/table"
 	"database/sql"
+	"strings"
 	"time"
 
 	. "github.com/go-jet/jet/v2/postgres"
@@ -12,6 +13,7 @@ import (
 
 const (
 	RoleAdmin      string = "admin"
+	RoleModerator  string = "moderator"
 	RoleTrusted    string = "trusted"
 	RoleMember     string = "member"
 	RoleRestricted string = "restricted"
@@ -21,20 +23,54 @@ const (
 type User = model.AuthUser
 
 type UserFilter struct {
-	Username      *string
-	Role          *string
-	CreatedAfter  *time.Time
-	CreatedBefore *time.Time
+	Username        *string // 用户名包含
+	UsernamePrefix  *string // 用户名前缀
+	Email           *string // 邮箱包含
+	Role            *string
+	CreatedAfter    *time.Time
+	CreatedBefore   *time.Time
+	LastLoginAfter  *time.Time
+	LastLoginBefore *time.Time
+}
+
+const (
+	UserSortId        string = "id"
+	UserSortUsername  string = "username"
+	UserSortCreatedAt string = "created_at"
+	UserSortLastLogin string = "last_login"
+)
+
+// 游标指向上一页的最后一个用户，排序字段相同时以id区分
+type UserCursor struct {
+	Id        int64
+	Username  string
+	CreatedAt time.Time
+	LastLogin time.Time
+}
+
+type UserPage struct {
+	SortBy string
+	Desc   bool
+	After  *UserCursor
+	Limit  int64
 }
 
 type UserRepository interface {
-	List(filter UserFilter, pageNumber, pageSize int64) ([]*User, error)
+	List(filter UserFilter, page UserPage) ([]*User, error)
+	Count(filter UserFilter) (int64, error)
+	FindById(id int64) (*User, error)
 	FindByUsername(username string) (*User, error)
 	FindByEmail(email string) (*User, error)
 	Save(user *User) error
+	// 在同一事务中创建用户并绑定外部身份，任一失败时都不会留下用户
+	SaveWithIdentity(user *User, identity *Identity) error
 	UpdateLastLogin(user *User) error
 	UpdateHashedPassword(user *User) error
 	UpdateRole(user *User) error
+	// 将管理员改为user.Role，是最后一个管理员时不修改并返回false
+	DemoteAdmin(user *User) (bool, error)
+	ListExpiredRoles(limit int64) ([]*User, error)
+	RestoreExpiredRole(user *User) (bool, error)
 }
 
 type userRepository struct {
@@ -45,27 +81,106 @@ func NewUserRepository(db *sql.DB) UserRepository {
 	return &userRepository{db: db}
 }
 
-func (r *userRepository) List(filter UserFilter, pageNumber int64, pageSize int64) ([]*User, error) {
-	stmt := SELECT(AuthUser.AllColumns).
-		FROM(AuthUser)
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func userCondition(filter UserFilter) BoolExpression {
+	condition := Bool(true)
 
 	if filter.Username != nil {
-		stmt = stmt.WHERE(AuthUser.Username.LIKE(String(*filter.Username)))
+		pattern := "%" + escapeLike(strings.ToLower(*filter.Username)) + "%"
+		condition = condition.AND(LOWER(AuthUser.Username).LIKE(String(pattern)))
+	}
+	if filter.UsernamePrefix != nil {
+		pattern := escapeLike(strings.ToLower(*filter.UsernamePrefix)) + "%"
+		condition = condition.AND(LOWER(AuthUser.Username).LIKE(String(pattern)))
+	}
+	if filter.Email != nil {
+		pattern := "%" + escapeLike(strings.ToLower(*filter.Email)) + "%"
+		condition = condition.AND(LOWER(AuthUser.Email).LIKE(String(pattern)))
 	}
 	if filter.Role != nil {
-		stmt = stmt.WHERE(AuthUser.Role.EQ(String(*filter.Role)))
+		condition = condition.AND(AuthUser.Role.EQ(String(*filter.Role)))
 	}
 	if filter.CreatedAfter != nil {
-		stmt = stmt.WHERE(AuthUser.CreatedAt.GT(TimestampzT(*filter.CreatedAfter)))
+		condition = condition.AND(AuthUser.CreatedAt.GT(TimestampzT(*filter.CreatedAfter)))
 	}
 	if filter.CreatedBefore != nil {
-		stmt = stmt.WHERE(AuthUser.CreatedAt.LT(TimestampzT(*filter.CreatedBefore)))
+		condition = condition.AND(AuthUser.CreatedAt.LT(TimestampzT(*filter.CreatedBefore)))
+	}
+	if filter.LastLoginAfter != nil {
+		condition = condition.AND(AuthUser.LastLogin.GT(TimestampzT(*filter.LastLoginAfter)))
+	}
+	if filter.LastLoginBefore != nil {
+		condition = condition.AND(AuthUser.LastLogin.LT(TimestampzT(*filter.LastLoginBefore)))
+	}
+	return condition
+}
+
+func userSortKey(sortBy string, cursor *UserCursor) (Column, Expression) {
+	var value Expression
+	switch sortBy {
+	case UserSortUsername:
+		if cursor != nil {
+			value = String(cursor.Username)
+		}
+		return AuthUser.Username, value
+	case UserSortCreatedAt:
+		if cursor != nil {
+			value = TimestampzT(cursor.CreatedAt)
+		}
+		return AuthUser.CreatedAt, value
+	case UserSortLastLogin:
+		if cursor != nil {
+			value = TimestampzT(cursor.LastLogin)
+		}
+		return AuthUser.LastLogin, value
+	default:
+		return nil, nil
+	}
+}
+
+func (r *userRepository) List(filter UserFilter, page UserPage) ([]*User, error) {
+	condition := userCondition(filter)
+
+	var orderBy []OrderByClause
+	column, value := userSortKey(page.SortBy, page.After)
+	if column != nil {
+		if page.After != nil {
+			lhs := ROW(column, AuthUser.ID)
+			rhs := ROW(value, Int(page.After.Id))
+			if page.Desc {
+				condition = condition.AND(lhs.LT(rhs))
+			} else {
+				condition = condition.AND(lhs.GT(rhs))
+			}
+		}
+		if page.Desc {
+			orderBy = append(orderBy, column.DESC(), AuthUser.ID.DESC())
+		} else {
+			orderBy = append(orderBy, column.ASC(), AuthUser.ID.ASC())
+		}
+	} else {
+		if page.After != nil {
+			if page.Desc {
+				condition = condition.AND(AuthUser.ID.LT(Int(page.After.Id)))
+			} else {
+				condition = condition.AND(AuthUser.ID.GT(Int(page.After.Id)))
+			}
+		}
+		if page.Desc {
+			orderBy = append(orderBy, AuthUser.ID.DESC())
+		} else {
+			orderBy = append(orderBy, AuthUser.ID.ASC())
+		}
 	}
 
-	stmt = stmt.
-		ORDER_BY(AuthUser.ID.ASC()).
-		LIMIT(pageSize).
-		OFFSET(pageNumber * pageSize)
+	stmt := SELECT(AuthUser.AllColumns).
+		FROM(AuthUser).
+		WHERE(condition).
+		ORDER_BY(orderBy...).
+		LIMIT(page.Limit)
 
 	var dest []*User
 	err := stmt.Query(r.db, &dest)
@@ -77,6 +192,36 @@ func (r *userRepository) List(filter UserFilter, pageNumber int64, pageSize int6
 	return dest, nil
 }
 
+func (r *userRepository) Count(filter UserFilter) (int64, error) {
+	stmt := SELECT(COUNT(STAR).AS("count")).
+		FROM(AuthUser).
+		WHERE(userCondition(filter))
+
+	var dest struct {
+		Count int64
+	}
+	err := stmt.Query(r.db, &dest)
+	if err != nil {
+		return 0, err
+	}
+	return dest.Count, nil
+}
+
+func (r *userRepository) FindById(id int64) (*User, error) {
+	stmt := SELECT(AuthUser.AllColumns).
+		FROM(AuthUser).
+		WHERE(AuthUser.ID.EQ(Int(id)))
+
+	var dest User
+	err := stmt.Query(r.db, &dest)
+	if err == qrm.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &dest, nil
+}
+
 func (r *userRepository) FindByUsername(username string) (*User, error) {
 	stmt := SELECT(AuthUser.AllColumns).
 		FROM(AuthUser).
@@ -109,10 +254,34 @@ func (r *userRepository) FindByEmail(email string) (*User, error) {
 
 func (r *userRepository) Save(user *User) error {
 	stmt := AuthUser.INSERT(AuthUser.MutableColumns).
-		MODEL(user)
+		MODEL(user).
+		RETURNING(AuthUser.AllColumns)
 
-	_, err := stmt.Exec(r.db)
-	return err
+	return stmt.Query(r.db, user)
+}
+
+func (r *userRepository) SaveWithIdentity(user *User, identity *Identity) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userStmt := AuthUser.INSERT(AuthUser.MutableColumns).
+		MODEL(user).
+		RETURNING(AuthUser.AllColumns)
+	if err := userStmt.Query(tx, user); err != nil {
+		return err
+	}
+
+	identity.UserID = user.ID
+	identityStmt := AuthIdentity.INSERT(AuthIdentity.MutableColumns).
+		MODEL(identity).
+		RETURNING(AuthIdentity.AllColumns)
+	if err := identityStmt.Query(tx, identity); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (r *userRepository) UpdateLastLogin(user *User) error {
@@ -134,10 +303,98 @@ func (r *userRepository) UpdateHashedPassword(user *User) error {
 }
 
 func (r *userRepository) UpdateRole(user *User) error {
-	stmt := AuthUser.UPDATE(AuthUser.Role).
-		SET(String(user.Role)).
+	stmt := AuthUser.UPDATE(AuthUser.Role, AuthUser.PreviousRole, AuthUser.RoleExpiresAt).
+		MODEL(user).
 		WHERE(AuthUser.ID.EQ(Int(user.ID)))
 
 	_, err := stmt.Exec(r.db)
 	return err
 }
+
+func (r *userRepository) DemoteAdmin(user *User) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// 锁定全部管理员，同时进行的降级操作依次执行，不会都看到两个管理员
+	var admins []struct {
+		ID int64
+	}
+	lockStmt := SELECT(AuthUser.ID).
+		FROM(AuthUser).
+		WHERE(AuthUser.Role.EQ(String(RoleAdmin))).
+		FOR(UPDATE())
+	if err := lockStmt.Query(tx, &admins); err != nil && err != qrm.ErrNoRows {
+		return false, err
+	}
+	if len(admins) <= 1 {
+		return false, nil
+	}
+
+	updateStmt := AuthUser.UPDATE(AuthUser.Role, AuthUser.PreviousRole, AuthUser.RoleExpiresAt).
+		MODEL(user).
+		WHERE(AuthUser.ID.EQ(Int(user.ID)).AND(AuthUser.Role.EQ(String(RoleAdmin))))
+	result, err := updateStmt.Exec(tx)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+	return true, tx.Commit()
+}
+
+func (r *userRepository) ListExpiredRoles(limit int64) ([]*User, error) {
+	stmt := SELECT(AuthUser.AllColumns).
+		FROM(AuthUser).
+		WHERE(AuthUser.RoleExpiresAt.LT_EQ(TimestampzT(time.Now()))).
+		ORDER_BY(AuthUser.RoleExpiresAt.ASC()).
+		LIMIT(limit)
+
+	var dest []*User
+	err := stmt.Query(r.db, &dest)
+	if err == qrm.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+// 将到期的临时角色恢复为之前的角色，返回是否由本次调用完成恢复
+func (r *userRepository) RestoreExpiredRole(user *User) (bool, error) {
+	if user.RoleExpiresAt == nil || user.PreviousRole == nil {
+		return false, nil
+	}
+
+	stmt := AuthUser.UPDATE(AuthUser.Role, AuthUser.PreviousRole, AuthUser.RoleExpiresAt).
+		SET(String(*user.PreviousRole), NULL, NULL).
+		WHERE(
+			AuthUser.ID.EQ(Int(user.ID)).
+				AND(AuthUser.Role.EQ(String(user.Role))).
+				AND(AuthUser.RoleExpiresAt.LT_EQ(TimestampzT(time.Now()))),
+		)
+
+	result, err := stmt.Exec(r.db)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	user.Role = *user.PreviousRole
+	user.PreviousRole = nil
+	user.RoleExpiresAt = nil
+	return true, nil
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 按固定时间窗口统计某个来源（如网段、邮箱）的请求次数
+type VelocityRepository interface {
+	Count(scope string, key string) (int64, error)
+	// 计数加一并返回当前窗口内的次数，窗口从第一次计数开始
+	Hit(scope string, key string, window time.Duration) (int64, error)
+}
+
+type velocityRepository struct {
+	rdb *redis.Client
+}
+
+func NewVelocityRepository(rdb *redis.Client) VelocityRepository {
+	return &velocityRepository{
+		rdb: rdb,
+	}
+}
+
+func velocityKey(scope string, key string) string {
+	return fmt.Sprintf("velocity:%s:%s", scope, key)
+}
+
+func (r *velocityRepository) Count(scope string, key string) (int64, error) {
+	count, err := r.rdb.Get(ctx, velocityKey(scope, key)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	} else if err != nil {
+		slog.Error("Failed to get velocity from Redis", "scope", scope, "error", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *velocityRepository) Hit(scope string, key string, window time.Duration) (int64, error) {
+	pipe := r.rdb.TxPipeline()
+	incr := pipe.Incr(ctx, velocityKey(scope, key))
+	pipe.ExpireNX(ctx, velocityKey(scope, key), window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Error("Failed to update velocity in Redis", "scope", scope, "error", err)
+		return 0, err
+	}
+	return incr.Val(), nil
+}
@@ -3,8 +3,17 @@ package service
 import (
 	"auth/internal/repository"
 	"auth/internal/util"
+	"auth/pkg/authclient"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -13,227 +22,801 @@ import (
 const (
 	EventRestrictUser string = "restrict-user"
 	EventBanUser      string = "ban-user"
-	EventStrikeUser   string = "strike-user"
+	EventRestoreUser  string = "restore-user"
+	EventRoleChange   string = "role_change"
 )
 
 type AdminService interface {
 	Use(chi.Router)
 	GetUser(http.ResponseWriter, *http.Request) error
+	ListEvents(http.ResponseWriter, *http.Request) error
 	RestrictUser(http.ResponseWriter, *http.Request) error
 	BanUser(http.ResponseWriter, *http.Request) error
+	RestoreUser(http.ResponseWriter, *http.Request) error
+	SetUserRole(http.ResponseWriter, *http.Request) error
 	StrikeUser(http.ResponseWriter, *http.Request) error
+	RetractStrike(http.ResponseWriter, *http.Request) error
+	ListStrikes(http.ResponseWriter, *http.Request) error
+	ListClients(http.ResponseWriter, *http.Request) error
+	CreateClient(http.ResponseWriter, *http.Request) error
+	DisableClient(http.ResponseWriter, *http.Request) error
+	ListInvites(http.ResponseWriter, *http.Request) error
+	CreateInvite(http.ResponseWriter, *http.Request) error
+	RevokeInvite(http.ResponseWriter, *http.Request) error
+	ExpireRoles() error
+	Ban(actorId int64, username string, reason string, expiresAt *time.Time) error
+	RegisterClient(actorId int64, clientId string, name string, scopes []string) (*repository.Client, string, error)
 }
 
 type adminService struct {
-	userRepo  repository.UserRepository
-	eventRepo repository.EventRepository
+	verifier     *authclient.Verifier
+	userRepo     repository.UserRepository
+	eventRepo    repository.EventRepository
+	sessionRepo  repository.SessionRepository
+	strikeRepo   repository.StrikeRepository
+	clientRepo   repository.ClientRepository
+	inviteRepo   repository.InviteRepository
+	strikePolicy StrikePolicy
 }
 
+// verifier需要加载角色权限，并限定允许访问管理接口的应用
 func NewAdminService(
+	verifier *authclient.Verifier,
 	userRepo repository.UserRepository,
 	eventRepo repository.EventRepository,
+	sessionRepo repository.SessionRepository,
+	strikeRepo repository.StrikeRepository,
+	clientRepo repository.ClientRepository,
+	inviteRepo repository.InviteRepository,
+	strikePolicy StrikePolicy,
 ) AdminService {
 	s := &adminService{
-		userRepo:  userRepo,
-		eventRepo: eventRepo,
+		verifier:     verifier,
+		userRepo:     userRepo,
+		eventRepo:    eventRepo,
+		sessionRepo:  sessionRepo,
+		strikeRepo:   strikeRepo,
+		clientRepo:   clientRepo,
+		inviteRepo:   inviteRepo,
+		strikePolicy: strikePolicy,
 	}
 	return s
 }
 
 func (s *adminService) Use(router chi.Router) {
-	router.Get("/user", util.EH(s.GetUser))
-	router.Post("/user/restrict", util.EH(s.RestrictUser))
-	router.Post("/user/ban", util.EH(s.BanUser))
-	router.Post("/user/strike", util.EH(s.StrikeUser))
+	require := func(permission string) func(http.Handler) http.Handler {
+		return s.verifier.Middleware(authclient.RequirePermission(permission))
+	}
+	// 处理函数使用按请求区分操作者的事件记录
+	handle := func(f func(*adminService, http.ResponseWriter, *http.Request) error) http.HandlerFunc {
+		return util.EH(func(w http.ResponseWriter, r *http.Request) error {
+			return f(s.forRequest(r), w, r)
+		})
+	}
+
+	router.With(require(repository.PermUserRead)).Get("/user", handle((*adminService).GetUser))
+	router.With(require(repository.PermEventsRead)).Get("/events", handle((*adminService).ListEvents))
+	router.With(require(repository.PermUserRestrict)).Post("/user/restrict", handle((*adminService).RestrictUser))
+	router.With(require(repository.PermUserBan)).Post("/user/ban", handle((*adminService).BanUser))
+	router.With(require(repository.PermUserRestrict)).Post("/user/restore", handle((*adminService).RestoreUser))
+	router.With(require(repository.PermRolesWrite)).Post("/user/role", handle((*adminService).SetUserRole))
+	router.With(require(repository.PermUserRead)).Get("/user/strikes", handle((*adminService).ListStrikes))
+	router.With(require(repository.PermUserStrike)).Post("/user/strike", handle((*adminService).StrikeUser))
+	router.With(require(repository.PermUserStrike)).Post("/user/strike/retract", handle((*adminService).RetractStrike))
+	router.With(require(repository.PermClientsWrite)).Get("/clients", handle((*adminService).ListClients))
+	router.With(require(repository.PermClientsWrite)).Post("/clients", handle((*adminService).CreateClient))
+	router.With(require(repository.PermClientsWrite)).Post("/clients/disable", handle((*adminService).DisableClient))
+	router.With(require(repository.PermInvitesWrite)).Get("/invites", handle((*adminService).ListInvites))
+	router.With(require(repository.PermInvitesWrite)).Post("/invites", handle((*adminService).CreateInvite))
+	router.With(require(repository.PermInvitesWrite)).Post("/invites/revoke", handle((*adminService).RevokeInvite))
+}
+
+// 机器令牌以系统用户的身份操作，事件中额外记录是哪个客户端
+func (s *adminService) forRequest(r *http.Request) *adminService {
+	principal := util.GetPrincipal(r)
+	if principal == nil || !principal.IsClient() {
+		return s
+	}
+	scoped := *s
+	scoped.eventRepo = repository.WithActorClient(s.eventRepo, principal.ClientId)
+	return &scoped
+}
+
+type UserView struct {
+	Id        int64     `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	LastLogin time.Time `json:"last_login"`
+}
+
+func newUserView(user *repository.User) UserView {
+	return UserView{
+		Id:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Role:      user.Role,
+		CreatedAt: user.CreatedAt,
+		LastLogin: user.LastLogin,
+	}
+}
+
+type userListCursor struct {
+	SortBy string                `json:"sort"`
+	Desc   bool                  `json:"desc"`
+	After  repository.UserCursor `json:"after"`
+}
+
+func encodeUserListCursor(cursor userListCursor) string {
+	b, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeUserListCursor(value string) (userListCursor, error) {
+	var cursor userListCursor
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(b, &cursor)
+	return cursor, err
 }
 
 func (s *adminService) GetUser(w http.ResponseWriter, r *http.Request) error {
-	_, err := util.VerifyAccessToken(r, true)
+	filter := repository.UserFilter{
+		Username:       util.QueryString(r, "username"),
+		UsernamePrefix: util.QueryString(r, "username_prefix"),
+		Email:          util.QueryString(r, "email"),
+		Role:           util.QueryString(r, "role"),
+	}
+	var err error
+	if filter.CreatedAfter, err = util.QueryTime(r, "created_after"); err != nil {
+		return err
+	}
+	if filter.CreatedBefore, err = util.QueryTime(r, "created_before"); err != nil {
+		return err
+	}
+	if filter.LastLoginAfter, err = util.QueryTime(r, "last_login_after"); err != nil {
+		return err
+	}
+	if filter.LastLoginBefore, err = util.QueryTime(r, "last_login_before"); err != nil {
+		return err
+	}
+
+	page := repository.UserPage{
+		SortBy: r.URL.Query().Get("sort"),
+		Desc:   r.URL.Query().Get("order") == "desc",
+	}
+	switch page.SortBy {
+	case "":
+		page.SortBy = repository.UserSortId
+	case repository.UserSortId,
+		repository.UserSortUsername,
+		repository.UserSortCreatedAt,
+		repository.UserSortLastLogin:
+	default:
+		return util.BadRequest(util.CodeSortFieldInvalid)
+	}
+	if order := r.URL.Query().Get("order"); order != "" && order != "asc" && order != "desc" {
+		return util.BadRequest(util.CodeSortOrderInvalid)
+	}
+
+	limit, err := util.QueryInt(r, "limit", 20, 1, 100)
 	if err != nil {
-		slog.Error("Access token verification failed", "error", err)
 		return err
 	}
-	users, err := s.userRepo.List(repository.UserFilter{}, 0, 10)
+	// 多取一条用于判断是否还有下一页
+	page.Limit = limit + 1
+
+	if value := r.URL.Query().Get("cursor"); value != "" {
+		cursor, err := decodeUserListCursor(value)
+		if err != nil || cursor.SortBy != page.SortBy || cursor.Desc != page.Desc {
+			return util.BadRequest(util.CodeCursorInvalid)
+		}
+		page.After = &cursor.After
+	}
+
+	users, err := s.userRepo.List(filter, page)
 	if err != nil {
 		slog.Error("Failed to list users", "error", err)
+		return util.InternalServerError(util.CodeUserQueryFailed)
+	}
+	total, err := s.userRepo.Count(filter)
+	if err != nil {
+		slog.Error("Failed to count users", "error", err)
+		return util.InternalServerError(util.CodeUserQueryFailed)
+	}
+
+	response := struct {
+		Items      []UserView `json:"items"`
+		Total      int64      `json:"total"`
+		NextCursor string     `json:"next_cursor,omitempty"`
+	}{
+		Items: make([]UserView, 0, len(users)),
+		Total: total,
+	}
+	if int64(len(users)) > limit {
+		users = users[:limit]
+		last := users[len(users)-1]
+		response.NextCursor = encodeUserListCursor(userListCursor{
+			SortBy: page.SortBy,
+			Desc:   page.Desc,
+			After: repository.UserCursor{
+				Id:        last.ID,
+				Username:  last.Username,
+				CreatedAt: last.CreatedAt,
+				LastLogin: last.LastLogin,
+			},
+		})
+	}
+	for _, user := range users {
+		response.Items = append(response.Items, newUserView(user))
+	}
+	return util.RespondJson(w, response)
+}
+
+type EventView struct {
+	Id        int64           `json:"id"`
+	Action    string          `json:"action"`
+	Detail    json.RawMessage `json:"detail"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+func (s *adminService) ListEvents(w http.ResponseWriter, r *http.Request) error {
+	filter := repository.EventFilter{
+		Action: r.URL.Query().Get("action"),
+		Ip:     r.URL.Query().Get("ip"),
+	}
+	var err error
+	if filter.ActorUser, err = util.QueryOptionalInt(r, "actor", 0, math.MaxInt64); err != nil {
+		return err
+	}
+	if filter.TargetUser, err = util.QueryOptionalInt(r, "target", 0, math.MaxInt64); err != nil {
+		return err
+	}
+	if t, err := util.QueryTime(r, "created_after"); err != nil {
 		return err
+	} else if t != nil {
+		filter.CreatedAfter = *t
 	}
-	return util.RespondJson(w, users)
+	if t, err := util.QueryTime(r, "created_before"); err != nil {
+		return err
+	} else if t != nil {
+		filter.CreatedBefore = *t
+	}
+
+	beforeId, err := util.QueryInt(r, "before", 0, 1, math.MaxInt64)
+	if err != nil {
+		return err
+	}
+	limit, err := util.QueryInt(r, "limit", 50, 1, 1000)
+	if err != nil {
+		return err
+	}
+
+	// 多取一条用于判断是否还有下一页
+	events, err := s.eventRepo.List(filter, beforeId, limit+1)
+	if err != nil {
+		slog.Error("Failed to list events", "error", err)
+		return util.InternalServerError(util.CodeEventQueryFailed)
+	}
+	hasMore := int64(len(events)) > limit
+	if hasMore {
+		events = events[:limit]
+	}
+
+	if r.URL.Query().Get("format") == "csv" ||
+		strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		records := [][]string{{"id", "action", "actor_user", "target_user", "ip", "created_at", "detail"}}
+		for _, event := range events {
+			var detail struct {
+				ActorUser  json.Number `json:"actor_user"`
+				TargetUser json.Number `json:"target_user"`
+				Ip         string      `json:"ip"`
+			}
+			json.Unmarshal([]byte(event.Detail), &detail)
+			records = append(records, []string{
+				strconv.FormatInt(event.ID, 10),
+				event.Action,
+				detail.ActorUser.String(),
+				detail.TargetUser.String(),
+				detail.Ip,
+				event.CreatedAt.Format(time.RFC3339),
+				event.Detail,
+			})
+		}
+		return util.RespondCsv(w, "events.csv", records)
+	}
+
+	response := struct {
+		Items      []EventView `json:"items"`
+		NextBefore int64       `json:"next_before,omitempty"`
+	}{
+		Items: make([]EventView, 0, len(events)),
+	}
+	for _, event := range events {
+		response.Items = append(response.Items, EventView{
+			Id:        event.ID,
+			Action:    event.Action,
+			Detail:    json.RawMessage(event.Detail),
+			CreatedAt: event.CreatedAt,
+		})
+	}
+	if hasMore {
+		response.NextBefore = events[len(events)-1].ID
+	}
+	return util.RespondJson(w, response)
+}
+
+// 管理操作允许的角色变更，管理员不参与其中
+// 限制和封禁可以再次执行，用于延长、缩短处罚或改为永久
+var roleTransitions = map[string][]string{
+	repository.RoleMember:     {repository.RoleRestricted, repository.RoleBanned},
+	repository.RoleTrusted:    {repository.RoleRestricted, repository.RoleBanned},
+	repository.RoleRestricted: {repository.RoleMember, repository.RoleTrusted, repository.RoleRestricted, repository.RoleBanned},
+	repository.RoleBanned:     {repository.RoleMember, repository.RoleTrusted, repository.RoleRestricted, repository.RoleBanned},
+}
+
+func canTransitionRole(from, to string) bool {
+	return slices.Contains(roleTransitions[from], to)
+}
+
+type roleChangeDetail struct {
+	ActorUser  int64      `json:"actor_user"`
+	TargetUser int64      `json:"target_user"`
+	FromRole   string     `json:"from_role"`
+	ToRole     string     `json:"to_role"`
+	Reason     string     `json:"reason"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Reverts    int64      `json:"reverts,omitempty"`
+}
+
+// 时长为空表示永久生效
+func parseExpiresAt(duration string) (*time.Time, error) {
+	if duration == "" {
+		return nil, nil
+	}
+	d, err := util.ParseDuration(duration)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(d)
+	return &expiresAt, nil
+}
+
+func (s *adminService) findTargetUser(username string) (*repository.User, error) {
+	user, err := s.userRepo.FindByUsername(username)
+	if err != nil {
+		slog.Error("User lookup failed", "username", username, "error", err)
+		return nil, util.InternalServerError(util.CodeUserQueryFailed)
+	}
+	if user == nil {
+		slog.Error("User not found", "username", username)
+		return nil, util.NotFound(util.CodeUserNotFound)
+	}
+	return user, nil
+}
+
+func (s *adminService) changeRole(
+	action string,
+	actorId int64,
+	user *repository.User,
+	role string,
+	reason string,
+	expiresAt *time.Time,
+	reverts int64,
+) error {
+	if !canTransitionRole(user.Role, role) {
+		slog.Error("Invalid role transition", "user_id", user.ID, "from", user.Role, "to", role)
+		return util.Conflict(util.CodeRoleTransitionInvalid, user.Role, role)
+	}
+
+	// 同一处罚只能修改到期时间，两次都是永久时没有变化
+	if user.Role == role && user.RoleExpiresAt == nil && expiresAt == nil {
+		return util.Conflict(util.CodeRoleUnchanged)
+	}
+
+	fromRole := user.Role
+	if expiresAt == nil {
+		user.PreviousRole = nil
+	} else if user.RoleExpiresAt == nil || user.PreviousRole == nil {
+		// 已处于临时处罚中时保留最初的角色，到期后直接恢复
+		previousRole := fromRole
+		// 永久处罚改为临时时已没有最初的角色，到期后恢复为普通成员
+		if fromRole == role {
+			previousRole = repository.RoleMember
+		}
+		user.PreviousRole = &previousRole
+	}
+	user.Role = role
+	user.RoleExpiresAt = expiresAt
+	err := s.userRepo.UpdateRole(user)
+	if err != nil {
+		slog.Error("Failed to update user role", "user_id", user.ID, "error", err)
+		return util.InternalServerError(util.CodeRoleUpdateFailed)
+	}
+
+	s.eventRepo.Save(
+		action,
+		&roleChangeDetail{
+			ActorUser:  actorId,
+			TargetUser: user.ID,
+			FromRole:   fromRole,
+			ToRole:     role,
+			Reason:     reason,
+			ExpiresAt:  expiresAt,
+			Reverts:    reverts,
+		},
+	)
+	return nil
 }
 
 func (s *adminService) RestrictUser(w http.ResponseWriter, r *http.Request) error {
-	adminUsername, err := util.VerifyAccessToken(r, true)
+	principal := util.GetPrincipal(r)
+
+	req, err := util.Body[struct {
+		Username string `json:"username" validate:"required"`
+		Reason   string `json:"reason" validate:"required"`
+		Duration string `json:"duration"`
+	}](r)
+	if err != nil {
+		slog.Error("Request body parse error", "error", err)
+		return err
+	}
+	expiresAt, err := parseExpiresAt(req.Duration)
 	if err != nil {
-		slog.Error("Access token verification failed", "error", err)
 		return err
 	}
 
+	user, err := s.findTargetUser(req.Username)
+	if err != nil {
+		return err
+	}
+	// 封禁改为限制相当于部分解除封禁，需要与封禁相同的权限
+	if user.Role == repository.RoleBanned && !principal.HasPermission(repository.PermUserBan) {
+		slog.Error("Ban permission required to restrict banned user", "user_id", user.ID)
+		return util.Forbidden(util.CodePermissionDenied)
+	}
+	return s.changeRole(EventRestrictUser, principal.UserId, user, repository.RoleRestricted, req.Reason, expiresAt, 0)
+}
+
+func (s *adminService) BanUser(w http.ResponseWriter, r *http.Request) error {
+	adminId := util.GetPrincipal(r).UserId
+
 	req, err := util.Body[struct {
 		Username string `json:"username" validate:"required"`
 		Reason   string `json:"reason" validate:"required"`
+		Duration string `json:"duration"`
 	}](r)
 	if err != nil {
 		slog.Error("Request body parse error", "error", err)
 		return err
 	}
+	expiresAt, err := parseExpiresAt(req.Duration)
+	if err != nil {
+		return err
+	}
+
+	return s.Ban(adminId, req.Username, req.Reason, expiresAt)
+}
 
-	user, err := s.userRepo.FindByUsername(req.Username)
+func (s *adminService) Ban(actorId int64, username string, reason string, expiresAt *time.Time) error {
+	user, err := s.findTargetUser(username)
 	if err != nil {
-		slog.Error("User lookup failed", "username", req.Username, "error", err)
-		return util.NotFound("用户不存在")
+		return err
 	}
-	if user.Role != repository.RoleMember {
-		slog.Error("Unauthorized role change attempt", "username", req.Username, "current_role", user.Role)
-		return util.Unauthorized("没有权限对非普通用户进行操作")
+	return s.banUser(actorId, user, reason, expiresAt)
+}
+
+func (s *adminService) banUser(actorId int64, user *repository.User, reason string, expiresAt *time.Time) error {
+	err := s.changeRole(EventBanUser, actorId, user, repository.RoleBanned, reason, expiresAt, 0)
+	if err != nil {
+		return err
+	}
+
+	// 立即使已签发的刷新令牌失效
+	if err := s.sessionRepo.RevokeUserSessions(user.ID); err != nil {
+		return util.InternalServerError(util.CodeSessionRevokeFailed)
 	}
+	return nil
+}
+
+func (s *adminService) RestoreUser(w http.ResponseWriter, r *http.Request) error {
+	adminId := util.GetPrincipal(r).UserId
 
-	user.Role = repository.RoleRestricted
-	err = s.userRepo.UpdateRole(user)
+	req, err := util.Body[struct {
+		Username string `json:"username" validate:"required"`
+		Role     string `json:"role" validate:"omitempty,oneof=member trusted restricted"`
+		Reason   string `json:"reason" validate:"required"`
+	}](r)
 	if err != nil {
-		slog.Error("Failed to update user role", "username", user.Username, "error", err)
-		return util.InternalServerError("更新用户角色失败")
+		slog.Error("Request body parse error", "error", err)
+		return err
+	}
+	if req.Role == "" {
+		req.Role = repository.RoleMember
+	}
+
+	user, err := s.findTargetUser(req.Username)
+	if err != nil {
+		return err
+	}
+
+	var revertedAction string
+	switch user.Role {
+	case repository.RoleRestricted:
+		revertedAction = EventRestrictUser
+	case repository.RoleBanned:
+		// 解除封禁需要与封禁相同的权限
+		if !util.GetPrincipal(r).HasPermission(repository.PermUserBan) {
+			return util.Forbidden(util.CodePermissionDenied)
+		}
+		revertedAction = EventBanUser
+	default:
+		slog.Error("User is not restricted or banned", "user_id", user.ID, "role", user.Role)
+		return util.Conflict(util.CodeUserNotSanctioned)
+	}
+
+	// 关联被撤销的处罚事件，方便按时间线查看处理记录
+	var reverts int64
+	events, err := s.eventRepo.List(repository.EventFilter{
+		TargetUser: &user.ID,
+		Action:     revertedAction,
+	}, 0, 1)
+	if err != nil {
+		slog.Error("Failed to find reverted event", "user_id", user.ID, "error", err)
+	} else if len(events) > 0 {
+		reverts = events[0].ID
+	}
+
+	return s.changeRole(EventRestoreUser, adminId, user, req.Role, req.Reason, nil, reverts)
+}
+
+func (s *adminService) SetUserRole(w http.ResponseWriter, r *http.Request) error {
+	principal := util.GetPrincipal(r)
+
+	req, err := util.Body[struct {
+		Username string `json:"username" validate:"required"`
+		Role     string `json:"role" validate:"required,oneof=admin moderator trusted member"`
+		Reason   string `json:"reason" validate:"required"`
+	}](r)
+	if err != nil {
+		slog.Error("Request body parse error", "error", err)
+		return err
+	}
+
+	user, err := s.findTargetUser(req.Username)
+	if err != nil {
+		return err
+	}
+	if user.ID == principal.UserId {
+		return util.Forbidden(util.CodeRoleSelfChange)
+	}
+	if user.Role == req.Role {
+		return util.Conflict(util.CodeRoleUnchanged)
+	}
+	// 解除处罚需要通过RestoreUser，以便检查封禁权限并关联被撤销的处罚
+	if user.Role == repository.RoleBanned || user.Role == repository.RoleRestricted {
+		slog.Error("Role change of sanctioned user", "user_id", user.ID, "role", user.Role)
+		return util.Conflict(util.CodeRoleSanctioned)
+	}
+	if (user.Role == repository.RoleAdmin || req.Role == repository.RoleAdmin) &&
+		principal.Role != repository.RoleAdmin {
+		return util.Forbidden(util.CodeRoleAdminRequired)
+	}
+
+	fromRole := user.Role
+	user.Role = req.Role
+	user.PreviousRole = nil
+	user.RoleExpiresAt = nil
+	if fromRole == repository.RoleAdmin {
+		// 统计和修改在同一事务中完成，避免两个管理员同时互相降级
+		demoted, err := s.userRepo.DemoteAdmin(user)
+		if err != nil {
+			slog.Error("Failed to demote admin", "user_id", user.ID, "error", err)
+			return util.InternalServerError(util.CodeRoleUpdateFailed)
+		}
+		if !demoted {
+			return util.Conflict(util.CodeRoleLastAdmin)
+		}
+	} else if err := s.userRepo.UpdateRole(user); err != nil {
+		slog.Error("Failed to update user role", "user_id", user.ID, "error", err)
+		return util.InternalServerError(util.CodeRoleUpdateFailed)
+	}
+
+	// 已签发的令牌中仍是旧角色，需要重新登录
+	if err := s.sessionRepo.RevokeUserSessions(user.ID); err != nil {
+		return util.InternalServerError(util.CodeSessionRevokeFailed)
 	}
 
 	s.eventRepo.Save(
-		EventRestrictUser,
-		&struct {
-			ActorUser  string `json:"actor_user"`
-			TargetUser string `json:"target_user"`
-			Reason     string `json:"reason"`
-		}{
-			ActorUser:  adminUsername,
-			TargetUser: user.Username,
+		EventRoleChange,
+		&roleChangeDetail{
+			ActorUser:  principal.UserId,
+			TargetUser: user.ID,
+			FromRole:   fromRole,
+			ToRole:     user.Role,
 			Reason:     req.Reason,
 		},
 	)
 
-	return nil
+	return util.RespondJson(w, newUserView(user))
 }
 
-func (s *adminService) BanUser(w http.ResponseWriter, r *http.Request) error {
-	adminUsername, err := util.VerifyAccessToken(r, true)
-	if err != nil {
-		slog.Error("Access token verification failed", "error", err)
-		return err
-	}
+func (s *adminService) StrikeUser(w http.ResponseWriter, r *http.Request) error {
+	principal := util.GetPrincipal(r)
+	adminId := principal.UserId
 
 	req, err := util.Body[struct {
 		Username string `json:"username" validate:"required"`
 		Reason   string `json:"reason" validate:"required"`
+		Evidence string `json:"evidence" validate:"required"`
 	}](r)
 	if err != nil {
 		slog.Error("Request body parse error", "error", err)
 		return err
 	}
 
-	user, err := s.userRepo.FindByUsername(req.Username)
+	user, err := s.findTargetUser(req.Username)
 	if err != nil {
-		slog.Error("User lookup failed", "username", req.Username, "error", err)
-		return util.NotFound("用户不存在")
+		return err
 	}
-	if user.Role != repository.RoleMember {
-		slog.Error("Unauthorized role change attempt", "username", req.Username, "current_role", user.Role)
-		return util.Unauthorized("没有权限对非普通用户进行操作")
+	switch user.Role {
+	case repository.RoleMember, repository.RoleTrusted, repository.RoleRestricted:
+	default:
+		slog.Error("Strike not allowed", "user_id", user.ID, "role", user.Role)
+		return util.Conflict(util.CodeStrikeNotAllowed)
 	}
 
-	user.Role = repository.RoleBanned
-	err = s.userRepo.UpdateRole(user)
+	strike := &repository.Strike{
+		UserID:    user.ID,
+		ActorUser: adminId,
+		Reason:    req.Reason,
+		Evidence:  req.Evidence,
+		CreatedAt: time.Now(),
+	}
+	err = s.strikeRepo.Save(strike)
 	if err != nil {
-		slog.Error("Failed to update user role", "username", user.Username, "error", err)
-		return util.InternalServerError("更新用户角色失败")
+		slog.Error("Failed to save strike", "user_id", user.ID, "error", err)
+		return util.InternalServerError(util.CodeStrikeSaveFailed)
 	}
 
 	s.eventRepo.Save(
-		EventBanUser,
+		EventStrikeUser,
 		&struct {
-			ActorUser  string `json:"actor_user"`
-			TargetUser string `json:"target_user"`
+			ActorUser  int64  `json:"actor_user"`
+			TargetUser int64  `json:"target_user"`
+			StrikeId   int64  `json:"strike_id"`
 			Reason     string `json:"reason"`
+			Evidence   string `json:"evidence"`
 		}{
-			ActorUser:  adminUsername,
-			TargetUser: user.Username,
+			ActorUser:  adminId,
+			TargetUser: user.ID,
+			StrikeId:   strike.ID,
 			Reason:     req.Reason,
+			Evidence:   req.Evidence,
 		},
 	)
 
-	return nil
-}
+	activeStrikes, err := s.strikeRepo.CountActive(user.ID, time.Now().Add(-s.strikePolicy.Period))
+	if err != nil {
+		slog.Error("Failed to count active strikes", "user_id", user.ID, "error", err)
+		return util.InternalServerError(util.CodeStrikeCountFailed)
+	}
 
-func (s *adminService) StrikeUser(w http.ResponseWriter, r *http.Request) error {
-	adminUsername, err := util.VerifyAccessToken(r, true)
+	// 逐级处罚：先限制，再临时封禁
+	// 没有封禁权限的操作者（如版主）最多将用户限制，封禁留给有权限的管理员
+	reason := fmt.Sprintf("有效警告累计%d次", activeStrikes)
+	canBan := principal.HasPermission(repository.PermUserBan)
+	if activeStrikes >= s.strikePolicy.BanThreshold && user.Role != repository.RoleBanned && canBan {
+		expiresAt := time.Now().Add(s.strikePolicy.BanDuration)
+		err = s.banUser(adminId, user, reason, &expiresAt)
+	} else if activeStrikes >= s.strikePolicy.RestrictThreshold && user.Role != repository.RoleRestricted {
+		err = s.changeRole(EventRestrictUser, adminId, user, repository.RoleRestricted, reason, nil, 0)
+	}
 	if err != nil {
-		slog.Error("Access token verification failed", "error", err)
 		return err
 	}
 
+	return util.RespondJson(w, newStrikeView(strike, s.strikePolicy))
+}
+
+func (s *adminService) RetractStrike(w http.ResponseWriter, r *http.Request) error {
+	adminId := util.GetPrincipal(r).UserId
+
 	req, err := util.Body[struct {
-		Username string `json:"username" validate:"required"`
-		Reason   string `json:"reason" validate:"required"`
-		Evidence string `json:"evidence" validate:"required"`
+		Id     int64  `json:"id" validate:"required"`
+		Reason string `json:"reason" validate:"required"`
 	}](r)
 	if err != nil {
 		slog.Error("Request body parse error", "error", err)
 		return err
 	}
 
-	user, err := s.userRepo.FindByUsername(req.Username)
+	strike, err := s.strikeRepo.FindById(req.Id)
 	if err != nil {
-		slog.Error("User lookup failed", "username", req.Username, "error", err)
-		return util.NotFound("用户不存在")
+		slog.Error("Strike lookup failed", "strike_id", req.Id, "error", err)
+		return util.InternalServerError(util.CodeStrikeQueryFailed)
+	}
+	if strike == nil {
+		return util.NotFound(util.CodeStrikeNotFound)
 	}
-	if user.Role != repository.RoleMember {
-		slog.Error("Unauthorized role change attempt", "username", req.Username, "current_role", user.Role)
-		return util.Unauthorized("没有权限对非普通用户进行操作")
+	if strike.RetractedAt != nil {
+		return util.Conflict(util.CodeStrikeAlreadyRetracted)
+	}
+
+	now := time.Now()
+	strike.RetractedAt = &now
+	strike.RetractedBy = &adminId
+	strike.RetractReason = &req.Reason
+	err = s.strikeRepo.Retract(strike)
+	if err != nil {
+		slog.Error("Failed to retract strike", "strike_id", strike.ID, "error", err)
+		return util.InternalServerError(util.CodeStrikeRetractFailed)
 	}
 
 	s.eventRepo.Save(
-		EventRestrictUser,
+		EventRetractStrike,
 		&struct {
-			ActorUser  string `json:"actor_user"`
-			TargetUser string `json:"target_user"`
+			ActorUser  int64  `json:"actor_user"`
+			TargetUser int64  `json:"target_user"`
+			StrikeId   int64  `json:"strike_id"`
 			Reason     string `json:"reason"`
-			Evidence   string `json:"evidence"`
 		}{
-			ActorUser:  adminUsername,
-			TargetUser: user.Username,
+			ActorUser:  adminId,
+			TargetUser: strike.UserID,
+			StrikeId:   strike.ID,
 			Reason:     req.Reason,
-			Evidence:   req.Evidence,
 		},
 	)
 
-	const StrikePeriod = 100 * 24 * time.Hour // 100 days
-	const MaxStrikes = 3
-	recentStrikes, err := s.eventRepo.List(repository.EventFilter{
-		TargetUser:   req.Username,
-		Action:       EventRestrictUser,
-		CreatedAfter: time.Now().Add(-StrikePeriod),
-	}, 0, 3)
+	return util.RespondJson(w, newStrikeView(strike, s.strikePolicy))
+}
+
+func (s *adminService) ListStrikes(w http.ResponseWriter, r *http.Request) error {
+	user, err := s.findTargetUser(r.URL.Query().Get("username"))
 	if err != nil {
-		slog.Error("Failed to list recent strikes", "username", req.Username, "error", err)
-		return util.InternalServerError("查询用户违规记录失败")
+		return err
 	}
 
-	if len(recentStrikes) >= MaxStrikes {
-		user.Role = repository.RoleRestricted
-		err = s.userRepo.UpdateRole(user)
-		if err != nil {
-			slog.Error("Failed to update user role", "username", user.Username, "error", err)
-			return util.InternalServerError("更新用户角色失败")
-		}
+	strikes, err := s.strikeRepo.ListByUser(user.ID)
+	if err != nil {
+		slog.Error("Failed to list strikes", "user_id", user.ID, "error", err)
+		return util.InternalServerError(util.CodeStrikeQueryFailed)
+	}
 
-		s.eventRepo.Save(
-			EventRestrictUser,
-			&struct {
-				ActorUser  string `json:"actor_user"`
-				TargetUser string `json:"target_user"`
-				Reason     string `json:"reason"`
-			}{
-				ActorUser:  adminUsername,
-				TargetUser: user.Username,
-				Reason:     "三振出局",
-			},
-		)
+	type adminStrikeView struct {
+		StrikeView
+		ActorUser     int64   `json:"actor_user"`
+		RetractedBy   *int64  `json:"retracted_by,omitempty"`
+		RetractReason *string `json:"retract_reason,omitempty"`
+	}
+	views := make([]adminStrikeView, 0, len(strikes))
+	for _, strike := range strikes {
+		views = append(views, adminStrikeView{
+			StrikeView:    newStrikeView(strike, s.strikePolicy),
+			ActorUser:     strike.ActorUser,
+			RetractedBy:   strike.RetractedBy,
+			RetractReason: strike.RetractReason,
+		})
 	}
+	return util.RespondJson(w, views)
+}
 
-	return nil
+// 由后台定时调用，每次最多处理一批到期用户
+func (s *adminService) ExpireRoles() error {
+	users, err := s.userRepo.ListExpiredRoles(100)
+	if err != nil {
+		slog.Error("Failed to list expired roles", "error", err)
+		return err
+	}
+	// 单个用户失败时继续处理其余用户，下一轮会重试失败的用户
+	var errs []error
+	for _, user := range users {
+		if err := restoreExpiredRole(s.userRepo, s.eventRepo, user); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,509 @@
+package service
+
+import (
+	"auth/internal/repository"
+	"auth/internal/util"
+	"auth/pkg/authclient"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memoryUserRepository map[int64]*repository.User
+
+func (r memoryUserRepository) add(username string, role string) *repository.User {
+	now := time.Now()
+	user := &repository.User{
+		ID:        int64(len(r) + 1),
+		Username:  username,
+		Email:     username + "@example.com",
+		Role:      role,
+		CreatedAt: now.Add(-time.Duration(len(r)) * time.Hour),
+		LastLogin: now,
+		Attr:      "{}",
+	}
+	r[user.ID] = user
+	return user
+}
+
+func compareUsers(a, b *repository.User, sortBy string) int {
+	var c int
+	switch sortBy {
+	case repository.UserSortUsername:
+		c = strings.Compare(a.Username, b.Username)
+	case repository.UserSortCreatedAt:
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	case repository.UserSortLastLogin:
+		c = a.LastLogin.Compare(b.LastLogin)
+	}
+	return cmp.Or(c, cmp.Compare(a.ID, b.ID))
+}
+
+func (r memoryUserRepository) List(filter repository.UserFilter, page repository.UserPage) ([]*repository.User, error) {
+	var users []*repository.User
+	for _, user := range r {
+		if filter.Role == nil || user.Role == *filter.Role {
+			users = append(users, user)
+		}
+	}
+	slices.SortFunc(users, func(a, b *repository.User) int {
+		if page.Desc {
+			return compareUsers(b, a, page.SortBy)
+		}
+		return compareUsers(a, b, page.SortBy)
+	})
+	if page.After != nil {
+		after := &repository.User{
+			ID:        page.After.Id,
+			Username:  page.After.Username,
+			CreatedAt: page.After.CreatedAt,
+			LastLogin: page.After.LastLogin,
+		}
+		users = slices.DeleteFunc(users, func(user *repository.User) bool {
+			c := compareUsers(user, after, page.SortBy)
+			return (!page.Desc && c <= 0) || (page.Desc && c >= 0)
+		})
+	}
+	if int64(len(users)) > page.Limit {
+		users = users[:page.Limit]
+	}
+	return users, nil
+}
+
+func (r memoryUserRepository) Count(filter repository.UserFilter) (int64, error) {
+	users, _ := r.List(filter, repository.UserPage{Limit: int64(len(r))})
+	return int64(len(users)), nil
+}
+
+func (r memoryUserRepository) FindById(id int64) (*repository.User, error) {
+	return r[id], nil
+}
+
+func (r memoryUserRepository) FindByUsername(username string) (*repository.User, error) {
+	for _, user := range r {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r memoryUserRepository) FindByEmail(email string) (*repository.User, error) {
+	for _, user := range r {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r memoryUserRepository) Save(user *repository.User) error {
+	user.ID = int64(len(r) + 1)
+	r[user.ID] = user
+	return nil
+}
+
+func (r memoryUserRepository) SaveWithIdentity(user *repository.User, identity *repository.Identity) error {
+	r.Save(user)
+	identity.UserID = user.ID
+	return nil
+}
+
+func (r memoryUserRepository) UpdateLastLogin(user *repository.User) error {
+	return nil
+}
+
+func (r memoryUserRepository) UpdateHashedPassword(user *repository.User) error {
+	return nil
+}
+
+func (r memoryUserRepository) UpdateRole(user *repository.User) error {
+	r[user.ID] = user
+	return nil
+}
+
+func (r memoryUserRepository) DemoteAdmin(user *repository.User) (bool, error) {
+	admins := 0
+	for _, u := range r {
+		if u.ID != user.ID && u.Role == repository.RoleAdmin {
+			admins++
+		}
+	}
+	if admins == 0 {
+		return false, nil
+	}
+	r[user.ID] = user
+	return true, nil
+}
+
+func (r memoryUserRepository) ListExpiredRoles(limit int64) ([]*repository.User, error) {
+	var users []*repository.User
+	for _, user := range r {
+		if user.RoleExpiresAt != nil && !user.RoleExpiresAt.After(time.Now()) {
+			users = append(users, user)
+		}
+	}
+	slices.SortFunc(users, func(a, b *repository.User) int {
+		return a.RoleExpiresAt.Compare(*b.RoleExpiresAt)
+	})
+	return users, nil
+}
+
+func (r memoryUserRepository) RestoreExpiredRole(user *repository.User) (bool, error) {
+	if user.RoleExpiresAt == nil || user.PreviousRole == nil || user.RoleExpiresAt.After(time.Now()) {
+		return false, nil
+	}
+	user.Role = *user.PreviousRole
+	user.PreviousRole = nil
+	user.RoleExpiresAt = nil
+	return true, nil
+}
+
+// 按id倒序保存事件，过滤条件与数据库实现一致
+type memoryEventRepository struct {
+	events []*repository.Event
+}
+
+func (r *memoryEventRepository) List(filter repository.EventFilter, beforeId, limit int64) ([]*repository.Event, error) {
+	var events []*repository.Event
+	for i := len(r.events) - 1; i >= 0 && int64(len(events)) < limit; i-- {
+		event := r.events[i]
+		var detail struct {
+			ActorUser  *int64 `json:"actor_user"`
+			TargetUser *int64 `json:"target_user"`
+		}
+		json.Unmarshal([]byte(event.Detail), &detail)
+		matches := func(want, got *int64) bool {
+			return want == nil || (got != nil && *want == *got)
+		}
+		if (beforeId == 0 || event.ID < beforeId) &&
+			(filter.Action == "" || event.Action == filter.Action) &&
+			matches(filter.ActorUser, detail.ActorUser) &&
+			matches(filter.TargetUser, detail.TargetUser) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (r *memoryEventRepository) Save(action string, detail interface{}) error {
+	encoded, _ := json.Marshal(detail)
+	r.events = append(r.events, &repository.Event{
+		ID:        int64(len(r.events) + 1),
+		Action:    action,
+		Detail:    string(encoded),
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+func (r *memoryEventRepository) actions() []string {
+	var actions []string
+	for _, event := range r.events {
+		actions = append(actions, event.Action)
+	}
+	return actions
+}
+
+// 模拟已通过权限中间件的请求，处理函数通过GetPrincipal取得操作者
+func adminRequest(method string, target string, body string, principal *util.Principal) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept", "application/json")
+	return r.WithContext(authclient.NewContext(r.Context(), principal))
+}
+
+func newTestAdminService(users memoryUserRepository) *adminService {
+	s := NewAdminService(
+		nil,
+		users,
+		discardEventRepository{},
+		memorySessionRepository{},
+		nil,
+		nil,
+		nil,
+		DefaultStrikePolicy,
+	)
+	return s.(*adminService)
+}
+
+func TestGetUserPagination(t *testing.T) {
+	users := memoryUserRepository{}
+	for _, username := range []string{"erin", "carol", "alice", "dave", "bob"} {
+		users.add(username, repository.RoleMember)
+	}
+	s := newTestAdminService(users)
+	admin := &util.Principal{UserId: 100, Role: repository.RoleAdmin}
+
+	type page struct {
+		Items      []UserView `json:"items"`
+		Total      int64      `json:"total"`
+		NextCursor string     `json:"next_cursor"`
+	}
+	list := func(query string) (page, error) {
+		w := httptest.NewRecorder()
+		err := s.GetUser(w, adminRequest("GET", "/user?"+query, "", admin))
+		var p page
+		json.Unmarshal(w.Body.Bytes(), &p)
+		return p, err
+	}
+
+	var usernames []string
+	query := "sort=username&limit=2"
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("pagination did not terminate")
+		}
+		p, err := list(query)
+		requireCode(t, err, "")
+		if p.Total != 5 {
+			t.Errorf("expected total 5, got %d", p.Total)
+		}
+		for _, item := range p.Items {
+			usernames = append(usernames, item.Username)
+		}
+		if p.NextCursor == "" {
+			break
+		}
+		query = "sort=username&limit=2&cursor=" + p.NextCursor
+	}
+	if strings.Join(usernames, ",") != "alice,bob,carol,dave,erin" {
+		t.Errorf("unexpected order %v", usernames)
+	}
+
+	// 最后一页恰好取满时不再返回游标
+	p, err := list("sort=id&order=desc&limit=5")
+	requireCode(t, err, "")
+	if len(p.Items) != 5 || p.NextCursor != "" || p.Items[0].Id != 5 {
+		t.Errorf("unexpected full page %+v", p)
+	}
+
+	// 游标只能用于生成它的排序方式
+	p, err = list("sort=username&limit=2")
+	requireCode(t, err, "")
+	_, err = list("sort=created_at&limit=2&cursor=" + p.NextCursor)
+	requireCode(t, err, util.CodeCursorInvalid)
+	_, err = list("cursor=not-a-cursor")
+	requireCode(t, err, util.CodeCursorInvalid)
+	_, err = list("sort=email")
+	requireCode(t, err, util.CodeSortFieldInvalid)
+}
+
+func TestListEvents(t *testing.T) {
+	events := &memoryEventRepository{}
+	for i := range 4 {
+		events.Save(EventLogin, &struct {
+			ActorUser  int64 `json:"actor_user"`
+			TargetUser int64 `json:"target_user"`
+		}{ActorUser: int64(i % 2), TargetUser: 7})
+	}
+	s := newTestAdminService(memoryUserRepository{})
+	s.eventRepo = events
+	admin := &util.Principal{UserId: 100, Role: repository.RoleAdmin}
+
+	type page struct {
+		Items      []EventView `json:"items"`
+		NextBefore int64       `json:"next_before"`
+	}
+	list := func(query string) (page, error) {
+		w := httptest.NewRecorder()
+		err := s.ListEvents(w, adminRequest("GET", "/events?"+query, "", admin))
+		var p page
+		json.Unmarshal(w.Body.Bytes(), &p)
+		return p, err
+	}
+
+	// 系统用户的id为0，同样可以作为过滤条件
+	p, err := list("actor=0")
+	requireCode(t, err, "")
+	if len(p.Items) != 2 || p.Items[0].Id != 3 || p.Items[1].Id != 1 {
+		t.Errorf("unexpected system events %+v", p.Items)
+	}
+	p, err = list("target=7&limit=3")
+	requireCode(t, err, "")
+	if len(p.Items) != 3 || p.NextBefore != 2 {
+		t.Errorf("unexpected first page %+v", p)
+	}
+	p, err = list("target=7&limit=3&before=2")
+	requireCode(t, err, "")
+	if len(p.Items) != 1 || p.NextBefore != 0 {
+		t.Errorf("unexpected last page %+v", p)
+	}
+	// 恰好取满的最后一页不返回游标
+	p, err = list("limit=4")
+	requireCode(t, err, "")
+	if len(p.Items) != 4 || p.NextBefore != 0 {
+		t.Errorf("unexpected full page %+v", p)
+	}
+
+	_, err = list("actor=-1")
+	requireCode(t, err, util.CodeQueryOutOfRange)
+}
+
+// 封禁改为限制或解除封禁都需要封禁权限
+func TestRestrictBannedUserRequiresBanPermission(t *testing.T) {
+	users := memoryUserRepository{}
+	users.add("alice", repository.RoleBanned)
+	users.add("bob", repository.RoleBanned)
+	events := &memoryEventRepository{}
+	s := newTestAdminService(users)
+	s.eventRepo = events
+
+	moderator := &util.Principal{UserId: 100, Role: repository.RoleModerator}
+	admin := &util.Principal{UserId: 101, Role: repository.RoleAdmin, Permissions: []string{repository.PermUserBan}}
+	restrict := func(principal *util.Principal, username string) error {
+		body := `{"username":"` + username + `","reason":"test"}`
+		return s.RestrictUser(httptest.NewRecorder(), adminRequest("POST", "/user/restrict", body, principal))
+	}
+	restore := func(principal *util.Principal, username string) error {
+		body := `{"username":"` + username + `","reason":"test"}`
+		return s.RestoreUser(httptest.NewRecorder(), adminRequest("POST", "/user/restore", body, principal))
+	}
+
+	requireCode(t, restrict(moderator, "alice"), util.CodePermissionDenied)
+	requireCode(t, restore(moderator, "bob"), util.CodePermissionDenied)
+	if users[1].Role != repository.RoleBanned || users[2].Role != repository.RoleBanned || len(events.events) != 0 {
+		t.Fatal("banned users changed without ban permission")
+	}
+
+	requireCode(t, restrict(admin, "alice"), "")
+	if users[1].Role != repository.RoleRestricted {
+		t.Errorf("expected alice to be restricted, got %s", users[1].Role)
+	}
+	requireCode(t, restore(admin, "bob"), "")
+	if users[2].Role != repository.RoleMember {
+		t.Errorf("expected bob to be restored, got %s", users[2].Role)
+	}
+
+	// 限制中的用户由版主即可解除
+	requireCode(t, restore(moderator, "alice"), "")
+	if users[1].Role != repository.RoleMember {
+		t.Errorf("expected alice to be restored, got %s", users[1].Role)
+	}
+	want := []string{EventRestrictUser, EventRestoreUser, EventRestoreUser}
+	if !slices.Equal(events.actions(), want) {
+		t.Errorf("expected events %v, got %v", want, events.actions())
+	}
+}
+
+type failingRestoreRepository struct {
+	memoryUserRepository
+	failId int64
+}
+
+func (r failingRestoreRepository) RestoreExpiredRole(user *repository.User) (bool, error) {
+	if user.ID == r.failId {
+		return false, errors.New("restore failed")
+	}
+	return r.memoryUserRepository.RestoreExpiredRole(user)
+}
+
+func TestExpireRoles(t *testing.T) {
+	expired := time.Now().Add(-time.Minute)
+	pending := time.Now().Add(time.Hour)
+	member, trusted := repository.RoleMember, repository.RoleTrusted
+	users := memoryUserRepository{}
+	punish := func(username, role string, previousRole *string, expiresAt *time.Time) *repository.User {
+		user := users.add(username, role)
+		user.PreviousRole = previousRole
+		user.RoleExpiresAt = expiresAt
+		return user
+	}
+	alice := punish("alice", repository.RoleBanned, &member, &expired)
+	bob := punish("bob", repository.RoleRestricted, &trusted, &expired)
+	carol := punish("carol", repository.RoleBanned, &member, &pending)
+	dave := punish("dave", repository.RoleBanned, nil, nil)
+
+	events := &memoryEventRepository{}
+	s := newTestAdminService(users)
+	s.eventRepo = events
+	// 第一个用户失败时仍继续处理后面的用户
+	s.userRepo = failingRestoreRepository{users, alice.ID}
+
+	if err := s.ExpireRoles(); err == nil {
+		t.Error("expected failed restore to be reported")
+	}
+	if alice.Role != repository.RoleBanned {
+		t.Errorf("expected alice to stay banned, got %s", alice.Role)
+	}
+	if bob.Role != repository.RoleTrusted || bob.PreviousRole != nil || bob.RoleExpiresAt != nil {
+		t.Errorf("expected bob to be restored to trusted, got %+v", bob)
+	}
+
+	s.userRepo = users
+	if err := s.ExpireRoles(); err != nil {
+		t.Fatal(err)
+	}
+	if alice.Role != repository.RoleMember {
+		t.Errorf("expected alice to be restored to member, got %s", alice.Role)
+	}
+	if carol.Role != repository.RoleBanned || dave.Role != repository.RoleBanned {
+		t.Error("unexpired bans were lifted")
+	}
+
+	if !slices.Equal(events.actions(), []string{EventUnbanUser, EventUnbanUser}) {
+		t.Fatalf("unexpected events %v", events.actions())
+	}
+	var detail roleChangeDetail
+	json.Unmarshal([]byte(events.events[1].Detail), &detail)
+	if detail.ActorUser != repository.SystemUserId || detail.TargetUser != alice.ID ||
+		detail.FromRole != repository.RoleBanned || detail.ToRole != repository.RoleMember {
+		t.Errorf("unexpected unban event %+v", detail)
+	}
+}
+
+func TestSetUserRole(t *testing.T) {
+	users := memoryUserRepository{}
+	alice := users.add("alice", repository.RoleAdmin)
+	bob := users.add("bob", repository.RoleMember)
+	users.add("carol", repository.RoleBanned)
+	users.add("dave", repository.RoleRestricted)
+	events := &memoryEventRepository{}
+	sessions := memorySessionRepository{}
+	s := newTestAdminService(users)
+	s.eventRepo = events
+	s.sessionRepo = sessions
+
+	moderator := &util.Principal{UserId: 100, Role: repository.RoleModerator}
+	setRole := func(principal *util.Principal, username, role string) error {
+		body := `{"username":"` + username + `","role":"` + role + `","reason":"test"}`
+		return s.SetUserRole(httptest.NewRecorder(), adminRequest("POST", "/user/role", body, principal))
+	}
+	asAdmin := &util.Principal{UserId: alice.ID, Role: repository.RoleAdmin}
+
+	requireCode(t, setRole(asAdmin, "alice", repository.RoleMember), util.CodeRoleSelfChange)
+	requireCode(t, setRole(moderator, "bob", repository.RoleAdmin), util.CodeRoleAdminRequired)
+	requireCode(t, setRole(moderator, "alice", repository.RoleMember), util.CodeRoleAdminRequired)
+	// 处罚只能通过restore解除
+	requireCode(t, setRole(asAdmin, "carol", repository.RoleMember), util.CodeRoleSanctioned)
+	requireCode(t, setRole(moderator, "dave", repository.RoleTrusted), util.CodeRoleSanctioned)
+	if len(events.events) != 0 || len(sessions) != 0 {
+		t.Fatal("rejected role changes had side effects")
+	}
+
+	requireCode(t, setRole(asAdmin, "bob", repository.RoleAdmin), "")
+	asBob := &util.Principal{UserId: bob.ID, Role: repository.RoleAdmin}
+	requireCode(t, setRole(asBob, "alice", repository.RoleModerator), "")
+	if alice.Role != repository.RoleModerator || bob.Role != repository.RoleAdmin {
+		t.Errorf("unexpected roles alice=%s bob=%s", alice.Role, bob.Role)
+	}
+	if _, revoked := sessions[alice.ID]; !revoked {
+		t.Error("expected sessions of demoted admin to be revoked")
+	}
+	if !slices.Equal(events.actions(), []string{EventRoleChange, EventRoleChange}) {
+		t.Errorf("unexpected events %v", events.actions())
+	}
+
+	// 其他管理员也不能撤销最后一位管理员
+	delete(sessions, bob.ID)
+	requireCode(t, setRole(&util.Principal{UserId: 100, Role: repository.RoleAdmin}, "bob", repository.RoleMember), util.CodeRoleLastAdmin)
+	if _, revoked := sessions[bob.ID]; revoked || len(events.events) != 2 {
+		t.Error("failed demotion of the last admin had side effects")
+	}
+}
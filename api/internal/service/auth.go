@@ -4,10 +4,11 @@ import (
 	"auth/internal/infra"
 	"auth/internal/repository"
 	"auth/internal/util"
+	"auth/pkg/authclient"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"strings"
+	"slices"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -29,41 +30,93 @@ type AuthService interface {
 	Logout(http.ResponseWriter, *http.Request) error
 	RequestOtp(http.ResponseWriter, *http.Request) error
 	ResetPassword(http.ResponseWriter, *http.Request) error
+	ListStrikes(http.ResponseWriter, *http.Request) error
+	ListPersonalTokens(http.ResponseWriter, *http.Request) error
+	CreatePersonalToken(http.ResponseWriter, *http.Request) error
+	RevokePersonalToken(http.ResponseWriter, *http.Request) error
+	VerifyPersonalToken(token string) (*util.TokenInfo, error)
 }
 
 type authService struct {
-	userRepo  repository.UserRepository
-	eventRepo repository.EventRepository
-	otpRepo   repository.OtpRepository
-	email     infra.EmailClient
+	userRepo           repository.UserRepository
+	eventRepo          repository.EventRepository
+	otpRepo            repository.OtpRepository
+	sessionRepo        repository.SessionRepository
+	strikeRepo         repository.StrikeRepository
+	personalTokenRepo  repository.PersonalTokenRepository
+	inviteRepo         repository.InviteRepository
+	identityRepo       repository.IdentityRepository
+	strikePolicy       StrikePolicy
+	registrationPolicy RegistrationPolicy
+	email              infra.EmailClient
+	challengeService   ChallengeService
+	verifier           *authclient.Verifier
+	authenticators     []Authenticator
+	// v1和v2共用同一个限流器，切换前缀不会增加配额
+	registerLimiter func(http.Handler) http.Handler
 }
 
 func NewAuthService(
 	userRepo repository.UserRepository,
 	eventRepo repository.EventRepository,
 	otpRepo repository.OtpRepository,
+	sessionRepo repository.SessionRepository,
+	strikeRepo repository.StrikeRepository,
+	personalTokenRepo repository.PersonalTokenRepository,
+	inviteRepo repository.InviteRepository,
+	identityRepo repository.IdentityRepository,
+	strikePolicy StrikePolicy,
+	registrationPolicy RegistrationPolicy,
 	email infra.EmailClient,
+	challengeService ChallengeService,
+	verifier *authclient.Verifier,
+	authenticators ...Authenticator,
 ) AuthService {
 	s := &authService{
-		userRepo:  userRepo,
-		eventRepo: eventRepo,
-		otpRepo:   otpRepo,
-		email:     email,
+		userRepo:           userRepo,
+		eventRepo:          eventRepo,
+		otpRepo:            otpRepo,
+		sessionRepo:        sessionRepo,
+		strikeRepo:         strikeRepo,
+		personalTokenRepo:  personalTokenRepo,
+		inviteRepo:         inviteRepo,
+		identityRepo:       identityRepo,
+		strikePolicy:       strikePolicy,
+		registrationPolicy: registrationPolicy,
+		email:              email,
+		challengeService:   challengeService,
+		verifier:           verifier,
+		// 本地密码始终作为最后一个登录方式
+		authenticators:  append(slices.Clip(authenticators), NewPasswordAuthenticator(userRepo, identityRepo)),
+		registerLimiter: util.RateLimiter(100),
 	}
 	return s
 }
 
 func (s *authService) Use(router chi.Router) {
 	router.Group(func(router chi.Router) {
-		router.Use(util.RateLimiter(100))
+		router.Use(s.registerLimiter)
 		router.Post("/register", util.EH(s.Register))
+		router.Post("/otp/request", util.EH(s.RequestOtp))
 	})
 
 	router.Post("/login", util.EH(s.Login))
 	router.Post("/logout", util.EH(s.Logout))
 	router.Post("/refresh", util.EH(s.Refresh))
-	router.Post("/otp/request", util.EH(s.RequestOtp))
 	router.Post("/password/reset", util.EH(s.ResetPassword))
+
+	router.With(s.authenticate(authclient.RequireUser())).Get("/strikes", util.EH(s.ListStrikes))
+	router.Group(func(router chi.Router) {
+		router.Use(s.authenticate(requireLoginSession))
+		router.Get("/tokens", util.EH(s.ListPersonalTokens))
+		router.Post("/tokens", util.EH(s.CreatePersonalToken))
+		router.Post("/tokens/revoke", util.EH(s.RevokePersonalToken))
+	})
+}
+
+// 用户自助接口只校验令牌和会话，不加载角色权限
+func (s *authService) authenticate(requirements ...authclient.Requirement) func(http.Handler) http.Handler {
+	return s.verifier.Middleware(requirements...)
 }
 
 func (s *authService) Register(w http.ResponseWriter, r *http.Request) error {
@@ -73,11 +126,15 @@ func (s *authService) Register(w http.ResponseWriter, r *http.Request) error {
 		Password string `json:"password" validate:"required,min=8,max=100"`
 		Email    string `json:"email" validate:"required,email"`
 		Otp      string `json:"otp" validate:"required,numeric,len=6"`
+		Invite   string `json:"invite" validate:"max=64"`
 	}](r)
 	if err != nil {
 		slog.Error("Register request body parse error", "error", err)
 		return err
 	}
+	if err := s.challengeService.Require(r, req.Email); err != nil {
+		return err
+	}
 	if err := util.ValidUsername(req.Username); err != nil {
 		slog.Error("Invalid username", "username", req.Username, "error", err)
 		return err
@@ -86,15 +143,30 @@ func (s *authService) Register(w http.ResponseWriter, r *http.Request) error {
 		slog.Error("Invalid password", "error", err)
 		return err
 	}
+	attempt := RegistrationAttempt{
+		App:   req.App,
+		Email: req.Email,
+		Ip:    util.GetRealIp(r),
+	}
+	if err := screenRegistration(s.registrationPolicy.RiskChecks, s.eventRepo, riskStageRegister, attempt); err != nil {
+		return err
+	}
+	// 先占用邀请码，邀请码无效时不消耗验证码
+	invite, err := admitRegistration(s.registrationPolicy, s.inviteRepo, req.Email, req.Invite)
+	if err != nil {
+		return err
+	}
 	if !s.otpRepo.CheckOtp(repository.OtpVerify, req.Email, req.Otp) {
 		slog.Error("Invalid OTP", "email", req.Email, "otp", req.Otp)
-		return util.BadRequest("无效验证码")
+		releaseInvite(s.inviteRepo, invite)
+		return util.BadRequest(util.CodeOtpInvalid)
 	}
 
 	hashedPassword, err := util.GenerateHash(req.Password)
 	if err != nil {
 		slog.Error("Password hash error", "error", err)
-		return util.InternalServerError("密码哈希失败")
+		releaseInvite(s.inviteRepo, invite)
+		return util.InternalServerError(util.CodePasswordHashFailed)
 	}
 
 	user := &repository.User{
@@ -106,37 +178,32 @@ func (s *authService) Register(w http.ResponseWriter, r *http.Request) error {
 		LastLogin: time.Now(),
 		Attr:      "{}",
 	}
-	err = s.userRepo.Save(user)
-	if err != nil {
-		if util.IsUniqueConstraintViolation(err, "auth_user_username_key") {
-			slog.Error("Username already exist")
-			return util.Conflict("用户名已被占用")
-		} else if util.IsUniqueConstraintViolation(err, "auth_user_email_key") {
-			slog.Error("Email already exist")
-			return util.Conflict("邮箱已被占用")
-		} else {
-			slog.Error("Failed to save user", "error", err)
-			return util.InternalServerError("创建用户失败")
-		}
+	if err := saveNewUser(s.userRepo, user); err != nil {
+		releaseInvite(s.inviteRepo, invite)
+		return err
 	}
+	recordRegistration(s.registrationPolicy.RiskChecks, attempt)
 
 	s.eventRepo.Save(
 		EventRegister,
 		&struct {
 			App        string `json:"app"`
-			ActorUser  string `json:"actor_user"`
-			TargetUser string `json:"target_user"`
+			ActorUser  int64  `json:"actor_user"`
+			TargetUser int64  `json:"target_user"`
 			Ip         string `json:"ip"`
+			inviteDetail
 		}{
-			App:        req.App,
-			ActorUser:  user.Username,
-			TargetUser: user.Username,
-			Ip:         util.GetRealIp(r),
+			App:          req.App,
+			ActorUser:    user.ID,
+			TargetUser:   user.ID,
+			Ip:           attempt.Ip,
+			inviteDetail: newInviteDetail(invite),
 		},
 	)
 
-	return util.RespondAuthTokens(w, util.TokenOptions{
+	return util.RespondAuthTokens(w, r, util.TokenOptions{
 		App:              req.App,
+		UserId:           user.ID,
 		Username:         user.Username,
 		Role:             user.Role,
 		CreatedAt:        user.CreatedAt,
@@ -144,6 +211,52 @@ func (s *authService) Register(w http.ResponseWriter, r *http.Request) error {
 	})
 }
 
+// 保存新用户，用户名或邮箱已被占用时返回对应的错误
+func saveNewUser(userRepo repository.UserRepository, user *repository.User) error {
+	return newUserError(userRepo.Save(user))
+}
+
+// 保存新用户并绑定外部身份，身份已被其他账号绑定时返回对应的错误
+func saveNewUserWithIdentity(userRepo repository.UserRepository, user *repository.User, identity *repository.Identity) error {
+	err := userRepo.SaveWithIdentity(user, identity)
+	if util.IsUniqueConstraintViolation(err, "auth_identity_provider_subject_key") {
+		slog.Error("Identity already linked", "provider", identity.Provider)
+		return util.Conflict(util.CodeIdentityTaken)
+	}
+	return newUserError(err)
+}
+
+func newUserError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if util.IsUniqueConstraintViolation(err, "auth_user_username_key") {
+		slog.Error("Username already exist")
+		return util.Conflict(util.CodeUsernameTaken)
+	} else if util.IsUniqueConstraintViolation(err, "auth_user_email_key") {
+		slog.Error("Email already exist")
+		return util.Conflict(util.CodeEmailTaken)
+	} else {
+		slog.Error("Failed to save user", "error", err)
+		return util.InternalServerError(util.CodeUserCreateFailed)
+	}
+}
+
+// 按顺序尝试各个登录方式，返回用户和校验通过的方式
+func (s *authService) verifyCredentials(username string, password string) (*repository.User, string, error) {
+	for _, authenticator := range s.authenticators {
+		user, err := authenticator.Authenticate(username, password)
+		if err != nil {
+			return nil, "", err
+		}
+		if user != nil {
+			return user, authenticator.Name(), nil
+		}
+	}
+	slog.Error("User not found", "username", username)
+	return nil, "", util.NotFound(util.CodeUserNotFound)
+}
+
 func (s *authService) Login(w http.ResponseWriter, r *http.Request) error {
 	req, err := util.Body[struct {
 		App      string `json:"app" validate:"required"`
@@ -155,39 +268,14 @@ func (s *authService) Login(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	var user *repository.User
-	if strings.Contains(req.Username, "@") {
-		user, err = s.userRepo.FindByEmail(req.Username)
-		if err != nil {
-			slog.Error("User lookup by email failed", "email", req.Username, "error", err)
-			return util.InternalServerError("查询用户失败")
-		}
-	}
-	if user == nil {
-		user, err = s.userRepo.FindByUsername(req.Username)
-		if err != nil {
-			slog.Error("User lookup by username failed", "username", req.Username, "error", err)
-			return util.InternalServerError("查询用户失败")
-		}
+	user, method, err := s.verifyCredentials(req.Username, req.Password)
+	if err != nil {
+		return err
 	}
-	if user == nil {
-		slog.Error("User not found", "username", req.Username)
-		return util.NotFound("用户不存在")
-	}
-
-	v, err := util.ValidateHash(user.Password, req.Password)
-	if !v.Valid || err != nil {
-		slog.Error("Password validation failed", "username", user.Username, "error", err)
-		return util.Unauthorized("密码错误")
-	}
-	if v.Obsolete {
-		newHashedPassword, err := util.GenerateHash(req.Password)
-		if err == nil {
-			user.Password = newHashedPassword
-			s.userRepo.UpdateHashedPassword(user)
-		} else {
-			slog.Warn("Failed to update password hash", "username", user.Username, "error", err)
-		}
+
+	restoreExpiredRole(s.userRepo, s.eventRepo, user)
+	if err := checkNotBanned(s.eventRepo, user); err != nil {
+		return err
 	}
 
 	user.LastLogin = time.Now()
@@ -197,18 +285,21 @@ func (s *authService) Login(w http.ResponseWriter, r *http.Request) error {
 		EventLogin,
 		&struct {
 			App        string `json:"app"`
-			ActorUser  string `json:"actor_user"`
-			TargetUser string `json:"target_user"`
+			ActorUser  int64  `json:"actor_user"`
+			TargetUser int64  `json:"target_user"`
+			Provider   string `json:"provider"`
 			Ip         string `json:"ip"`
 		}{
 			App:        req.App,
-			ActorUser:  user.Username,
-			TargetUser: user.Username,
+			ActorUser:  user.ID,
+			TargetUser: user.ID,
+			Provider:   method,
 			Ip:         util.GetRealIp(r),
 		},
 	)
-	return util.RespondAuthTokens(w, util.TokenOptions{
+	return util.RespondAuthTokens(w, r, util.TokenOptions{
 		App:              req.App,
+		UserId:           user.ID,
 		Username:         user.Username,
 		Role:             user.Role,
 		CreatedAt:        user.CreatedAt,
@@ -217,49 +308,83 @@ func (s *authService) Login(w http.ResponseWriter, r *http.Request) error {
 }
 
 func (s *authService) Refresh(w http.ResponseWriter, r *http.Request) error {
-	username, err := util.VerifyRefreshToken(r)
+	session, err := util.VerifyRefreshToken(r)
 	if err != nil {
 		return err
 	}
+	userId := session.UserId
+
+	// 应用以刷新令牌中记录的为准，旧客户端仍会传app参数，只需与之一致
+	if app := r.URL.Query().Get("app"); app != "" && app != session.App {
+		slog.Error("Refresh token app mismatch", "user_id", userId, "token_app", session.App, "app", app)
+		return util.Unauthorized(util.CodeRefreshTokenAppMismatch)
+	}
+
+	revokedAt, err := s.sessionRepo.UserSessionsRevokedAt(userId)
+	if err != nil {
+		return util.InternalServerError(util.CodeSessionQueryFailed)
+	}
+	if repository.SessionRevoked(session.IssuedAt, revokedAt) {
+		slog.Error("Refresh token revoked", "user_id", userId)
+		return util.Unauthorized(util.CodeRefreshTokenRevoked)
+	}
 
-	user, err := s.userRepo.FindByUsername(username)
+	user, err := s.userRepo.FindById(userId)
 	if err != nil {
-		slog.Error("User lookup failed", "username", username, "error", err)
+		slog.Error("User lookup failed", "user_id", userId, "error", err)
 		return err
 	}
 	if user == nil {
-		slog.Error("User not found", "username", username)
-		return util.NotFound("用户不存在")
+		slog.Error("User not found", "user_id", userId)
+		return util.NotFound(util.CodeUserNotFound)
+	}
+
+	restoreExpiredRole(s.userRepo, s.eventRepo, user)
+	if err := checkNotBanned(s.eventRepo, user); err != nil {
+		return err
+	}
+
+	// 先撤销旧的刷新令牌，失败时客户端仍可继续使用旧令牌
+	rotate := util.RotatesRefreshToken(r, session.App)
+	if rotate {
+		if err := util.RevokeRefreshToken(session); err != nil {
+			return err
+		}
 	}
 
 	user.LastLogin = time.Now()
 	s.userRepo.UpdateLastLogin(user)
 
-	return util.RespondAuthTokens(w, util.TokenOptions{
-		App:              r.URL.Query().Get("app"),
+	return util.RespondAuthTokens(w, r, util.TokenOptions{
+		App:              session.App,
+		UserId:           user.ID,
 		Username:         user.Username,
 		Role:             user.Role,
 		CreatedAt:        user.CreatedAt,
-		WithRefreshToken: false,
+		WithRefreshToken: rotate,
 	})
 }
 
 func (s *authService) Logout(w http.ResponseWriter, r *http.Request) error {
-	username, err := util.VerifyRefreshToken(r)
+	session, err := util.VerifyRefreshToken(r)
 	if err != nil {
 		slog.Error("Failed to verify refresh token", "error", err)
 		return err
 	}
+	userId := session.UserId
+	if err := util.RevokeRefreshToken(session); err != nil {
+		return err
+	}
 
 	s.eventRepo.Save(
 		EventLogout,
 		&struct {
-			ActorUser  string `json:"actor_user"`
-			TargetUser string `json:"target_user"`
+			ActorUser  int64  `json:"actor_user"`
+			TargetUser int64  `json:"target_user"`
 			Ip         string `json:"ip"`
 		}{
-			ActorUser:  username,
-			TargetUser: username,
+			ActorUser:  userId,
+			TargetUser: userId,
 			Ip:         util.GetRealIp(r),
 		},
 	)
@@ -308,11 +433,14 @@ func (s *authService) RequestOtp(w http.ResponseWriter, r *http.Request) error {
 		slog.Error("Request OTP body parse error", "error", err)
 		return err
 	}
+	if err := s.challengeService.Require(r, req.Email); err != nil {
+		return err
+	}
 
 	user, err := s.userRepo.FindByEmail(req.Email)
 	if err != nil {
 		slog.Error("User lookup failed", "email", req.Email, "error", err)
-		return util.InternalServerError("邮件检查失败")
+		return util.InternalServerError(util.CodeEmailCheckFailed)
 	}
 
 	// 根据不同类型进行不同的验证
@@ -320,28 +448,39 @@ func (s *authService) RequestOtp(w http.ResponseWriter, r *http.Request) error {
 	case repository.OtpVerify:
 		if user != nil {
 			slog.Error("Email already in use", "email", req.Email)
-			return util.Conflict("邮箱已经被使用")
+			return util.Conflict(util.CodeEmailTaken)
+		}
+		// 注册关闭或邮箱域名不允许时不发送验证码
+		if err := s.registrationPolicy.checkEmail(req.Email); err != nil {
+			return err
+		}
+		attempt := RegistrationAttempt{Email: req.Email, Ip: util.GetRealIp(r)}
+		if err := screenRegistration(s.registrationPolicy.RiskChecks, s.eventRepo, riskStageOtp, attempt); err != nil {
+			return err
 		}
 	case repository.OtpResetPassword:
 		if user == nil {
 			slog.Error("User not found", "email", req.Email)
-			return util.NotFound("用户不存在")
+			return util.NotFound(util.CodeUserNotFound)
+		}
+		if err := s.refuseDirectoryUser(user); err != nil {
+			return err
 		}
 	default:
 		slog.Error("Invalid OTP request type", "type", req.Type)
-		return util.BadRequest("无效的请求类型")
+		return util.BadRequest(util.CodeOtpTypeInvalid)
 	}
 
 	otp, err := s.otpRepo.SetOtp(req.Type, req.Email)
 	if err != nil {
 		slog.Error("Failed to create OTP", "email", req.Email, "error", err)
-		return util.InternalServerError("创建验证码失败")
+		return util.InternalServerError(util.CodeOtpCreateFailed)
 	}
 
 	err = s.sendOtpEmail(req.Type, req.Email, otp)
 	if err != nil {
 		slog.Error("Failed to send OTP email", "email", req.Email, "error", err)
-		return util.InternalServerError("发送验证邮件失败")
+		return util.InternalServerError(util.CodeOtpSendFailed)
 	}
 
 	s.eventRepo.Save(
@@ -360,6 +499,19 @@ func (s *authService) RequestOtp(w http.ResponseWriter, r *http.Request) error {
 	return util.RespondText(w, "验证邮件已发送")
 }
 
+// 目录用户的密码只能在目录中修改
+func (s *authService) refuseDirectoryUser(user *repository.User) error {
+	directoryUser, err := isDirectoryUser(s.identityRepo, user.ID)
+	if err != nil {
+		return err
+	}
+	if directoryUser {
+		slog.Error("Password reset refused for directory user", "user_id", user.ID)
+		return util.Forbidden(util.CodeDirectoryPasswordManaged)
+	}
+	return nil
+}
+
 func (s *authService) ResetPassword(w http.ResponseWriter, r *http.Request) error {
 	req, err := util.Body[struct {
 		Email    string `json:"email" validate:"required,email"`
@@ -374,42 +526,68 @@ func (s *authService) ResetPassword(w http.ResponseWriter, r *http.Request) erro
 	user, err := s.userRepo.FindByEmail(req.Email)
 	if err != nil {
 		slog.Error("User lookup failed", "email", req.Email, "error", err)
-		return util.InternalServerError("查询用户失败")
+		return util.InternalServerError(util.CodeUserQueryFailed)
 	}
 	if user == nil {
 		slog.Error("User not found", "email", req.Email)
-		return util.NotFound("用户不存在")
+		return util.NotFound(util.CodeUserNotFound)
+	}
+	if err := s.refuseDirectoryUser(user); err != nil {
+		return err
 	}
 
 	if !s.otpRepo.CheckOtp(repository.OtpResetPassword, req.Email, req.Otp) {
 		slog.Error("Invalid OTP", "email", req.Email)
-		return util.Unauthorized("无效的验证码")
+		return util.Unauthorized(util.CodeOtpInvalid)
 	}
 
 	newHashedPassword, err := util.GenerateHash(req.Password)
 	if err != nil {
 		slog.Error("Failed to hash password", "email", req.Email, "error", err)
-		return util.InternalServerError("密码哈希失败")
+		return util.InternalServerError(util.CodePasswordHashFailed)
 	}
 	user.Password = newHashedPassword
 	err = s.userRepo.UpdateHashedPassword(user)
 	if err != nil {
 		slog.Error("Failed to update password", "email", req.Email, "error", err)
-		return util.InternalServerError("密码重置失败")
+		return util.InternalServerError(util.CodePasswordResetFailed)
+	}
+	// 找回账号后之前签发的令牌全部失效，个人令牌的有效期比撤销记录的保留时间长，需要单独撤销
+	if err := s.sessionRepo.RevokeUserSessions(user.ID); err != nil {
+		return util.InternalServerError(util.CodeSessionRevokeFailed)
+	}
+	if err := s.personalTokenRepo.RevokeByUser(user.ID); err != nil {
+		slog.Error("Failed to revoke personal tokens", "user_id", user.ID, "error", err)
+		return util.InternalServerError(util.CodePersonalTokenRevokeFailed)
 	}
 
 	s.eventRepo.Save(
 		EventResetPassword,
 		&struct {
-			ActorUser  string `json:"actor_user"`
-			TargetUser string `json:"target_user"`
+			ActorUser  int64  `json:"actor_user"`
+			TargetUser int64  `json:"target_user"`
 			Ip         string `json:"ip"`
 		}{
-			ActorUser:  user.Username,
-			TargetUser: user.Username,
+			ActorUser:  user.ID,
+			TargetUser: user.ID,
 			Ip:         util.GetRealIp(r),
 		},
 	)
 
 	return util.RespondText(w, "密码重置成功")
 }
+
+func (s *authService) ListStrikes(w http.ResponseWriter, r *http.Request) error {
+	principal := util.GetPrincipal(r)
+	strikes, err := s.strikeRepo.ListByUser(principal.UserId)
+	if err != nil {
+		slog.Error("Failed to list strikes", "user_id", principal.UserId, "error", err)
+		return util.InternalServerError(util.CodeStrikeQueryFailed)
+	}
+
+	views := make([]StrikeView, 0, len(strikes))
+	for _, strike := range strikes {
+		views = append(views, newStrikeView(strike, s.strikePolicy))
+	}
+	return util.RespondJson(w, views)
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"auth/internal/repository"
+	"auth/internal/util"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPassword = "correct horse"
+
+type emptyIdentityRepository struct{}
+
+func (emptyIdentityRepository) ListByUser(userId int64) ([]*repository.Identity, error) {
+	return nil, nil
+}
+
+func (emptyIdentityRepository) Find(provider string, subject string) (*repository.Identity, error) {
+	return nil, nil
+}
+
+func (emptyIdentityRepository) Save(identity *repository.Identity) error {
+	return nil
+}
+
+func (emptyIdentityRepository) Delete(userId int64, provider string) error {
+	return nil
+}
+
+func newTestAuthService(t *testing.T, users memoryUserRepository, events repository.EventRepository, sessions memorySessionRepository) *authService {
+	t.Helper()
+	hashedPassword, err := util.GenerateHash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range users {
+		user.Password = hashedPassword
+	}
+	s := NewAuthService(
+		users,
+		events,
+		nil,
+		sessions,
+		nil,
+		nil,
+		nil,
+		emptyIdentityRepository{},
+		DefaultStrikePolicy,
+		RegistrationPolicy{},
+		nil,
+		nil,
+		nil,
+	)
+	return s.(*authService)
+}
+
+func login(s *authService, app string, username string) (*httptest.ResponseRecorder, error) {
+	body := `{"app":"` + app + `","username":"` + username + `","password":"` + testPassword + `"}`
+	r := httptest.NewRequest("POST", "/login", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	return w, s.Login(w, r)
+}
+
+// 浏览器客户端的刷新令牌在Cookie中
+func refreshCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == util.RefreshTokenCookieName {
+			return cookie
+		}
+	}
+	t.Fatal("no refresh token cookie")
+	return nil
+}
+
+func refresh(s *authService, target string, cookie *http.Cookie) (*httptest.ResponseRecorder, error) {
+	r := httptest.NewRequest("POST", target, nil)
+	r.Header.Set("Accept", "application/json")
+	r.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	return w, s.Refresh(w, r)
+}
+
+func TestLoginRejectsBannedUser(t *testing.T) {
+	users := memoryUserRepository{}
+	alice := users.add("alice", repository.RoleBanned)
+	bob := users.add("bob", repository.RoleBanned)
+	until := time.Now().Add(time.Hour)
+	bob.RoleExpiresAt = &until
+	carol := users.add("carol", repository.RoleBanned)
+	expired := time.Now().Add(-time.Minute)
+	member := repository.RoleMember
+	carol.RoleExpiresAt = &expired
+	carol.PreviousRole = &member
+	users.add("dave", repository.RoleRestricted)
+
+	events := &memoryEventRepository{}
+	events.Save(EventBanUser, &roleChangeDetail{TargetUser: alice.ID, ToRole: repository.RoleBanned, Reason: "spam"})
+	s := newTestAuthService(t, users, events, memorySessionRepository{})
+
+	_, err := login(s, "novel", "alice")
+	requireCode(t, err, util.CodeUserBannedPermanent)
+	var httpErr *util.HttpError
+	if !errors.As(err, &httpErr) || httpErr.Details.(map[string]any)["reason"] != "spam" {
+		t.Errorf("expected ban reason in details, got %v", err)
+	}
+	_, err = login(s, "novel", "bob")
+	requireCode(t, err, util.CodeUserBannedUntil)
+
+	// 到期的封禁在登录时解除
+	_, err = login(s, "novel", "carol")
+	requireCode(t, err, "")
+	if carol.Role != repository.RoleMember {
+		t.Errorf("expected expired ban to be lifted, got %s", carol.Role)
+	}
+	// 被限制的用户仍可登录，令牌中是受限角色
+	w, err := login(s, "novel", "dave")
+	requireCode(t, err, "")
+	var response util.TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.User == nil || response.User.Role != repository.RoleRestricted {
+		t.Errorf("expected restricted role in token response, got %+v", response.User)
+	}
+}
+
+func TestRefreshAfterSessionRevoked(t *testing.T) {
+	users := memoryUserRepository{}
+	alice := users.add("alice", repository.RoleMember)
+	sessions := memorySessionRepository{}
+	s := newTestAuthService(t, users, discardEventRepository{}, sessions)
+
+	// 撤销后立即重新登录，新令牌与撤销时间在同一秒内也应有效
+	sessions.RevokeUserSessions(alice.ID)
+	w, err := login(s, "novel", "alice")
+	requireCode(t, err, "")
+	cookie := refreshCookie(t, w)
+	_, err = refresh(s, "/refresh", cookie)
+	requireCode(t, err, "")
+
+	sessions[alice.ID] = time.Now().Add(time.Second)
+	_, err = refresh(s, "/refresh", cookie)
+	requireCode(t, err, util.CodeRefreshTokenRevoked)
+}
+
+func TestRefreshRejectsBannedUser(t *testing.T) {
+	users := memoryUserRepository{}
+	alice := users.add("alice", repository.RoleMember)
+	s := newTestAuthService(t, users, discardEventRepository{}, memorySessionRepository{})
+
+	w, err := login(s, "novel", "alice")
+	requireCode(t, err, "")
+	cookie := refreshCookie(t, w)
+
+	// 即使会话撤销未生效，刷新时也会检查当前角色
+	alice.Role = repository.RoleBanned
+	_, err = refresh(s, "/refresh", cookie)
+	requireCode(t, err, util.CodeUserBannedPermanent)
+}
+
+func refreshWithBody(s *authService, refreshToken string) (util.TokenResponse, error) {
+	r := httptest.NewRequest("POST", "/refresh", strings.NewReader(`{"refresh_token":"`+refreshToken+`"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	err := s.Refresh(w, r)
+	var response util.TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response, err
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	util.RevokedTokens = memoryTokenRepository{}
+	defer func() { util.RevokedTokens = nil }()
+
+	users := memoryUserRepository{}
+	users.add("alice", repository.RoleMember)
+	s := newTestAuthService(t, users, discardEventRepository{}, memorySessionRepository{})
+
+	// 第三方客户端的刷新令牌在响应体中，每次刷新都换发
+	w, err := login(s, "legado", "alice")
+	requireCode(t, err, "")
+	var response util.TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.RefreshToken == "" {
+		t.Fatal("expected refresh token in body")
+	}
+	rotated, err := refreshWithBody(s, response.RefreshToken)
+	requireCode(t, err, "")
+	if rotated.AccessToken == "" || rotated.RefreshToken == "" || rotated.RefreshToken == response.RefreshToken {
+		t.Fatalf("expected rotated refresh token, got %+v", rotated)
+	}
+	_, err = refreshWithBody(s, response.RefreshToken)
+	requireCode(t, err, util.CodeRefreshTokenRevoked)
+	_, err = refreshWithBody(s, rotated.RefreshToken)
+	requireCode(t, err, "")
+
+	// 浏览器的刷新令牌在Cookie中，不换发
+	w, err = login(s, "novel", "alice")
+	requireCode(t, err, "")
+	cookie := refreshCookie(t, w)
+	w, err = refresh(s, "/refresh", cookie)
+	requireCode(t, err, "")
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("expected browser refresh token to be kept")
+	}
+	_, err = refresh(s, "/refresh", cookie)
+	requireCode(t, err, "")
+}
+
+// 刷新令牌只能为签发它的应用换取访问令牌
+func TestRefreshBoundToApp(t *testing.T) {
+	users := memoryUserRepository{}
+	users.add("alice", repository.RoleMember)
+	s := newTestAuthService(t, users, discardEventRepository{}, memorySessionRepository{})
+
+	w, err := login(s, "novel", "alice")
+	requireCode(t, err, "")
+	cookie := refreshCookie(t, w)
+
+	_, err = refresh(s, "/refresh?app=legado", cookie)
+	requireCode(t, err, util.CodeRefreshTokenAppMismatch)
+
+	for _, target := range []string{"/refresh", "/refresh?app=novel"} {
+		w, err = refresh(s, target, cookie)
+		requireCode(t, err, "")
+		var response util.TokenResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		info, err := util.InspectToken(response.AccessToken, "")
+		if err != nil || info.App != "novel" || info.UserId != 1 {
+			t.Errorf("%s: expected access token for novel, got %+v %v", target, info, err)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package service
+
+import (
+	"auth/internal/infra"
+	"auth/internal/repository"
+	"auth/internal/util"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 校验登录时提交的用户名和密码，Login按顺序尝试各个方式，
+// 返回nil, nil表示该方式不认识此用户或不接受此密码，交给下一个方式处理
+type Authenticator interface {
+	Name() string
+	Authenticate(username string, password string) (*repository.User, error)
+}
+
+type passwordAuthenticator struct {
+	userRepo     repository.UserRepository
+	identityRepo repository.IdentityRepository
+}
+
+// 校验本地保存的密码哈希，始终作为最后一个方式
+func NewPasswordAuthenticator(userRepo repository.UserRepository, identityRepo repository.IdentityRepository) Authenticator {
+	return &passwordAuthenticator{userRepo: userRepo, identityRepo: identityRepo}
+}
+
+func (a *passwordAuthenticator) Name() string {
+	return "password"
+}
+
+// 登录名可以是邮箱或用户名
+func findLoginUser(userRepo repository.UserRepository, username string) (*repository.User, error) {
+	var user *repository.User
+	var err error
+	if strings.Contains(username, "@") {
+		user, err = userRepo.FindByEmail(username)
+		if err != nil {
+			slog.Error("User lookup by email failed", "email", username, "error", err)
+			return nil, util.InternalServerError(util.CodeUserQueryFailed)
+		}
+	}
+	if user == nil {
+		user, err = userRepo.FindByUsername(username)
+		if err != nil {
+			slog.Error("User lookup by username failed", "username", username, "error", err)
+			return nil, util.InternalServerError(util.CodeUserQueryFailed)
+		}
+	}
+	return user, nil
+}
+
+// 绑定了目录的账号由目录管理密码，不能通过本地密码登录或重置密码
+func isDirectoryUser(identityRepo repository.IdentityRepository, userId int64) (bool, error) {
+	identities, err := identityRepo.ListByUser(userId)
+	if err != nil {
+		slog.Error("Failed to list identities", "user_id", userId, "error", err)
+		return false, util.InternalServerError(util.CodeIdentityQueryFailed)
+	}
+	return slices.ContainsFunc(identities, func(identity *repository.Identity) bool {
+		return identity.Provider == IdentityProviderLdap
+	}), nil
+}
+
+func (a *passwordAuthenticator) Authenticate(username string, password string) (*repository.User, error) {
+	user, err := findLoginUser(a.userRepo, username)
+	if err != nil || user == nil {
+		return nil, err
+	}
+
+	// 目录拒绝了密码或不可用，不能退回到本地密码
+	directoryUser, err := isDirectoryUser(a.identityRepo, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if directoryUser {
+		slog.Error("Local password login refused for directory user", "username", user.Username)
+		return nil, util.Unauthorized(util.CodePasswordIncorrect)
+	}
+
+	v, err := util.ValidateHash(user.Password, password)
+	if !v.Valid || err != nil {
+		slog.Error("Password validation failed", "username", user.Username, "error", err)
+		return nil, util.Unauthorized(util.CodePasswordIncorrect)
+	}
+	if v.Obsolete {
+		newHashedPassword, err := util.GenerateHash(password)
+		if err == nil {
+			user.Password = newHashedPassword
+			a.userRepo.UpdateHashedPassword(user)
+		} else {
+			slog.Warn("Failed to update password hash", "username", user.Username, "error", err)
+		}
+	}
+	return user, nil
+}
+
+const IdentityProviderLdap = "ldap"
+
+// 目录分组到角色的映射，按配置顺序取第一个匹配的分组
+type GroupRole struct {
+	Role  string
+	Group string
+}
+
+// 与SetUserRole可设置的角色相同，封禁和限制只能由管理员操作
+var groupAssignableRoles = []string{
+	repository.RoleAdmin,
+	repository.RoleModerator,
+	repository.RoleTrusted,
+	repository.RoleMember,
+}
+
+// 解析"admin=cn=admins,ou=groups,dc=example,dc=com;moderator=cn=editors,..."形式的配置
+func ParseGroupRoles(value string) ([]GroupRole, error) {
+	var groupRoles []GroupRole
+	for _, item := range strings.Split(value, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		role, group, ok := strings.Cut(item, "=")
+		role = strings.TrimSpace(role)
+		group = strings.TrimSpace(group)
+		if !ok || role == "" || group == "" {
+			return nil, fmt.Errorf("invalid group role mapping: %q", item)
+		}
+		if !slices.Contains(groupAssignableRoles, role) {
+			return nil, fmt.Errorf("invalid role in group mapping: %q", role)
+		}
+		groupRoles = append(groupRoles, GroupRole{Role: role, Group: group})
+	}
+	return groupRoles, nil
+}
+
+// 不在任何已映射分组中的目录用户为普通成员
+func roleForGroups(groupRoles []GroupRole, groups []string) string {
+	for _, groupRole := range groupRoles {
+		for _, group := range groups {
+			// DN不区分大小写
+			if strings.EqualFold(strings.TrimSpace(group), groupRole.Group) {
+				return groupRole.Role
+			}
+		}
+	}
+	return repository.RoleMember
+}
+
+type ldapAuthenticator struct {
+	directory    infra.Directory
+	userRepo     repository.UserRepository
+	identityRepo repository.IdentityRepository
+	eventRepo    repository.EventRepository
+	sessionRepo  repository.SessionRepository
+	groupRoles   []GroupRole
+}
+
+// 通过LDAP绑定校验密码，首次登录时创建本地用户并以目录条目的DN绑定，之后每次登录按分组同步角色
+func NewLdapAuthenticator(
+	directory infra.Directory,
+	userRepo repository.UserRepository,
+	identityRepo repository.IdentityRepository,
+	eventRepo repository.EventRepository,
+	sessionRepo repository.SessionRepository,
+	groupRoles []GroupRole,
+) Authenticator {
+	return &ldapAuthenticator{
+		directory:    directory,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		eventRepo:    eventRepo,
+		sessionRepo:  sessionRepo,
+		groupRoles:   groupRoles,
+	}
+}
+
+func (a *ldapAuthenticator) Name() string {
+	return IdentityProviderLdap
+}
+
+func (a *ldapAuthenticator) Authenticate(username string, password string) (*repository.User, error) {
+	entry, err := a.directory.Authenticate(username, password)
+	if errors.Is(err, infra.ErrDirectoryUserNotFound) {
+		return nil, a.deprovision(username)
+	}
+	if err != nil {
+		// 目录不可用时不影响本地账号登录
+		if !errors.Is(err, infra.ErrDirectoryInvalidCredentials) {
+			slog.Error("Directory authentication failed", "username", username, "error", err)
+		}
+		return nil, nil
+	}
+	if entry.Username == "" {
+		entry.Username = username
+	}
+	role := roleForGroups(a.groupRoles, entry.Groups)
+
+	identity, err := a.identityRepo.Find(IdentityProviderLdap, entry.DN)
+	if err != nil {
+		slog.Error("Failed to find identity", "dn", entry.DN, "error", err)
+		return nil, util.InternalServerError(util.CodeIdentityQueryFailed)
+	}
+	if identity == nil {
+		return a.provision(entry, role)
+	}
+
+	user, err := a.userRepo.FindById(identity.UserID)
+	if err != nil || user == nil {
+		slog.Error("User lookup failed", "user_id", identity.UserID, "error", err)
+		return nil, util.InternalServerError(util.CodeUserQueryFailed)
+	}
+	if err := a.syncRole(user, role, "目录分组变更"); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (a *ldapAuthenticator) provision(entry *infra.DirectoryEntry, role string) (*repository.User, error) {
+	if err := util.ValidUsername(entry.Username); err != nil {
+		slog.Error("Invalid directory username", "username", entry.Username, "error", err)
+		return nil, err
+	}
+	if entry.Email == "" {
+		slog.Error("Directory entry has no email", "dn", entry.DN)
+		return nil, util.Conflict(util.CodeDirectoryEmailMissing)
+	}
+	// 不自动接管同名的本地账号
+	existing, err := a.userRepo.FindByUsername(entry.Username)
+	if err != nil {
+		slog.Error("User lookup by username failed", "username", entry.Username, "error", err)
+		return nil, util.InternalServerError(util.CodeUserQueryFailed)
+	}
+	if existing != nil {
+		slog.Error("Directory user conflicts with local user", "username", entry.Username)
+		return nil, util.Conflict(util.CodeDirectoryUserConflict)
+	}
+
+	now := time.Now()
+	user := &repository.User{
+		Username:  entry.Username,
+		Email:     entry.Email,
+		Role:      role,
+		CreatedAt: now,
+		LastLogin: now,
+		Attr:      "{}",
+	}
+	identity := &repository.Identity{
+		Provider:  IdentityProviderLdap,
+		Subject:   entry.DN,
+		Email:     entry.Email,
+		CreatedAt: now,
+	}
+	if err := saveNewUserWithIdentity(a.userRepo, user, identity); err != nil {
+		return nil, err
+	}
+
+	a.eventRepo.Save(
+		EventRegister,
+		&struct {
+			ActorUser  int64  `json:"actor_user"`
+			TargetUser int64  `json:"target_user"`
+			Provider   string `json:"provider"`
+			Role       string `json:"role"`
+		}{
+			ActorUser:  repository.SystemUserId,
+			TargetUser: user.ID,
+			Provider:   IdentityProviderLdap,
+			Role:       role,
+		},
+	)
+	return user, nil
+}
+
+// 目录中已删除的用户降为普通成员并撤销已签发的令牌，之后也不能再用本地密码登录。
+// 本地用户名与首次登录时目录中的用户名相同，因此只按用户名查找
+func (a *ldapAuthenticator) deprovision(username string) error {
+	user, err := a.userRepo.FindByUsername(username)
+	if err != nil {
+		slog.Error("User lookup by username failed", "username", username, "error", err)
+		return util.InternalServerError(util.CodeUserQueryFailed)
+	}
+	if user == nil {
+		return nil
+	}
+	directoryUser, err := isDirectoryUser(a.identityRepo, user.ID)
+	if err != nil || !directoryUser {
+		return err
+	}
+
+	slog.Warn("Directory user no longer exists", "user_id", user.ID, "username", username)
+	if err := a.syncRole(user, repository.RoleMember, "目录中已没有该用户"); err != nil {
+		return err
+	}
+	if err := a.sessionRepo.RevokeUserSessions(user.ID); err != nil {
+		return util.InternalServerError(util.CodeSessionRevokeFailed)
+	}
+	return nil
+}
+
+// 目录是角色的唯一来源，但不覆盖本地的封禁和限制
+func (a *ldapAuthenticator) syncRole(user *repository.User, role string, reason string) error {
+	if user.Role == role || user.Role == repository.RoleBanned || user.Role == repository.RoleRestricted {
+		return nil
+	}
+
+	fromRole := user.Role
+	user.Role = role
+	user.PreviousRole = nil
+	user.RoleExpiresAt = nil
+	if err := a.userRepo.UpdateRole(user); err != nil {
+		slog.Error("Failed to update user role", "user_id", user.ID, "error", err)
+		return util.InternalServerError(util.CodeRoleUpdateFailed)
+	}
+	// 登录时随后签发的令牌已是新角色，不受撤销影响
+	if isDemotion(fromRole, role) {
+		if err := a.sessionRepo.RevokeUserSessions(user.ID); err != nil {
+			return util.InternalServerError(util.CodeSessionRevokeFailed)
+		}
+	}
+
+	a.eventRepo.Save(
+		EventRoleChange,
+		&roleChangeDetail{
+			ActorUser:  repository.SystemUserId,
+			TargetUser: user.ID,
+			FromRole:   fromRole,
+			ToRole:     user.Role,
+			Reason:     reason,
+		},
+	)
+	return nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"auth/internal/repository"
+	"testing"
+)
+
+func TestParseGroupRoles(t *testing.T) {
+	groupRoles, err := ParseGroupRoles("admin=cn=admins,ou=groups,dc=example,dc=com; moderator = cn=editors,ou=groups,dc=example,dc=com ;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groupRoles) != 2 ||
+		groupRoles[0] != (GroupRole{Role: "admin", Group: "cn=admins,ou=groups,dc=example,dc=com"}) ||
+		groupRoles[1] != (GroupRole{Role: "moderator", Group: "cn=editors,ou=groups,dc=example,dc=com"}) {
+		t.Errorf("unexpected group roles %+v", groupRoles)
+	}
+
+	for _, value := range []string{"admin", "=cn=admins", "banned=cn=trolls", "owner=cn=owners"} {
+		if _, err := ParseGroupRoles(value); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+}
+
+func TestRoleForGroups(t *testing.T) {
+	groupRoles := []GroupRole{
+		{Role: repository.RoleAdmin, Group: "cn=admins,dc=example,dc=com"},
+		{Role: repository.RoleModerator, Group: "cn=editors,dc=example,dc=com"},
+	}
+
+	cases := []struct {
+		groups []string
+		role   string
+	}{
+		{nil, repository.RoleMember},
+		{[]string{"cn=readers,dc=example,dc=com"}, repository.RoleMember},
+		{[]string{"CN=Editors,DC=example,DC=com"}, repository.RoleModerator},
+		{[]string{"cn=editors,dc=example,dc=com", "cn=admins,dc=example,dc=com"}, repository.RoleAdmin},
+	}
+	for _, c := range cases {
+		if role := roleForGroups(groupRoles, c.groups); role != c.role {
+			t.Errorf("groups %v: expected %s, got %s", c.groups, c.role, role)
+		}
+	}
+}
+
+// 目录分组变更导致降级时撤销已签发的令牌，升级时不撤销
+func TestSyncRoleRevokesSessionsOnDemotion(t *testing.T) {
+	users := memoryUserRepository{}
+	alice := users.add("alice", repository.RoleModerator)
+	bob := users.add("bob", repository.RoleMember)
+	carol := users.add("carol", repository.RoleBanned)
+	sessions := memorySessionRepository{}
+	a := &ldapAuthenticator{userRepo: users, eventRepo: discardEventRepository{}, sessionRepo: sessions}
+
+	if err := a.syncRole(alice, repository.RoleMember, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, revoked := sessions[alice.ID]; !revoked || alice.Role != repository.RoleMember {
+		t.Errorf("expected demoted user to be revoked, got role %s", alice.Role)
+	}
+
+	if err := a.syncRole(bob, repository.RoleAdmin, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, revoked := sessions[bob.ID]; revoked || bob.Role != repository.RoleAdmin {
+		t.Errorf("expected promoted user to keep sessions, got role %s", bob.Role)
+	}
+
+	// 不覆盖本地的封禁
+	if err := a.syncRole(carol, repository.RoleMember, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if carol.Role != repository.RoleBanned {
+		t.Errorf("expected ban to be kept, got %s", carol.Role)
+	}
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"auth/internal/infra"
+	"auth/internal/repository"
+	"auth/internal/util"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"math/bits"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	ChallengeOff      string = "off"
+	ChallengeAdaptive string = "adaptive"
+	ChallengeAlways   string = "always"
+)
+
+// 请求中携带挑战结果的请求头，工作量证明和验证码任选其一
+const (
+	HeaderChallenge         = "X-Challenge"
+	HeaderChallengeSolution = "X-Challenge-Solution"
+	HeaderCaptchaToken      = "X-Captcha-Token"
+)
+
+type ChallengePolicy struct {
+	Mode string
+	// 工作量证明要求哈希开头为0的位数，每增加1位计算量翻倍
+	Difficulty int
+	// adaptive模式下同一IP或邮箱在Window内的请求超过Threshold次后要求完成挑战
+	Threshold int64
+	Window    time.Duration
+	// 签发的挑战的有效期
+	TTL time.Duration
+}
+
+var DefaultChallengePolicy = ChallengePolicy{
+	Mode:       ChallengeAdaptive,
+	Difficulty: 20,
+	Threshold:  5,
+	Window:     time.Hour,
+	TTL:        10 * time.Minute,
+}
+
+func (p ChallengePolicy) Validate() error {
+	if !slices.Contains([]string{ChallengeOff, ChallengeAdaptive, ChallengeAlways}, p.Mode) {
+		return fmt.Errorf("invalid challenge mode: %q", p.Mode)
+	}
+	if p.Difficulty < 1 || p.Difficulty > 32 {
+		return fmt.Errorf("challenge difficulty must be between 1 and 32: %d", p.Difficulty)
+	}
+	return nil
+}
+
+type ChallengeService interface {
+	Use(chi.Router)
+	NewChallenge(http.ResponseWriter, *http.Request) error
+	// 按策略判断本次请求是否需要完成挑战，需要时校验请求头中的结果
+	Require(r *http.Request, email string) error
+}
+
+type challengeService struct {
+	velocityRepo repository.VelocityRepository
+	policy       ChallengePolicy
+	secret       []byte
+	captcha      infra.CaptchaVerifier
+	// v1和v2共用同一个限流器
+	limiter func(http.Handler) http.Handler
+}
+
+// captcha为nil时只提供工作量证明
+func NewChallengeService(
+	velocityRepo repository.VelocityRepository,
+	policy ChallengePolicy,
+	secret string,
+	captcha infra.CaptchaVerifier,
+) ChallengeService {
+	return &challengeService{
+		velocityRepo: velocityRepo,
+		policy:       policy,
+		secret:       []byte(secret),
+		captcha:      captcha,
+		limiter:      util.RateLimiter(100),
+	}
+}
+
+func (s *challengeService) Use(router chi.Router) {
+	router.Use(s.limiter)
+	router.Get("/", util.EH(s.NewChallenge))
+}
+
+type captchaView struct {
+	Provider string `json:"provider"`
+	SiteKey  string `json:"site_key"`
+}
+
+func (s *challengeService) NewChallenge(w http.ResponseWriter, r *http.Request) error {
+	challenge, expiresAt, err := s.issue(time.Now())
+	if err != nil {
+		slog.Error("Failed to issue challenge", "error", err)
+		return util.InternalServerError(util.CodeChallengeIssueFailed)
+	}
+
+	var captcha *captchaView
+	if s.captcha != nil {
+		captcha = &captchaView{
+			Provider: s.captcha.Provider(),
+			SiteKey:  s.captcha.SiteKey(),
+		}
+	}
+	return util.RespondJson(w, &struct {
+		Challenge  string       `json:"challenge"`
+		Difficulty int          `json:"difficulty"`
+		ExpiresAt  time.Time    `json:"expires_at"`
+		Captcha    *captchaView `json:"captcha,omitempty"`
+	}{
+		Challenge:  challenge,
+		Difficulty: s.policy.Difficulty,
+		ExpiresAt:  expiresAt,
+		Captcha:    captcha,
+	})
+}
+
+// 挑战为"难度.过期时间.随机数.签名"，校验时不需要查询签发记录
+func (s *challengeService) issue(now time.Time) (string, time.Time, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := now.Add(s.policy.TTL).Truncate(time.Second)
+	payload := fmt.Sprintf(
+		"%d.%d.%s",
+		s.policy.Difficulty,
+		expiresAt.Unix(),
+		base64.RawURLEncoding.EncodeToString(nonce),
+	)
+	return payload + "." + s.sign(payload), expiresAt, nil
+}
+
+func (s *challengeService) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sha256(挑战+解)开头为0的位数
+func leadingZeroBits(challenge string, solution string) int {
+	sum := sha256.Sum256([]byte(challenge + solution))
+	zeros := 0
+	for _, b := range sum {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return zeros
+}
+
+// 校验签名、有效期和工作量，返回用于防止重复使用的随机数
+func (s *challengeService) verifyProofOfWork(challenge string, solution string, now time.Time) (string, bool) {
+	if len(solution) == 0 || len(solution) > 64 {
+		return "", false
+	}
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 4 {
+		return "", false
+	}
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(s.sign(payload))) {
+		return "", false
+	}
+	difficulty, err := strconv.Atoi(parts[0])
+	if err != nil || difficulty < s.policy.Difficulty {
+		return "", false
+	}
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.Unix() > expiresAt {
+		return "", false
+	}
+	if leadingZeroBits(challenge, solution) < difficulty {
+		return "", false
+	}
+	return parts[2], true
+}
+
+const (
+	velocityScopeChallengeIp    = "challenge_ip"
+	velocityScopeChallengeEmail = "challenge_email"
+	velocityScopeChallengeSpent = "challenge_spent"
+)
+
+// 计数失败时不要求挑战，以免Redis故障影响正常使用
+func (s *challengeService) exceeded(scope string, key string) bool {
+	if key == "" {
+		return false
+	}
+	count, err := s.velocityRepo.Hit(scope, key, s.policy.Window)
+	if err != nil {
+		return false
+	}
+	return count > s.policy.Threshold
+}
+
+func (s *challengeService) Require(r *http.Request, email string) error {
+	ip := util.GetRealIp(r)
+	switch s.policy.Mode {
+	case ChallengeOff:
+		return nil
+	case ChallengeAdaptive:
+		// 两个计数都需要更新，不能短路
+		ipExceeded := s.exceeded(velocityScopeChallengeIp, ip)
+		emailExceeded := s.exceeded(velocityScopeChallengeEmail, strings.ToLower(email))
+		if !ipExceeded && !emailExceeded {
+			return nil
+		}
+	}
+
+	if token := r.Header.Get(HeaderCaptchaToken); token != "" && s.captcha != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+		ok, err := s.captcha.Verify(ctx, token, ip)
+		if err != nil {
+			slog.Error("Captcha verification failed", "provider", s.captcha.Provider(), "error", err)
+			return util.InternalServerError(util.CodeChallengeVerifyFailed)
+		}
+		if !ok {
+			slog.Error("Invalid captcha token", "ip", ip, "email", email)
+			return util.Forbidden(util.CodeChallengeInvalid)
+		}
+		return nil
+	}
+
+	challenge := r.Header.Get(HeaderChallenge)
+	if challenge == "" {
+		slog.Error("Challenge required", "ip", ip, "email", email)
+		return util.Forbidden(util.CodeChallengeRequired)
+	}
+	nonce, ok := s.verifyProofOfWork(challenge, r.Header.Get(HeaderChallengeSolution), time.Now())
+	if !ok {
+		slog.Error("Invalid challenge solution", "ip", ip, "email", email)
+		return util.Forbidden(util.CodeChallengeInvalid)
+	}
+	// 每个挑战只能使用一次，记录保留到挑战过期
+	spent, err := s.velocityRepo.Hit(velocityScopeChallengeSpent, nonce, s.policy.TTL)
+	if err != nil {
+		return util.InternalServerError(util.CodeChallengeVerifyFailed)
+	}
+	if spent > 1 {
+		slog.Error("Challenge reused", "ip", ip, "email", email)
+		return util.Forbidden(util.CodeChallengeInvalid)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"auth/internal/util"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func solve(challenge string, difficulty int) string {
+	for i := 0; ; i++ {
+		solution := strconv.Itoa(i)
+		if leadingZeroBits(challenge, solution) >= difficulty {
+			return solution
+		}
+	}
+}
+
+func newTestChallengeService(mode string) *challengeService {
+	policy := DefaultChallengePolicy
+	policy.Mode = mode
+	policy.Difficulty = 8
+	policy.Threshold = 2
+	return NewChallengeService(memoryVelocityRepository{}, policy, "secret", nil).(*challengeService)
+}
+
+func TestProofOfWork(t *testing.T) {
+	s := newTestChallengeService(ChallengeAlways)
+	now := time.Now()
+	challenge, _, err := s.issue(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	solution := solve(challenge, 8)
+
+	if _, ok := s.verifyProofOfWork(challenge, solution, now); !ok {
+		t.Error("expected valid solution")
+	}
+	if _, ok := s.verifyProofOfWork(challenge, solution, now.Add(time.Hour)); ok {
+		t.Error("expected expired challenge")
+	}
+	if _, ok := s.verifyProofOfWork("1"+challenge[1:], solve("1"+challenge[1:], 1), now); ok {
+		t.Error("expected tampered challenge to be rejected")
+	}
+	other := NewChallengeService(memoryVelocityRepository{}, s.policy, "other", nil).(*challengeService)
+	if _, ok := other.verifyProofOfWork(challenge, solution, now); ok {
+		t.Error("expected challenge signed with another secret to be rejected")
+	}
+}
+
+func requireCode(t *testing.T, err error, code string) {
+	t.Helper()
+	var httpErr *util.HttpError
+	switch {
+	case code == "" && err != nil:
+		t.Errorf("unexpected error %v", err)
+	case code != "" && (!errors.As(err, &httpErr) || httpErr.Code != code):
+		t.Errorf("expected %s, got %v", code, err)
+	}
+}
+
+func TestRequireChallengeAdaptive(t *testing.T) {
+	s := newTestChallengeService(ChallengeAdaptive)
+
+	r := httptest.NewRequest("POST", "/otp/request", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	for range 2 {
+		requireCode(t, s.Require(r, "alice@example.com"), "")
+	}
+	requireCode(t, s.Require(r, "alice@example.com"), util.CodeChallengeRequired)
+
+	challenge, _, _ := s.issue(time.Now())
+	r.Header.Set(HeaderChallenge, challenge)
+	r.Header.Set(HeaderChallengeSolution, "wrong")
+	requireCode(t, s.Require(r, "alice@example.com"), util.CodeChallengeInvalid)
+
+	r.Header.Set(HeaderChallengeSolution, solve(challenge, 8))
+	requireCode(t, s.Require(r, "alice@example.com"), "")
+	// 同一个挑战不能重复使用
+	requireCode(t, s.Require(r, "alice@example.com"), util.CodeChallengeInvalid)
+
+	// 其他IP和邮箱不受影响
+	other := httptest.NewRequest("POST", "/otp/request", nil)
+	other.RemoteAddr = "198.51.100.1:1234"
+	requireCode(t, s.Require(other, "bob@example.com"), "")
+}
+
+type stubCaptcha struct{}
+
+func (stubCaptcha) Provider() string { return "stub" }
+func (stubCaptcha) SiteKey() string  { return "site" }
+func (stubCaptcha) Verify(ctx context.Context, token string, ip string) (bool, error) {
+	return token == "good-token", nil
+}
+
+func TestRequireChallengeCaptcha(t *testing.T) {
+	s := newTestChallengeService(ChallengeAlways)
+	s.captcha = stubCaptcha{}
+
+	r := httptest.NewRequest("POST", "/register", nil)
+	requireCode(t, s.Require(r, "alice@example.com"), util.CodeChallengeRequired)
+	r.Header.Set(HeaderCaptchaToken, "bad-token")
+	requireCode(t, s.Require(r, "alice@example.com"), util.CodeChallengeInvalid)
+	r.Header.Set(HeaderCaptchaToken, "good-token")
+	requireCode(t, s.Require(r, "alice@example.com"), "")
+
+	off := newTestChallengeService(ChallengeOff)
+	requireCode(t, off.Require(httptest.NewRequest("POST", "/register", nil), "alice@example.com"), "")
+}
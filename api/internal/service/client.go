@@ -0,0 +1,198 @@
+package service
+
+import (
+	"auth/internal/repository"
+	"auth/internal/util"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	EventCreateClient  string = "create-client"
+	EventDisableClient string = "disable-client"
+)
+
+var clientIdPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,63}$`)
+
+// 客户端密钥是高熵的随机串，不需要慢哈希；内省接口每次都要校验，慢哈希会被用来耗尽CPU
+const clientSecretHashPrefix = "sha256$"
+
+func hashClientSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return clientSecretHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// 早期的密钥以PBKDF2保存，校验通过后需要改为SHA-256，返回值upgrade表示需要更新
+func verifyClientSecret(hashed string, secret string) (valid bool, upgrade bool) {
+	if strings.HasPrefix(hashed, clientSecretHashPrefix) {
+		return subtle.ConstantTimeCompare([]byte(hashed), []byte(hashClientSecret(secret))) == 1, false
+	}
+	v, err := util.ValidateHash(hashed, secret)
+	if err != nil || !v.Valid {
+		return false, false
+	}
+	return true, true
+}
+
+type ClientView struct {
+	ClientId   string     `json:"client_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+}
+
+func newClientView(client *repository.Client) ClientView {
+	return ClientView{
+		ClientId:   client.ClientID,
+		Name:       client.Name,
+		Scopes:     repository.ClientScopes(client),
+		CreatedAt:  client.CreatedAt,
+		DisabledAt: client.DisabledAt,
+	}
+}
+
+type clientDetail struct {
+	ActorUser int64  `json:"actor_user"`
+	ClientId  string `json:"client_id"`
+	Name      string `json:"name,omitempty"`
+	Scopes    string `json:"scopes,omitempty"`
+}
+
+func (s *adminService) ListClients(w http.ResponseWriter, r *http.Request) error {
+	clients, err := s.clientRepo.List()
+	if err != nil {
+		slog.Error("Failed to list clients", "error", err)
+		return util.InternalServerError(util.CodeClientQueryFailed)
+	}
+
+	views := make([]ClientView, 0, len(clients))
+	for _, client := range clients {
+		views = append(views, newClientView(client))
+	}
+	return util.RespondJson(w, views)
+}
+
+func (s *adminService) CreateClient(w http.ResponseWriter, r *http.Request) error {
+	principal := util.GetPrincipal(r)
+
+	req, err := util.Body[struct {
+		ClientId string   `json:"client_id" validate:"required"`
+		Name     string   `json:"name" validate:"required,max=100"`
+		Scopes   []string `json:"scopes"`
+	}](r)
+	if err != nil {
+		slog.Error("Request body parse error", "error", err)
+		return err
+	}
+
+	// 不能授予客户端自己没有的权限
+	for _, scope := range req.Scopes {
+		if !principal.HasPermission(scope) {
+			return util.Forbidden(util.CodePermissionDenied)
+		}
+	}
+
+	client, secret, err := s.RegisterClient(principal.UserId, req.ClientId, req.Name, req.Scopes)
+	if err != nil {
+		return err
+	}
+
+	// 密钥只在创建时返回一次
+	w.Header().Set("Cache-Control", "no-store")
+	return util.RespondJson(w, struct {
+		ClientView
+		ClientSecret string `json:"client_secret"`
+	}{
+		ClientView:   newClientView(client),
+		ClientSecret: secret,
+	})
+}
+
+// 注册客户端并返回明文密钥，数据库中只保存密钥的哈希
+func (s *adminService) RegisterClient(actorId int64, clientId string, name string, scopes []string) (*repository.Client, string, error) {
+	if !clientIdPattern.MatchString(clientId) {
+		return nil, "", util.BadRequest(util.CodeClientIdInvalid)
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(repository.AllPermissions, scope) {
+			return nil, "", util.BadRequest(util.CodeScopeInvalid, scope)
+		}
+	}
+
+	existing, err := s.clientRepo.FindByClientId(clientId)
+	if err != nil {
+		slog.Error("Client lookup failed", "client_id", clientId, "error", err)
+		return nil, "", util.InternalServerError(util.CodeClientQueryFailed)
+	}
+	if existing != nil {
+		return nil, "", util.Conflict(util.CodeClientIdTaken)
+	}
+
+	secret := rand.Text()
+	client := &repository.Client{
+		ClientID:  clientId,
+		Name:      name,
+		Secret:    hashClientSecret(secret),
+		Scopes:    strings.Join(scopes, " "),
+		CreatedAt: time.Now(),
+	}
+	if err := s.clientRepo.Save(client); err != nil {
+		slog.Error("Failed to save client", "client_id", clientId, "error", err)
+		return nil, "", util.InternalServerError(util.CodeClientCreateFailed)
+	}
+
+	s.eventRepo.Save(
+		EventCreateClient,
+		&clientDetail{
+			ActorUser: actorId,
+			ClientId:  client.ClientID,
+			Name:      client.Name,
+			Scopes:    client.Scopes,
+		},
+	)
+	return client, secret, nil
+}
+
+func (s *adminService) DisableClient(w http.ResponseWriter, r *http.Request) error {
+	adminId := util.GetPrincipal(r).UserId
+
+	req, err := util.Body[struct {
+		ClientId string `json:"client_id" validate:"required"`
+	}](r)
+	if err != nil {
+		slog.Error("Request body parse error", "error", err)
+		return err
+	}
+
+	client, err := s.clientRepo.FindByClientId(req.ClientId)
+	if err != nil {
+		slog.Error("Client lookup failed", "client_id", req.ClientId, "error", err)
+		return util.InternalServerError(util.CodeClientQueryFailed)
+	}
+	if client == nil {
+		return util.NotFound(util.CodeClientNotFound)
+	}
+	if client.DisabledAt == nil {
+		if err := s.clientRepo.Disable(client); err != nil {
+			slog.Error("Failed to disable client", "client_id", client.ClientID, "error", err)
+			return util.InternalServerError(util.CodeClientDisableFailed)
+		}
+		s.eventRepo.Save(
+			EventDisableClient,
+			&clientDetail{
+				ActorUser: adminId,
+				ClientId:  client.ClientID,
+			},
+		)
+	}
+	return util.RespondJson(w, newClientView(client))
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"auth/internal/repository"
+	"auth/internal/util"
+	"crypto/rand"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	EventCreateInvite string = "create-invite"
+	EventRevokeInvite string = "revoke-invite"
+)
+
+const maxInviteUses = 1000
+
+type InviteView struct {
+	Id        int64      `json:"id"`
+	Code      string     `json:"code"`
+	CreatedBy int64      `json:"created_by"`
+	Note      string     `json:"note"`
+	MaxUses   int32      `json:"max_uses"`
+	Uses      int32      `json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+func newInviteView(invite *repository.Invite) InviteView {
+	return InviteView{
+		Id:        invite.ID,
+		Code:      invite.Code,
+		CreatedBy: invite.CreatedBy,
+		Note:      invite.Note,
+		MaxUses:   invite.MaxUses,
+		Uses:      invite.Uses,
+		ExpiresAt: invite.ExpiresAt,
+		CreatedAt: invite.CreatedAt,
+		RevokedAt: invite.RevokedAt,
+	}
+}
+
+type inviteEventDetail struct {
+	ActorUser int64      `json:"actor_user"`
+	InviteId  int64      `json:"invite_id"`
+	MaxUses   int32      `json:"max_uses,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func (s *adminService) ListInvites(w http.ResponseWriter, r *http.Request) error {
+	invites, err := s.inviteRepo.List()
+	if err != nil {
+		slog.Error("Failed to list invites", "error", err)
+		return util.InternalServerError(util.CodeInviteQueryFailed)
+	}
+
+	views := make([]InviteView, 0, len(invites))
+	for _, invite := range invites {
+		views = append(views, newInviteView(invite))
+	}
+	return util.RespondJson(w, views)
+}
+
+func (s *adminService) CreateInvite(w http.ResponseWriter, r *http.Request) error {
+	adminId := util.GetPrincipal(r).UserId
+
+	req, err := util.Body[struct {
+		MaxUses  int32  `json:"max_uses"`
+		Duration string `json:"duration"`
+		Note     string `json:"note" validate:"max=200"`
+	}](r)
+	if err != nil {
+		slog.Error("Request body parse error", "error", err)
+		return err
+	}
+
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+	if req.MaxUses < 0 || req.MaxUses > maxInviteUses {
+		return util.BadRequest(util.CodeInviteUsesInvalid)
+	}
+
+	// 不指定时长则不过期
+	now := time.Now()
+	var expiresAt *time.Time
+	if req.Duration != "" {
+		duration, err := util.ParseDuration(req.Duration)
+		if err != nil {
+			return err
+		}
+		t := now.Add(duration)
+		expiresAt = &t
+	}
+
+	invite := &repository.Invite{
+		Code:      rand.Text(),
+		CreatedBy: adminId,
+		Note:      req.Note,
+		MaxUses:   req.MaxUses,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	}
+	if err := s.inviteRepo.Save(invite); err != nil {
+		slog.Error("Failed to save invite", "error", err)
+		return util.InternalServerError(util.CodeInviteCreateFailed)
+	}
+
+	s.eventRepo.Save(
+		EventCreateInvite,
+		&inviteEventDetail{
+			ActorUser: adminId,
+			InviteId:  invite.ID,
+			MaxUses:   invite.MaxUses,
+			ExpiresAt: invite.ExpiresAt,
+		},
+	)
+	return util.RespondJson(w, newInviteView(invite))
+}
+
+func (s *adminService) RevokeInvite(w http.ResponseWriter, r *http.Request) error {
+	adminId := util.GetPrincipal(r).UserId
+
+	req, err := util.Body[struct {
+		Code string `json:"code" validate:"required"`
+	}](r)
+	if err != nil {
+		slog.Error("Request body parse error", "error", err)
+		return err
+	}
+
+	invite, err := s.inviteRepo.FindByCode(req.Code)
+	if err != nil {
+		slog.Error("Failed to find invite", "error", err)
+		return util.InternalServerError(util.CodeInviteQueryFailed)
+	}
+	if invite == nil {
+		return util.NotFound(util.CodeInviteNotFound)
+	}
+	if invite.RevokedAt == nil {
+		if err := s.inviteRepo.Revoke(invite); err != nil {
+			slog.Error("Failed to revoke invite", "id", invite.ID, "error", err)
+			return util.InternalServerError(util.CodeInviteRevokeFailed)
+		}
+		s.eventRepo.Save(
+			EventRevokeInvite,
+			&inviteEventDetail{
+				ActorUser: adminId,
+				InviteId:  invite.ID,
+			},
+		)
+	}
+	return util.RespondJson(w, newInviteView(invite))
+}
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"auth/internal/repository"
+	"auth/internal/util"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	EventRevokeToken string = "revoke-token"
+)
+
+// 供下游服务使用的客户端凭据授权（RFC 6749 4.4）、令牌内省（RFC 7662）和撤销（RFC 7009）接口
+type OAuthService interface {
+	Use(chi.Router)
+	Token(http.ResponseWriter, *http.Request) error
+	Introspect(http.ResponseWriter, *http.Request) error
+	Revoke(http.ResponseWriter, *http.Request) error
+}
+
+type oauthService struct {
+	clientRepo        repository.ClientRepository
+	tokenRepo         repository.TokenRepository
+	sessionRepo       repository.SessionRepository
+	personalTokenRepo repository.PersonalTokenRepository
+	eventRepo         repository.EventRepository
+}
+
+func NewOAuthService(
+	clientRepo repository.ClientRepository,
+	tokenRepo repository.TokenRepository,
+	sessionRepo repository.SessionRepository,
+	personalTokenRepo repository.PersonalTokenRepository,
+	eventRepo repository.EventRepository,
+) OAuthService {
+	s := &oauthService{
+		clientRepo:        clientRepo,
+		tokenRepo:         tokenRepo,
+		sessionRepo:       sessionRepo,
+		personalTokenRepo: personalTokenRepo,
+		eventRepo:         eventRepo,
+	}
+	return s
+}
+
+func (s *oauthService) Use(router chi.Router) {
+	router.Post("/token", util.EH(s.Token))
+	router.Post("/introspect", util.EH(s.Introspect))
+	router.Post("/revoke", util.EH(s.Revoke))
+}
+
+// 客户端通过HTTP Basic认证，或在表单中提交client_id和client_secret
+func (s *oauthService) authenticateClient(w http.ResponseWriter, r *http.Request) (*repository.Client, error) {
+	clientId, secret, ok := r.BasicAuth()
+	if !ok {
+		clientId = r.PostFormValue("client_id")
+		secret = r.PostFormValue("client_secret")
+	}
+
+	fail := func() error {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		return util.Unauthorized(util.CodeClientAuthFailed)
+	}
+	if clientId == "" || secret == "" {
+		return nil, fail()
+	}
+
+	client, err := s.clientRepo.FindByClientId(clientId)
+	if err != nil {
+		slog.Error("Client lookup failed", "client_id", clientId, "error", err)
+		return nil, util.InternalServerError(util.CodeClientQueryFailed)
+	}
+	if client == nil || client.DisabledAt != nil {
+		slog.Error("Client not found or disabled", "client_id", clientId)
+		return nil, fail()
+	}
+	valid, upgrade := verifyClientSecret(client.Secret, secret)
+	if !valid {
+		slog.Error("Client secret validation failed", "client_id", clientId)
+		return nil, fail()
+	}
+	if upgrade {
+		client.Secret = hashClientSecret(secret)
+		if err := s.clientRepo.UpdateSecret(client); err != nil {
+			slog.Warn("Failed to upgrade client secret hash", "client_id", clientId, "error", err)
+		}
+	}
+	return client, nil
+}
+
+// 未指定scope时授予客户端注册时的全部权限，否则只能申请其中的子集
+func (s *oauthService) Token(w http.ResponseWriter, r *http.Request) error {
+	client, err := s.authenticateClient(w, r)
+	if err != nil {
+		return err
+	}
+
+	if grantType := r.PostFormValue("grant_type"); grantType != "client_credentials" {
+		slog.Error("Unsupported grant type", "client_id", client.ClientID, "grant_type", grantType)
+		return util.BadRequest(util.CodeGrantTypeUnsupported)
+	}
+
+	allowed := repository.ClientScopes(client)
+	scopes := allowed
+	if requested := strings.Fields(r.PostFormValue("scope")); len(requested) > 0 {
+		for _, scope := range requested {
+			if !slices.Contains(allowed, scope) {
+				slog.Error("Scope not allowed", "client_id", client.ClientID, "scope", scope)
+				return util.BadRequest(util.CodeScopeInvalid, scope)
+			}
+		}
+		scopes = requested
+	}
+
+	slog.Info("Client token issued", "client_id", client.ClientID, "scopes", scopes)
+	return util.RespondClientToken(w, client.ClientID, scopes)
+}
+
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	TokenType string `json:"token_type,omitempty"`
+	ClientId  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Aud       string `json:"aud,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+}
+
+func (s *oauthService) Introspect(w http.ResponseWriter, r *http.Request) error {
+	client, err := s.authenticateClient(w, r)
+	if err != nil {
+		return err
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		return util.BadRequest(util.CodeTokenMissing)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	inactive := introspectionResponse{Active: false}
+
+	info, err := util.InspectToken(token, r.PostFormValue("token_type_hint"))
+	if errors.Is(err, util.ErrTokenStatusUnavailable) {
+		return util.InternalServerError(util.CodeTokenStatusQueryFailed)
+	} else if err != nil {
+		return util.RespondJson(w, inactive)
+	}
+
+	response := introspectionResponse{
+		Active:    true,
+		TokenType: info.Type,
+		ClientId:  info.App,
+		Username:  info.Username,
+		Role:      info.Role,
+		Scope:     strings.Join(info.Scopes, " "),
+		Aud:       info.App,
+		Exp:       info.ExpiresAt.Unix(),
+		Iat:       info.IssuedAt.Unix(),
+		Jti:       info.Id,
+	}
+
+	if info.ClientId != "" {
+		// 客户端停用后其机器令牌不再有效
+		tokenClient, err := s.clientRepo.FindByClientId(info.ClientId)
+		if err != nil {
+			slog.Error("Client lookup failed", "client_id", info.ClientId, "error", err)
+			return util.InternalServerError(util.CodeClientQueryFailed)
+		}
+		if tokenClient == nil || tokenClient.DisabledAt != nil {
+			return util.RespondJson(w, inactive)
+		}
+		response.Sub = info.ClientId
+	} else if info.Type == util.TokenTypePersonal {
+		// 个人令牌的角色和封禁状态在解析时已按用户当前状态检查
+		response.Sub = strconv.FormatInt(info.UserId, 10)
+	} else {
+		// 用户被封禁或修改角色时会撤销其全部会话，之前签发的令牌不再有效
+		revokedAt, err := s.sessionRepo.UserSessionsRevokedAt(info.UserId)
+		if err != nil {
+			return util.InternalServerError(util.CodeSessionQueryFailed)
+		}
+		if repository.SessionRevoked(info.IssuedAt, revokedAt) {
+			return util.RespondJson(w, inactive)
+		}
+		response.Sub = strconv.FormatInt(info.UserId, 10)
+	}
+
+	slog.Info("Token introspected", "client_id", client.ClientID, "sub", response.Sub, "jti", info.Id)
+	return util.RespondJson(w, response)
+}
+
+// 客户端只能撤销签发给自己的令牌（RFC 7009 2.1），即aud为其client_id的令牌。
+// 个人令牌不属于任何客户端，持有者可以直接使用它，撤销不会扩大权限，因此允许任意客户端撤销
+func (s *oauthService) Revoke(w http.ResponseWriter, r *http.Request) error {
+	client, err := s.authenticateClient(w, r)
+	if err != nil {
+		return err
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		return util.BadRequest(util.CodeTokenMissing)
+	}
+
+	// 按RFC 7009，无效或已失效的令牌同样视为撤销成功
+	info, err := util.InspectToken(token, r.PostFormValue("token_type_hint"))
+	if errors.Is(err, util.ErrTokenStatusUnavailable) {
+		return util.InternalServerError(util.CodeTokenStatusQueryFailed)
+	} else if err != nil {
+		return util.RespondText(w, "")
+	}
+	if info.Id == "" {
+		return util.BadRequest(util.CodeTokenNotRevocable)
+	}
+
+	if info.Type == util.TokenTypePersonal {
+		if err := s.revokePersonalToken(info); err != nil {
+			return err
+		}
+	} else {
+		if info.App != client.ClientID {
+			slog.Error("Token not issued to client", "client_id", client.ClientID, "aud", info.App, "jti", info.Id)
+			return util.BadRequest(util.CodeTokenClientMismatch)
+		}
+		if err := s.tokenRepo.RevokeToken(info.Id, info.ExpiresAt); err != nil {
+			return util.InternalServerError(util.CodeTokenRevokeFailed)
+		}
+	}
+
+	s.eventRepo.Save(
+		EventRevokeToken,
+		&struct {
+			ClientId   string `json:"client_id"`
+			ActorUser  int64  `json:"actor_user"`
+			TargetUser int64  `json:"target_user"`
+			TokenType  string `json:"token_type"`
+			Jti        string `json:"jti"`
+		}{
+			ClientId:   client.ClientID,
+			ActorUser:  repository.SystemUserId,
+			TargetUser: info.UserId,
+			TokenType:  info.Type,
+			Jti:        info.Id,
+		},
+	)
+	return util.RespondText(w, "")
+}
+
+// 个人令牌以数据库中的记录为准，撤销名单过期后令牌不能恢复有效
+func (s *oauthService) revokePersonalToken(info *util.TokenInfo) error {
+	id, err := strconv.ParseInt(strings.TrimPrefix(info.Id, util.PersonalTokenIdPrefix), 10, 64)
+	if err != nil {
+		slog.Error("Invalid personal token id", "jti", info.Id, "error", err)
+		return util.BadRequest(util.CodeTokenNotRevocable)
+	}
+	token, err := s.personalTokenRepo.FindById(id)
+	if err != nil {
+		slog.Error("Failed to find personal token", "id", id, "error", err)
+		return util.InternalServerError(util.CodePersonalTokenQueryFailed)
+	}
+	if token == nil || token.RevokedAt != nil {
+		return nil
+	}
+	if err := s.personalTokenRepo.Revoke(token); err != nil {
+		slog.Error("Failed to revoke personal token", "id", id, "error", err)
+		return util.InternalServerError(util.CodePersonalTokenRevokeFailed)
+	}
+	return nil
+}
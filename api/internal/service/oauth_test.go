@@ -0,0 +1,332 @@
+package service
+
+import (
+	"auth/internal/repository"
+	"auth/internal/util"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memoryClientRepository map[string]*repository.Client
+
+func (r memoryClientRepository) List() ([]*repository.Client, error) {
+	var clients []*repository.Client
+	for _, client := range r {
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+func (r memoryClientRepository) FindByClientId(clientId string) (*repository.Client, error) {
+	return r[clientId], nil
+}
+
+func (r memoryClientRepository) Save(client *repository.Client) error {
+	r[client.ClientID] = client
+	return nil
+}
+
+func (r memoryClientRepository) Disable(client *repository.Client) error {
+	now := time.Now()
+	client.DisabledAt = &now
+	return nil
+}
+
+func (r memoryClientRepository) UpdateSecret(client *repository.Client) error {
+	r[client.ClientID].Secret = client.Secret
+	return nil
+}
+
+type memoryTokenRepository map[string]time.Time
+
+func (r memoryTokenRepository) RevokeToken(jti string, expiresAt time.Time) error {
+	r[jti] = expiresAt
+	return nil
+}
+
+func (r memoryTokenRepository) IsTokenRevoked(jti string) (bool, error) {
+	_, ok := r[jti]
+	return ok, nil
+}
+
+type memorySessionRepository map[int64]time.Time
+
+func (r memorySessionRepository) RevokeUserSessions(userId int64) error {
+	r[userId] = time.Now()
+	return nil
+}
+
+func (r memorySessionRepository) UserSessionsRevokedAt(userId int64) (time.Time, error) {
+	return r[userId], nil
+}
+
+type discardEventRepository struct{}
+
+func (discardEventRepository) List(filter repository.EventFilter, beforeId, limit int64) ([]*repository.Event, error) {
+	return nil, nil
+}
+
+func (discardEventRepository) Save(action string, detail interface{}) error {
+	return nil
+}
+
+func newTestOAuthService(t *testing.T) (*oauthService, memoryClientRepository) {
+	t.Helper()
+	legacySecret, err := util.GenerateHash("legacy-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabledAt := time.Now()
+	clients := memoryClientRepository{
+		"reader":   {ClientID: "reader", Secret: hashClientSecret("reader-secret"), Scopes: "users:read events:read"},
+		"legacy":   {ClientID: "legacy", Secret: legacySecret},
+		"disabled": {ClientID: "disabled", Secret: hashClientSecret("disabled-secret"), DisabledAt: &disabledAt},
+	}
+	s := NewOAuthService(clients, memoryTokenRepository{}, memorySessionRepository{}, nil, discardEventRepository{})
+	return s.(*oauthService), clients
+}
+
+func oauthRequest(target string, form url.Values) *http.Request {
+	r := httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestVerifyClientSecret(t *testing.T) {
+	hashed := hashClientSecret("secret")
+	if valid, upgrade := verifyClientSecret(hashed, "secret"); !valid || upgrade {
+		t.Errorf("expected valid secret without upgrade, got %v %v", valid, upgrade)
+	}
+	if valid, _ := verifyClientSecret(hashed, "other"); valid {
+		t.Error("expected wrong secret to be rejected")
+	}
+
+	legacy, err := util.GenerateHash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid, upgrade := verifyClientSecret(legacy, "secret"); !valid || !upgrade {
+		t.Errorf("expected legacy secret to be valid and upgraded, got %v %v", valid, upgrade)
+	}
+	if valid, upgrade := verifyClientSecret(legacy, "other"); valid || upgrade {
+		t.Errorf("expected wrong legacy secret to be rejected, got %v %v", valid, upgrade)
+	}
+}
+
+func TestOAuthClientAuthentication(t *testing.T) {
+	s, clients := newTestOAuthService(t)
+	endpoints := map[string]func(http.ResponseWriter, *http.Request) error{
+		"/introspect": s.Introspect,
+		"/revoke":     s.Revoke,
+	}
+
+	for target, handler := range endpoints {
+		cases := []struct {
+			name     string
+			clientId string
+			secret   string
+			basic    bool
+			code     string
+		}{
+			{"missing credentials", "", "", false, util.CodeClientAuthFailed},
+			{"wrong secret", "reader", "wrong", true, util.CodeClientAuthFailed},
+			{"unknown client", "nobody", "reader-secret", true, util.CodeClientAuthFailed},
+			{"disabled client", "disabled", "disabled-secret", true, util.CodeClientAuthFailed},
+			{"basic auth", "reader", "reader-secret", true, ""},
+			{"form credentials", "reader", "reader-secret", false, ""},
+		}
+		for _, c := range cases {
+			form := url.Values{"token": {"not-a-token"}}
+			if !c.basic && c.clientId != "" {
+				form.Set("client_id", c.clientId)
+				form.Set("client_secret", c.secret)
+			}
+			r := oauthRequest(target, form)
+			if c.basic {
+				r.SetBasicAuth(c.clientId, c.secret)
+			}
+			w := httptest.NewRecorder()
+			err := handler(w, r)
+			requireCode(t, err, c.code)
+			if c.code != "" && w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("%s %s: expected WWW-Authenticate header", target, c.name)
+			}
+		}
+	}
+
+	// 早期以PBKDF2保存的密钥校验通过后改为SHA-256
+	r := oauthRequest("/introspect", url.Values{"token": {"not-a-token"}})
+	r.SetBasicAuth("legacy", "legacy-secret")
+	requireCode(t, s.Introspect(httptest.NewRecorder(), r), "")
+	if clients["legacy"].Secret != hashClientSecret("legacy-secret") {
+		t.Errorf("expected legacy secret hash to be upgraded, got %q", clients["legacy"].Secret)
+	}
+	r = oauthRequest("/introspect", url.Values{"token": {"not-a-token"}})
+	r.SetBasicAuth("legacy", "legacy-secret")
+	requireCode(t, s.Introspect(httptest.NewRecorder(), r), "")
+}
+
+type unavailableTokenRepository struct{}
+
+func (unavailableTokenRepository) RevokeToken(jti string, expiresAt time.Time) error {
+	return errors.New("redis: connection refused")
+}
+
+func (unavailableTokenRepository) IsTokenRevoked(jti string) (bool, error) {
+	return false, errors.New("redis: connection refused")
+}
+
+func issueTestClientToken(t *testing.T, clientId string, scopes []string) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := util.RespondClientToken(w, clientId, scopes); err != nil {
+		t.Fatal(err)
+	}
+	var response util.TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response.AccessToken
+}
+
+// 无法查询撤销状态时不能把令牌当作无效或撤销成功
+func TestOAuthTokenStatusUnavailable(t *testing.T) {
+	s, _ := newTestOAuthService(t)
+	token := issueTestClientToken(t, "reader", []string{"users:read"})
+
+	util.RevokedTokens = unavailableTokenRepository{}
+	defer func() { util.RevokedTokens = nil }()
+
+	for target, handler := range map[string]func(http.ResponseWriter, *http.Request) error{
+		"/introspect": s.Introspect,
+		"/revoke":     s.Revoke,
+	} {
+		r := oauthRequest(target, url.Values{"token": {token}})
+		r.SetBasicAuth("reader", "reader-secret")
+		requireCode(t, handler(httptest.NewRecorder(), r), util.CodeTokenStatusQueryFailed)
+	}
+}
+
+func requestClientToken(t *testing.T, s *oauthService, form url.Values) (util.TokenResponse, error) {
+	t.Helper()
+	r := oauthRequest("/token", form)
+	r.SetBasicAuth("reader", "reader-secret")
+	w := httptest.NewRecorder()
+	var response util.TokenResponse
+	if err := s.Token(w, r); err != nil {
+		return response, err
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response, nil
+}
+
+func TestOAuthTokenScopes(t *testing.T) {
+	s, _ := newTestOAuthService(t)
+
+	cases := []struct {
+		scope string
+		code  string
+		// 签发的令牌中的scope
+		granted string
+	}{
+		{"", "", "users:read events:read"},
+		{"events:read", "", "events:read"},
+		{"  events:read   users:read ", "", "events:read users:read"},
+		{"users:write", util.CodeScopeInvalid, ""},
+		{"users:read users:write", util.CodeScopeInvalid, ""},
+	}
+	for _, c := range cases {
+		response, err := requestClientToken(t, s, url.Values{"grant_type": {"client_credentials"}, "scope": {c.scope}})
+		requireCode(t, err, c.code)
+		if c.code == "" && response.Scope != c.granted {
+			t.Errorf("scope %q: expected %q, got %q", c.scope, c.granted, response.Scope)
+		}
+	}
+
+	_, err := requestClientToken(t, s, url.Values{"grant_type": {"password"}})
+	requireCode(t, err, util.CodeGrantTypeUnsupported)
+}
+
+// 客户端停用后，其已签发的令牌在内省时不再有效
+func TestIntrospectDisabledClientToken(t *testing.T) {
+	s, clients := newTestOAuthService(t)
+	response, err := requestClientToken(t, s, url.Values{"grant_type": {"client_credentials"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	introspect := func() introspectionResponse {
+		r := oauthRequest("/introspect", url.Values{"token": {response.AccessToken}})
+		r.SetBasicAuth("legacy", "legacy-secret")
+		w := httptest.NewRecorder()
+		requireCode(t, s.Introspect(w, r), "")
+		var result introspectionResponse
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return result
+	}
+
+	if result := introspect(); !result.Active || result.Sub != "reader" || result.Scope != "users:read events:read" {
+		t.Errorf("unexpected introspection %+v", result)
+	}
+	clients.Disable(clients["reader"])
+	if result := introspect(); result.Active {
+		t.Errorf("expected token of disabled client to be inactive, got %+v", result)
+	}
+}
+
+// 客户端只能撤销签发给自己的令牌
+func TestRevokeOtherClientToken(t *testing.T) {
+	s, _ := newTestOAuthService(t)
+	token := issueTestClientToken(t, "reader", []string{"users:read"})
+
+	revoke := func(clientId, secret string) error {
+		r := oauthRequest("/revoke", url.Values{"token": {token}})
+		r.SetBasicAuth(clientId, secret)
+		return s.Revoke(httptest.NewRecorder(), r)
+	}
+
+	requireCode(t, revoke("legacy", "legacy-secret"), util.CodeTokenClientMismatch)
+	if revoked := len(s.tokenRepo.(memoryTokenRepository)); revoked != 0 {
+		t.Errorf("expected token to stay active, got %d revoked", revoked)
+	}
+	requireCode(t, revoke("reader", "reader-secret"), "")
+	if revoked := len(s.tokenRepo.(memoryTokenRepository)); revoked != 1 {
+		t.Errorf("expected token to be revoked, got %d revoked", revoked)
+	}
+}
+
+// 个人令牌的角色按用户当前状态读取，不随会话撤销失效
+func TestIntrospectPersonalTokenAfterSessionRevoked(t *testing.T) {
+	s, _ := newTestOAuthService(t)
+	util.VerifyPersonalToken = func(token string) (*util.TokenInfo, error) {
+		return &util.TokenInfo{
+			Type:      util.TokenTypePersonal,
+			Id:        util.PersonalTokenIdPrefix + "1",
+			UserId:    7,
+			App:       util.PersonalTokenApp,
+			Role:      repository.RoleModerator,
+			IssuedAt:  time.Now().Add(-time.Hour),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}, nil
+	}
+	defer func() { util.VerifyPersonalToken = nil }()
+	s.sessionRepo.RevokeUserSessions(7)
+
+	r := oauthRequest("/introspect", url.Values{"token": {util.PersonalTokenPrefix + "secret"}})
+	r.SetBasicAuth("legacy", "legacy-secret")
+	w := httptest.NewRecorder()
+	requireCode(t, s.Introspect(w, r), "")
+	var result introspectionResponse
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if !result.Active || result.Sub != "7" || result.Role != repository.RoleModerator {
+		t.Errorf("expected active personal token, got %+v", result)
+	}
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"auth/internal/repository"
+	"auth/internal/util"
+	"auth/pkg/authclient"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EventCreatePersonalToken string = "create-personal-token"
+	EventRevokePersonalToken string = "revoke-personal-token"
+)
+
+const (
+	defaultPersonalTokenLifetime = 90 * 24 * time.Hour
+	maxPersonalTokenLifetime     = 365 * 24 * time.Hour
+	// 最近使用时间只需精确到分钟，避免每个请求都写数据库
+	personalTokenLastUsedInterval = time.Minute
+)
+
+var errPersonalTokenInvalid = errors.New("personal token invalid")
+
+type PersonalTokenView struct {
+	Id         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func newPersonalTokenView(token *repository.PersonalToken) PersonalTokenView {
+	return PersonalTokenView{
+		Id:         token.ID,
+		Name:       token.Name,
+		Scopes:     repository.PersonalTokenScopes(token),
+		CreatedAt:  token.CreatedAt,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		RevokedAt:  token.RevokedAt,
+	}
+}
+
+type personalTokenDetail struct {
+	ActorUser  int64  `json:"actor_user"`
+	TargetUser int64  `json:"target_user"`
+	TokenId    int64  `json:"token_id"`
+	Name       string `json:"name,omitempty"`
+}
+
+func hashPersonalToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// 个人令牌只能由用户本人使用登录得到的访问令牌管理，不能用机器令牌或个人令牌本身
+func requireLoginSession(principal *util.Principal) error {
+	if principal.IsClient() || util.IsPersonalToken(principal) {
+		return authclient.ErrForbidden
+	}
+	return nil
+}
+
+func (s *authService) ListPersonalTokens(w http.ResponseWriter, r *http.Request) error {
+	principal := util.GetPrincipal(r)
+
+	tokens, err := s.personalTokenRepo.ListByUser(principal.UserId)
+	if err != nil {
+		slog.Error("Failed to list personal tokens", "user_id", principal.UserId, "error", err)
+		return util.InternalServerError(util.CodePersonalTokenQueryFailed)
+	}
+
+	views := make([]PersonalTokenView, 0, len(tokens))
+	for _, token := range tokens {
+		views = append(views, newPersonalTokenView(token))
+	}
+	return util.RespondJson(w, views)
+}
+
+func (s *authService) CreatePersonalToken(w http.ResponseWriter, r *http.Request) error {
+	principal := util.GetPrincipal(r)
+
+	req, err := util.Body[struct {
+		Name     string   `json:"name" validate:"required,max=100"`
+		Scopes   []string `json:"scopes"`
+		Duration string   `json:"duration"`
+	}](r)
+	if err != nil {
+		slog.Error("Request body parse error", "error", err)
+		return err
+	}
+
+	// 与客户端相同，只接受已定义的权限，拼写错误的scope不会被静默保存
+	for _, scope := range req.Scopes {
+		if !slices.Contains(repository.AllPermissions, scope) {
+			return util.BadRequest(util.CodeScopeInvalid, scope)
+		}
+	}
+
+	lifetime := defaultPersonalTokenLifetime
+	if req.Duration != "" {
+		lifetime, err = util.ParseDuration(req.Duration)
+		if err != nil {
+			return err
+		}
+	}
+	if lifetime <= 0 || lifetime > maxPersonalTokenLifetime {
+		return util.BadRequest(util.CodePersonalTokenLifetimeInvalid)
+	}
+
+	plaintext := util.PersonalTokenPrefix + rand.Text()
+	now := time.Now()
+	token := &repository.PersonalToken{
+		UserID:    principal.UserId,
+		Name:      req.Name,
+		TokenHash: hashPersonalToken(plaintext),
+		Scopes:    strings.Join(req.Scopes, " "),
+		CreatedAt: now,
+		ExpiresAt: now.Add(lifetime),
+	}
+	if err := s.personalTokenRepo.Save(token); err != nil {
+		slog.Error("Failed to save personal token", "user_id", principal.UserId, "error", err)
+		return util.InternalServerError(util.CodePersonalTokenCreateFailed)
+	}
+
+	s.eventRepo.Save(
+		EventCreatePersonalToken,
+		&personalTokenDetail{
+			ActorUser:  principal.UserId,
+			TargetUser: principal.UserId,
+			TokenId:    token.ID,
+			Name:       token.Name,
+		},
+	)
+
+	// 令牌明文只在创建时返回一次
+	w.Header().Set("Cache-Control", "no-store")
+	return util.RespondJson(w, struct {
+		PersonalTokenView
+		Token string `json:"token"`
+	}{
+		PersonalTokenView: newPersonalTokenView(token),
+		Token:             plaintext,
+	})
+}
+
+func (s *authService) RevokePersonalToken(w http.ResponseWriter, r *http.Request) error {
+	principal := util.GetPrincipal(r)
+
+	req, err := util.Body[struct {
+		Id int64 `json:"id" validate:"required"`
+	}](r)
+	if err != nil {
+		slog.Error("Request body parse error", "error", err)
+		return err
+	}
+
+	token, err := s.personalTokenRepo.FindById(req.Id)
+	if err != nil {
+		slog.Error("Failed to find personal token", "id", req.Id, "error", err)
+		return util.InternalServerError(util.CodePersonalTokenQueryFailed)
+	}
+	if token == nil || token.UserID != principal.UserId {
+		return util.NotFound(util.CodePersonalTokenNotFound)
+	}
+
+	if token.RevokedAt == nil {
+		if err := s.personalTokenRepo.Revoke(token); err != nil {
+			slog.Error("Failed to revoke personal token", "id", token.ID, "error", err)
+			return util.InternalServerError(util.CodePersonalTokenRevokeFailed)
+		}
+		s.eventRepo.Save(
+			EventRevokePersonalToken,
+			&personalTokenDetail{
+				ActorUser:  principal.UserId,
+				TargetUser: principal.UserId,
+				TokenId:    token.ID,
+			},
+		)
+	}
+	return util.RespondJson(w, newPersonalTokenView(token))
+}
+
+// 供访问令牌校验中间件和令牌内省校验个人令牌，角色以用户当前角色为准
+func (s *authService) VerifyPersonalToken(plaintext string) (*util.TokenInfo, error) {
+	token, err := s.personalTokenRepo.FindByHash(hashPersonalToken(plaintext))
+	if err != nil {
+		slog.Error("Failed to find personal token", "error", err)
+		return nil, err
+	}
+	if token == nil || token.RevokedAt != nil || !token.ExpiresAt.After(time.Now()) {
+		return nil, errPersonalTokenInvalid
+	}
+
+	user, err := s.userRepo.FindById(token.UserID)
+	if err != nil {
+		slog.Error("User lookup failed", "user_id", token.UserID, "error", err)
+		return nil, err
+	}
+	if user == nil || user.Role == repository.RoleBanned {
+		return nil, errPersonalTokenInvalid
+	}
+
+	if token.LastUsedAt == nil || time.Since(*token.LastUsedAt) > personalTokenLastUsedInterval {
+		if err := s.personalTokenRepo.UpdateLastUsed(token); err != nil {
+			slog.Warn("Failed to update personal token last used", "id", token.ID, "error", err)
+		}
+	}
+
+	return &util.TokenInfo{
+		Type:      util.TokenTypePersonal,
+		Id:        util.PersonalTokenIdPrefix + strconv.FormatInt(token.ID, 10),
+		UserId:    user.ID,
+		Scopes:    repository.PersonalTokenScopes(token),
+		App:       util.PersonalTokenApp,
+		Username:  user.Username,
+		Role:      user.Role,
+		IssuedAt:  token.CreatedAt,
+		ExpiresAt: token.ExpiresAt,
+	}, nil
+}
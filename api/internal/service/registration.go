@@ -0,0 +1,115 @@
+package service
+
+import (
+	"auth/internal/repository"
+	"auth/internal/util"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+const (
+	RegistrationOpen   string = "open"
+	RegistrationInvite string = "invite"
+	RegistrationClosed string = "closed"
+)
+
+// 注册策略，同时作用于邮箱注册和第三方账号首次登录时的注册
+type RegistrationPolicy struct {
+	Mode string
+	// 不为空时只允许这些域名及其子域名的邮箱注册
+	AllowedDomains []string
+	// 优先于AllowedDomains
+	DeniedDomains []string
+	// 发送注册验证码和注册时执行，见risk.go
+	RiskChecks []RiskCheck
+}
+
+var DefaultRegistrationPolicy = RegistrationPolicy{
+	Mode: RegistrationOpen,
+}
+
+func (p RegistrationPolicy) Validate() error {
+	if !slices.Contains([]string{RegistrationOpen, RegistrationInvite, RegistrationClosed}, p.Mode) {
+		return fmt.Errorf("invalid registration mode: %q", p.Mode)
+	}
+	return nil
+}
+
+func domainMatches(domain string, patterns []string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		pattern = strings.ToLower(strings.TrimPrefix(pattern, "@"))
+		return domain == pattern || strings.HasSuffix(domain, "."+pattern)
+	})
+}
+
+// 检查注册是否开放以及邮箱域名是否允许，不涉及邀请码
+func (p RegistrationPolicy) checkEmail(email string) error {
+	if p.Mode == RegistrationClosed {
+		return util.Forbidden(util.CodeRegistrationClosed)
+	}
+
+	_, domain, _ := strings.Cut(strings.ToLower(email), "@")
+	if domainMatches(domain, p.DeniedDomains) ||
+		(len(p.AllowedDomains) > 0 && !domainMatches(domain, p.AllowedDomains)) {
+		slog.Error("Registration email domain denied", "email", email)
+		return util.Forbidden(util.CodeRegistrationEmailDenied)
+	}
+	return nil
+}
+
+// 检查注册策略并占用一次邀请码，返回的邀请码在注册失败时需要归还
+// 开放注册时邀请码可选，提供了仍会占用并记录
+func admitRegistration(
+	policy RegistrationPolicy,
+	inviteRepo repository.InviteRepository,
+	email string,
+	code string,
+) (*repository.Invite, error) {
+	if err := policy.checkEmail(email); err != nil {
+		return nil, err
+	}
+	if code == "" {
+		if policy.Mode == RegistrationInvite {
+			return nil, util.Forbidden(util.CodeInviteRequired)
+		}
+		return nil, nil
+	}
+
+	invite, err := inviteRepo.Use(code)
+	if err != nil {
+		slog.Error("Failed to use invite", "error", err)
+		return nil, util.InternalServerError(util.CodeInviteQueryFailed)
+	}
+	if invite == nil {
+		slog.Error("Invalid invite", "code", code)
+		return nil, util.BadRequest(util.CodeInviteInvalid)
+	}
+	return invite, nil
+}
+
+func releaseInvite(inviteRepo repository.InviteRepository, invite *repository.Invite) {
+	if invite == nil {
+		return
+	}
+	if err := inviteRepo.Release(invite); err != nil {
+		slog.Warn("Failed to release invite", "id", invite.ID, "error", err)
+	}
+}
+
+// 记录在register事件中，用于追溯邀请关系；只记录id，邀请码本身不出现在事件中
+type inviteDetail struct {
+	InviteId  int64 `json:"invite_id,omitempty"`
+	InvitedBy int64 `json:"invited_by,omitempty"`
+}
+
+func newInviteDetail(invite *repository.Invite) inviteDetail {
+	if invite == nil {
+		return inviteDetail{}
+	}
+	return inviteDetail{
+		InviteId:  invite.ID,
+		InvitedBy: invite.CreatedBy,
+	}
+}
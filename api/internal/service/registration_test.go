@@ -0,0 +1,47 @@
+package service
+
+import (
+	"auth/internal/util"
+	"errors"
+	"testing"
+)
+
+func TestRegistrationPolicyCheckEmail(t *testing.T) {
+	policy := RegistrationPolicy{
+		Mode:           RegistrationOpen,
+		AllowedDomains: []string{"example.com", "@school.edu"},
+		DeniedDomains:  []string{"spam.example.com"},
+	}
+
+	cases := []struct {
+		email string
+		code  string
+	}{
+		{"alice@example.com", ""},
+		{"alice@Mail.Example.com", ""},
+		{"bob@school.edu", ""},
+		{"eve@spam.example.com", util.CodeRegistrationEmailDenied},
+		{"eve@notexample.com", util.CodeRegistrationEmailDenied},
+		{"eve@gmail.com", util.CodeRegistrationEmailDenied},
+	}
+	for _, c := range cases {
+		err := policy.checkEmail(c.email)
+		var httpErr *util.HttpError
+		switch {
+		case c.code == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", c.email, err)
+		case c.code != "" && (!errors.As(err, &httpErr) || httpErr.Code != c.code):
+			t.Errorf("%s: expected %s, got %v", c.email, c.code, err)
+		}
+	}
+
+	closed := RegistrationPolicy{Mode: RegistrationClosed}
+	var httpErr *util.HttpError
+	if err := closed.checkEmail("alice@example.com"); !errors.As(err, &httpErr) || httpErr.Code != util.CodeRegistrationClosed {
+		t.Errorf("expected registration closed, got %v", err)
+	}
+
+	if err := (RegistrationPolicy{Mode: "private"}).Validate(); err == nil {
+		t.Error("expected invalid mode error")
+	}
+}
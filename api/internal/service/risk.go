@@ -0,0 +1,299 @@
+package service
+
+import (
+	"auth/internal/repository"
+	"auth/internal/util"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+)
+
+const EventRegisterBlocked string = "register_blocked"
+
+const (
+	riskStageOtp      = "otp"
+	riskStageRegister = "register"
+	riskStageSocial   = "social"
+)
+
+// 一次注册尝试，RequestOtp发送注册验证码和Register创建用户时各检查一次，
+// 第三方账号首次登录注册时检查一次
+type RegistrationAttempt struct {
+	App   string
+	Email string
+	Ip    string
+}
+
+// 注册风险检查，返回HttpError表示拒绝注册，
+// 其他错误表示检查本身不可用，此时放行以免影响正常注册
+type RiskCheck interface {
+	Name() string
+	Check(attempt RegistrationAttempt) error
+}
+
+// 需要在注册成功后记录结果的检查
+type riskRecorder interface {
+	Record(attempt RegistrationAttempt)
+}
+
+// 按顺序执行检查，被拒绝时记录register_blocked事件
+func screenRegistration(
+	checks []RiskCheck,
+	eventRepo repository.EventRepository,
+	stage string,
+	attempt RegistrationAttempt,
+) error {
+	for _, check := range checks {
+		err := check.Check(attempt)
+		if err == nil {
+			continue
+		}
+		var httpErr *util.HttpError
+		if !errors.As(err, &httpErr) {
+			slog.Warn("Registration risk check unavailable", "check", check.Name(), "error", err)
+			continue
+		}
+
+		slog.Error("Registration blocked", "check", check.Name(), "email", attempt.Email, "ip", attempt.Ip)
+		eventRepo.Save(
+			EventRegisterBlocked,
+			&struct {
+				App   string `json:"app,omitempty"`
+				Email string `json:"email"`
+				Ip    string `json:"ip"`
+				Stage string `json:"stage"`
+				Check string `json:"check"`
+				Code  string `json:"code"`
+			}{
+				App:   attempt.App,
+				Email: attempt.Email,
+				Ip:    attempt.Ip,
+				Stage: stage,
+				Check: check.Name(),
+				Code:  httpErr.Code,
+			},
+		)
+		return err
+	}
+	return nil
+}
+
+func recordRegistration(checks []RiskCheck, attempt RegistrationAttempt) {
+	for _, check := range checks {
+		if recorder, ok := check.(riskRecorder); ok {
+			recorder.Record(attempt)
+		}
+	}
+}
+
+func emailDomain(email string) string {
+	_, domain, _ := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+	return domain
+}
+
+// 常见的临时邮箱服务，可通过配置补充
+var DefaultDisposableDomains = []string{
+	"10minutemail.com",
+	"guerrillamail.com",
+	"guerrillamail.net",
+	"sharklasers.com",
+	"mailinator.com",
+	"maildrop.cc",
+	"yopmail.com",
+	"temp-mail.org",
+	"tempmail.com",
+	"throwawaymail.com",
+	"trashmail.com",
+	"getnada.com",
+	"dispostable.com",
+	"mohmal.com",
+	"emailondeck.com",
+	"fakeinbox.com",
+	"mailnesia.com",
+	"mintemail.com",
+	"spamgourmet.com",
+	"mail.tm",
+	"linshiyouxiang.net",
+	"027168.com",
+	"bccto.me",
+	"chacuo.net",
+}
+
+// 读取每行一个域名的列表文件，忽略空行和#开头的注释
+func ReadDomainList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var domains []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+	return domains, scanner.Err()
+}
+
+type disposableEmailCheck struct {
+	domains []string
+}
+
+func NewDisposableEmailCheck(domains []string) RiskCheck {
+	return &disposableEmailCheck{domains: domains}
+}
+
+func (c *disposableEmailCheck) Name() string {
+	return "disposable_email"
+}
+
+func (c *disposableEmailCheck) Check(attempt RegistrationAttempt) error {
+	if domainMatches(emailDomain(attempt.Email), c.domains) {
+		return util.Forbidden(util.CodeRegistrationDisposableEmail)
+	}
+	return nil
+}
+
+// net.Resolver满足此接口，测试中可替换为本地实现
+type MxResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+type mxCheck struct {
+	resolver MxResolver
+	timeout  time.Duration
+}
+
+// 检查邮箱域名是否有MX记录，不接受只有A记录的域名
+func NewMxCheck(resolver MxResolver, timeout time.Duration) RiskCheck {
+	return &mxCheck{resolver: resolver, timeout: timeout}
+}
+
+func (c *mxCheck) Name() string {
+	return "mx_record"
+}
+
+func (c *mxCheck) Check(attempt RegistrationAttempt) error {
+	domain := emailDomain(attempt.Email)
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	records, err := c.resolver.LookupMX(ctx, domain)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return util.BadRequest(util.CodeRegistrationEmailNoMx)
+	} else if err != nil && len(records) == 0 {
+		return fmt.Errorf("lookup mx for %s: %w", domain, err)
+	}
+	// RFC 7505的空MX记录表示该域名不接收邮件
+	for _, record := range records {
+		if record.Host != "." && record.Host != "" {
+			return nil
+		}
+	}
+	return util.BadRequest(util.CodeRegistrationEmailNoMx)
+}
+
+// 解析GetRealIp的结果，其中已经排除了客户端伪造的转发请求头
+func parseIp(value string) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+type ipReputationCheck struct {
+	prefixes []netip.Prefix
+}
+
+// entries为IP地址或CIDR网段，例如203.0.113.7、198.51.100.0/24
+func NewIpReputationCheck(entries []string) (RiskCheck, error) {
+	prefixes, err := util.ParseIpPrefixes(entries)
+	if err != nil {
+		return nil, err
+	}
+	return &ipReputationCheck{prefixes: prefixes}, nil
+}
+
+func (c *ipReputationCheck) Name() string {
+	return "ip_reputation"
+}
+
+func (c *ipReputationCheck) Check(attempt RegistrationAttempt) error {
+	addr, ok := parseIp(attempt.Ip)
+	if !ok {
+		return nil
+	}
+	for _, prefix := range c.prefixes {
+		if prefix.Contains(addr) {
+			return util.Forbidden(util.CodeRegistrationIpBlocked)
+		}
+	}
+	return nil
+}
+
+// IPv4按/24、IPv6按/64归为同一网段，同一网段的地址通常属于同一用户或机房
+func subnetOf(addr netip.Addr) netip.Prefix {
+	bits := 64
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix
+}
+
+const velocityScopeRegisterSubnet = "register_subnet"
+
+type subnetVelocityCheck struct {
+	velocityRepo repository.VelocityRepository
+	limit        int64
+	window       time.Duration
+}
+
+// 限制同一网段在window内成功注册的数量
+func NewSubnetVelocityCheck(velocityRepo repository.VelocityRepository, limit int64, window time.Duration) RiskCheck {
+	return &subnetVelocityCheck{
+		velocityRepo: velocityRepo,
+		limit:        limit,
+		window:       window,
+	}
+}
+
+func (c *subnetVelocityCheck) Name() string {
+	return "subnet_velocity"
+}
+
+func (c *subnetVelocityCheck) Check(attempt RegistrationAttempt) error {
+	addr, ok := parseIp(attempt.Ip)
+	if !ok {
+		return nil
+	}
+	count, err := c.velocityRepo.Count(velocityScopeRegisterSubnet, subnetOf(addr).String())
+	if err != nil {
+		return err
+	}
+	if count >= c.limit {
+		return util.TooManyRequests(util.CodeRegistrationTooFrequent)
+	}
+	return nil
+}
+
+func (c *subnetVelocityCheck) Record(attempt RegistrationAttempt) {
+	addr, ok := parseIp(attempt.Ip)
+	if !ok {
+		return
+	}
+	c.velocityRepo.Hit(velocityScopeRegisterSubnet, subnetOf(addr).String(), c.window)
+}
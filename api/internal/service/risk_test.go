@@ -0,0 +1,101 @@
+package service
+
+import (
+	"auth/internal/util"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// 本地的假DNS，不依赖网络
+type stubResolver map[string][]*net.MX
+
+func (r stubResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if name == "timeout.example" {
+		return nil, &net.DNSError{Err: "i/o timeout", Name: name, IsTimeout: true}
+	}
+	records, ok := r[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+func checkCode(t *testing.T, check RiskCheck, attempt RegistrationAttempt, code string) {
+	t.Helper()
+	err := check.Check(attempt)
+	var httpErr *util.HttpError
+	switch {
+	case code == "" && errors.As(err, &httpErr):
+		t.Errorf("%s %+v: unexpected rejection %s", check.Name(), attempt, httpErr.Code)
+	case code != "" && (!errors.As(err, &httpErr) || httpErr.Code != code):
+		t.Errorf("%s %+v: expected %s, got %v", check.Name(), attempt, code, err)
+	}
+}
+
+func TestDisposableEmailCheck(t *testing.T) {
+	check := NewDisposableEmailCheck(DefaultDisposableDomains)
+	checkCode(t, check, RegistrationAttempt{Email: "a@mailinator.com"}, util.CodeRegistrationDisposableEmail)
+	checkCode(t, check, RegistrationAttempt{Email: "a@eu.Mailinator.com"}, util.CodeRegistrationDisposableEmail)
+	checkCode(t, check, RegistrationAttempt{Email: "a@example.com"}, "")
+}
+
+func TestMxCheck(t *testing.T) {
+	check := NewMxCheck(stubResolver{
+		"example.com": {{Host: "mx.example.com.", Pref: 10}},
+		"nomail.com":  {{Host: ".", Pref: 0}},
+	}, time.Second)
+
+	checkCode(t, check, RegistrationAttempt{Email: "a@example.com"}, "")
+	checkCode(t, check, RegistrationAttempt{Email: "a@nomail.com"}, util.CodeRegistrationEmailNoMx)
+	checkCode(t, check, RegistrationAttempt{Email: "a@missing.com"}, util.CodeRegistrationEmailNoMx)
+	// DNS不可用时放行
+	if err := check.Check(RegistrationAttempt{Email: "a@timeout.example"}); err == nil {
+		t.Error("expected lookup error")
+	}
+	checkCode(t, check, RegistrationAttempt{Email: "a@timeout.example"}, "")
+}
+
+func TestIpReputationCheck(t *testing.T) {
+	check, err := NewIpReputationCheck([]string{"203.0.113.7", "198.51.100.0/24", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCode(t, check, RegistrationAttempt{Ip: "203.0.113.7"}, util.CodeRegistrationIpBlocked)
+	checkCode(t, check, RegistrationAttempt{Ip: "198.51.100.20"}, util.CodeRegistrationIpBlocked)
+	checkCode(t, check, RegistrationAttempt{Ip: "::ffff:198.51.100.1"}, util.CodeRegistrationIpBlocked)
+	checkCode(t, check, RegistrationAttempt{Ip: "2001:db8::1"}, util.CodeRegistrationIpBlocked)
+	// Ip已由GetRealIp解析，不再从转发列表中取地址
+	checkCode(t, check, RegistrationAttempt{Ip: "198.51.100.20, 10.0.0.1"}, "")
+	checkCode(t, check, RegistrationAttempt{Ip: "203.0.113.8"}, "")
+	checkCode(t, check, RegistrationAttempt{Ip: "unknown"}, "")
+
+	if _, err := NewIpReputationCheck([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("expected invalid prefix error")
+	}
+}
+
+type memoryVelocityRepository map[string]int64
+
+func (r memoryVelocityRepository) Count(scope string, key string) (int64, error) {
+	return r[scope+":"+key], nil
+}
+
+func (r memoryVelocityRepository) Hit(scope string, key string, window time.Duration) (int64, error) {
+	r[scope+":"+key]++
+	return r[scope+":"+key], nil
+}
+
+func TestSubnetVelocityCheck(t *testing.T) {
+	check := NewSubnetVelocityCheck(memoryVelocityRepository{}, 2, time.Hour)
+	recorder := check.(riskRecorder)
+
+	for _, ip := range []string{"192.0.2.1", "192.0.2.200"} {
+		checkCode(t, check, RegistrationAttempt{Ip: ip}, "")
+		recorder.Record(RegistrationAttempt{Ip: ip})
+	}
+	checkCode(t, check, RegistrationAttempt{Ip: "192.0.2.99"}, util.CodeRegistrationTooFrequent)
+	checkCode(t, check, RegistrationAttempt{Ip: "192.0.3.1"}, "")
+}
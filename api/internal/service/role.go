@@ -0,0 +1,87 @@
+package service
+
+import (
+	"auth/internal/repository"
+	"auth/internal/util"
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+const EventUnbanUser string = "unban-user"
+
+// 角色从低到高，下游服务按令牌中的角色授权，降级后需要撤销已签发的令牌
+var roleRanks = map[string]int{
+	repository.RoleBanned:     0,
+	repository.RoleRestricted: 1,
+	repository.RoleMember:     2,
+	repository.RoleTrusted:    3,
+	repository.RoleModerator:  4,
+	repository.RoleAdmin:      5,
+}
+
+func isDemotion(from, to string) bool {
+	return roleRanks[to] < roleRanks[from]
+}
+
+// 临时封禁或限制到期后恢复之前的角色，并以系统身份记录事件
+func restoreExpiredRole(
+	userRepo repository.UserRepository,
+	eventRepo repository.EventRepository,
+	user *repository.User,
+) error {
+	if user.RoleExpiresAt == nil || user.RoleExpiresAt.After(time.Now()) {
+		return nil
+	}
+
+	fromRole := user.Role
+	restored, err := userRepo.RestoreExpiredRole(user)
+	if err != nil {
+		slog.Error("Failed to restore expired role", "user_id", user.ID, "error", err)
+		return err
+	}
+	if !restored {
+		return nil
+	}
+
+	eventRepo.Save(
+		EventUnbanUser,
+		&roleChangeDetail{
+			ActorUser:  repository.SystemUserId,
+			TargetUser: user.ID,
+			FromRole:   fromRole,
+			ToRole:     user.Role,
+			Reason:     "处罚到期",
+		},
+	)
+	return nil
+}
+
+// 被封禁的用户不能获取令牌，错误信息中附带封禁原因和到期时间
+func checkNotBanned(eventRepo repository.EventRepository, user *repository.User) error {
+	if user.Role != repository.RoleBanned {
+		return nil
+	}
+
+	reason := ""
+	events, err := eventRepo.List(repository.EventFilter{
+		TargetUser: &user.ID,
+		Action:     EventBanUser,
+	}, 0, 1)
+	if err != nil {
+		slog.Error("Failed to find ban event", "user_id", user.ID, "error", err)
+	} else if len(events) > 0 {
+		var detail roleChangeDetail
+		if json.Unmarshal([]byte(events[0].Detail), &detail) == nil {
+			reason = detail.Reason
+		}
+	}
+
+	slog.Error("Banned user denied", "user_id", user.ID)
+	details := map[string]any{"reason": reason}
+	if user.RoleExpiresAt == nil {
+		return util.Forbidden(util.CodeUserBannedPermanent, reason).WithDetails(details)
+	}
+	details["expires_at"] = user.RoleExpiresAt
+	return util.Forbidden(util.CodeUserBannedUntil, reason, user.RoleExpiresAt.Format(time.DateTime+" MST")).WithDetails(details)
+}
@@ -0,0 +1,632 @@
+package service
+
+import (
+	"auth/internal/infra"
+	"auth/internal/repository"
+	"auth/internal/util"
+	"auth/pkg/authclient"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	EventLinkIdentity   string = "link-identity"
+	EventUnlinkIdentity string = "unlink-identity"
+)
+
+// 通过GitHub、Google、QQ等第三方账号登录，以及在账号设置中绑定和解绑第三方账号
+type SocialService interface {
+	Use(chi.Router)
+	ListProviders(http.ResponseWriter, *http.Request) error
+	Authorize(http.ResponseWriter, *http.Request) error
+	Callback(http.ResponseWriter, *http.Request) error
+	Signup(http.ResponseWriter, *http.Request) error
+	ListIdentities(http.ResponseWriter, *http.Request) error
+	Link(http.ResponseWriter, *http.Request) error
+	Unlink(http.ResponseWriter, *http.Request) error
+}
+
+type socialService struct {
+	userRepo           repository.UserRepository
+	eventRepo          repository.EventRepository
+	otpRepo            repository.OtpRepository
+	verifier           *authclient.Verifier
+	identityRepo       repository.IdentityRepository
+	socialRepo         repository.SocialRepository
+	inviteRepo         repository.InviteRepository
+	registrationPolicy RegistrationPolicy
+	providers          map[string]infra.IdentityProvider
+	// 第三方授权后的回调地址，其中的{provider}替换为登录方式名称
+	callbackUrl string
+}
+
+func NewSocialService(
+	userRepo repository.UserRepository,
+	eventRepo repository.EventRepository,
+	otpRepo repository.OtpRepository,
+	verifier *authclient.Verifier,
+	identityRepo repository.IdentityRepository,
+	socialRepo repository.SocialRepository,
+	inviteRepo repository.InviteRepository,
+	registrationPolicy RegistrationPolicy,
+	providers []infra.IdentityProvider,
+	callbackUrl string,
+) SocialService {
+	s := &socialService{
+		userRepo:           userRepo,
+		eventRepo:          eventRepo,
+		otpRepo:            otpRepo,
+		verifier:           verifier,
+		identityRepo:       identityRepo,
+		socialRepo:         socialRepo,
+		inviteRepo:         inviteRepo,
+		registrationPolicy: registrationPolicy,
+		providers:          make(map[string]infra.IdentityProvider, len(providers)),
+		callbackUrl:        callbackUrl,
+	}
+	for _, provider := range providers {
+		s.providers[provider.Name()] = provider
+	}
+	return s
+}
+
+func (s *socialService) Use(router chi.Router) {
+	router.Get("/providers", util.EH(s.ListProviders))
+	router.Get("/{provider}/authorize", util.EH(s.Authorize))
+	router.Get("/{provider}/callback", util.EH(s.Callback))
+	router.Post("/signup", util.EH(s.Signup))
+
+	router.Group(func(router chi.Router) {
+		router.Use(s.verifier.Middleware(requireLoginSession))
+		router.Get("/identities", util.EH(s.ListIdentities))
+		router.Post("/{provider}/link", util.EH(s.Link))
+		router.Post("/unlink", util.EH(s.Unlink))
+	})
+}
+
+type IdentityView struct {
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newIdentityView(identity *repository.Identity) IdentityView {
+	return IdentityView{
+		Provider:  identity.Provider,
+		Email:     identity.Email,
+		CreatedAt: identity.CreatedAt,
+	}
+}
+
+type identityDetail struct {
+	ActorUser  int64  `json:"actor_user"`
+	TargetUser int64  `json:"target_user"`
+	Provider   string `json:"provider"`
+	Subject    string `json:"subject"`
+}
+
+func (s *socialService) provider(r *http.Request) (infra.IdentityProvider, error) {
+	provider, ok := s.providers[chi.URLParam(r, "provider")]
+	if !ok {
+		return nil, util.NotFound(util.CodeSocialProviderUnknown)
+	}
+	return provider, nil
+}
+
+func (s *socialService) redirectUri(provider infra.IdentityProvider) string {
+	return strings.ReplaceAll(s.callbackUrl, "{provider}", provider.Name())
+}
+
+// 发起授权的浏览器保存的随机值，回调时与授权请求中的哈希比较
+const socialNonceCookieName = "social-nonce"
+
+func hashSocialNonce(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
+
+// 第三方回调是跨站跳转，SameSite必须为Lax才会携带Cookie
+func setSocialNonce(w http.ResponseWriter, nonce string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     socialNonceCookieName,
+		Value:    nonce,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// 授权请求只能由发起它的浏览器完成，否则攻击者可以让受害者登录攻击者的账号，
+// 或把攻击者的第三方账号绑定到受害者
+func socialNonceMatches(r *http.Request, login *repository.SocialLogin) bool {
+	cookie, err := r.Cookie(socialNonceCookieName)
+	if err != nil || cookie.Value == "" || login.NonceHash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashSocialNonce(cookie.Value)), []byte(login.NonceHash)) == 1
+}
+
+// 保存授权请求并返回第三方授权页面的地址，state和PKCE的code_verifier均为随机值，
+// 同时在浏览器中设置只有回调时才能取回的随机值
+func (s *socialService) authCodeUrl(
+	w http.ResponseWriter,
+	provider infra.IdentityProvider,
+	login *repository.SocialLogin,
+) (string, error) {
+	state := rand.Text()
+	nonce := rand.Text()
+	login.Provider = provider.Name()
+	login.CodeVerifier = rand.Text() + rand.Text()
+	login.NonceHash = hashSocialNonce(nonce)
+	if err := s.socialRepo.SaveLogin(state, login); err != nil {
+		return "", util.InternalServerError(util.CodeSocialStateFailed)
+	}
+	setSocialNonce(w, nonce, int(repository.SocialStateTTL.Seconds()))
+	return provider.AuthCodeURL(state, login.CodeVerifier, s.redirectUri(provider)), nil
+}
+
+func (s *socialService) ListProviders(w http.ResponseWriter, r *http.Request) error {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return util.RespondJson(w, names)
+}
+
+func (s *socialService) Authorize(w http.ResponseWriter, r *http.Request) error {
+	provider, err := s.provider(r)
+	if err != nil {
+		return err
+	}
+	app := util.QueryString(r, "app")
+	if app == nil {
+		return util.BadRequest(util.CodeSocialAppMissing)
+	}
+
+	url, err := s.authCodeUrl(w, provider, &repository.SocialLogin{App: *app})
+	if err != nil {
+		return err
+	}
+	http.Redirect(w, r, url, http.StatusFound)
+	return nil
+}
+
+func (s *socialService) Callback(w http.ResponseWriter, r *http.Request) error {
+	provider, err := s.provider(r)
+	if err != nil {
+		return err
+	}
+
+	query := r.URL.Query()
+	login, err := s.socialRepo.TakeLogin(query.Get("state"))
+	if err != nil {
+		return util.InternalServerError(util.CodeSocialStateFailed)
+	}
+	if login == nil || login.Provider != provider.Name() {
+		slog.Error("Social login state invalid", "provider", provider.Name())
+		return util.BadRequest(util.CodeSocialStateInvalid)
+	}
+	if !socialNonceMatches(r, login) {
+		slog.Error("Social login nonce mismatch", "provider", provider.Name())
+		return util.BadRequest(util.CodeSocialStateInvalid)
+	}
+	setSocialNonce(w, "", -1)
+	if query.Get("error") != "" || query.Get("code") == "" {
+		slog.Error("Social authorization denied", "provider", provider.Name(), "error", query.Get("error"))
+		return util.BadRequest(util.CodeSocialAuthorizationDenied)
+	}
+
+	profile, err := provider.Exchange(r.Context(), query.Get("code"), login.CodeVerifier, s.redirectUri(provider))
+	if err != nil {
+		slog.Error("Failed to exchange authorization code", "provider", provider.Name(), "error", err)
+		return util.NewHttpError(http.StatusBadGateway, util.CodeSocialProviderFailed)
+	}
+
+	identity, err := s.identityRepo.Find(provider.Name(), profile.Subject)
+	if err != nil {
+		slog.Error("Failed to find identity", "provider", provider.Name(), "error", err)
+		return util.InternalServerError(util.CodeIdentityQueryFailed)
+	}
+
+	if login.LinkUserId != 0 {
+		return s.link(w, login.LinkUserId, provider.Name(), profile, identity)
+	}
+	if identity != nil {
+		user, err := s.userRepo.FindById(identity.UserID)
+		if err != nil || user == nil {
+			slog.Error("User lookup failed", "user_id", identity.UserID, "error", err)
+			return util.InternalServerError(util.CodeUserQueryFailed)
+		}
+		return s.login(w, r, login.App, provider.Name(), user)
+	}
+
+	signup := &repository.SocialSignup{
+		Provider: provider.Name(),
+		App:      login.App,
+		Subject:  profile.Subject,
+		Username: profile.Username,
+		Email:    profile.Email,
+	}
+	return s.signup(w, r, signup)
+}
+
+// 第三方账号首次登录时，用户名可用且第三方提供了已验证的邮箱则直接注册，
+// 否则返回注册凭证，由用户补充信息后调用Signup完成注册
+func (s *socialService) signup(w http.ResponseWriter, r *http.Request, signup *repository.SocialSignup) error {
+	if s.registrationPolicy.Mode == RegistrationClosed {
+		return util.Forbidden(util.CodeRegistrationClosed)
+	}
+	inviteRequired := s.registrationPolicy.Mode == RegistrationInvite
+
+	if signup.Email != "" {
+		if err := s.registrationPolicy.checkEmail(signup.Email); err != nil {
+			return err
+		}
+
+		// 不自动绑定到同一邮箱的已有账号，需要用户登录后主动绑定
+		existing, err := s.userRepo.FindByEmail(signup.Email)
+		if err != nil {
+			slog.Error("User lookup failed", "email", signup.Email, "error", err)
+			return util.InternalServerError(util.CodeEmailCheckFailed)
+		}
+		if existing != nil {
+			slog.Error("Social email already registered", "email", signup.Email)
+			return util.Conflict(util.CodeSocialEmailTaken)
+		}
+
+		if !inviteRequired && usernameAcceptable(signup.Username) {
+			existing, err := s.userRepo.FindByUsername(signup.Username)
+			if err != nil {
+				slog.Error("User lookup failed", "username", signup.Username, "error", err)
+				return util.InternalServerError(util.CodeUserQueryFailed)
+			}
+			if existing == nil {
+				return s.register(w, r, signup, signup.Username, signup.Email, "")
+			}
+		}
+	}
+
+	ticket := rand.Text()
+	if err := s.socialRepo.SaveSignup(ticket, signup); err != nil {
+		return util.InternalServerError(util.CodeSocialStateFailed)
+	}
+	return util.RespondJson(w, struct {
+		SignupRequired bool   `json:"signup_required"`
+		SignupTicket   string `json:"signup_ticket"`
+		Username       string `json:"username"`
+		Email          string `json:"email"`
+		EmailRequired  bool   `json:"email_required"`
+		InviteRequired bool   `json:"invite_required"`
+	}{
+		SignupRequired: true,
+		SignupTicket:   ticket,
+		Username:       signup.Username,
+		Email:          signup.Email,
+		EmailRequired:  signup.Email == "",
+		InviteRequired: inviteRequired,
+	})
+}
+
+// 与Register相同的用户名规则
+func usernameAcceptable(username string) bool {
+	length := utf8.RuneCountInString(username)
+	return length >= 2 && length <= 16 && util.ValidUsername(username) == nil
+}
+
+func (s *socialService) Signup(w http.ResponseWriter, r *http.Request) error {
+	req, err := util.Body[struct {
+		Ticket   string `json:"ticket" validate:"required"`
+		Invite   string `json:"invite" validate:"max=64"`
+		Username string `json:"username" validate:"required,min=2,max=16"`
+		Email    string `json:"email" validate:"omitempty,email"`
+		Otp      string `json:"otp" validate:"omitempty,numeric,len=6"`
+	}](r)
+	if err != nil {
+		slog.Error("Request body parse error", "error", err)
+		return err
+	}
+	if err := util.ValidUsername(req.Username); err != nil {
+		slog.Error("Invalid username", "username", req.Username, "error", err)
+		return err
+	}
+
+	signup, err := s.socialRepo.FindSignup(req.Ticket)
+	if err != nil {
+		return util.InternalServerError(util.CodeSocialStateFailed)
+	}
+	if signup == nil {
+		return util.BadRequest(util.CodeSignupTicketInvalid)
+	}
+
+	// 第三方没有提供已验证的邮箱时，与普通注册一样通过验证码验证邮箱
+	email := signup.Email
+	if email == "" {
+		if req.Email == "" || !s.otpRepo.CheckOtp(repository.OtpVerify, req.Email, req.Otp) {
+			slog.Error("Invalid OTP", "email", req.Email)
+			return util.BadRequest(util.CodeOtpInvalid)
+		}
+		email = req.Email
+	}
+
+	if err := s.register(w, r, signup, req.Username, email, req.Invite); err != nil {
+		return err
+	}
+	if err := s.socialRepo.DeleteSignup(req.Ticket); err != nil {
+		slog.Warn("Failed to delete social signup", "error", err)
+	}
+	return nil
+}
+
+// 注册没有密码的用户并绑定第三方账号，之后可通过重置密码设置密码
+func (s *socialService) register(
+	w http.ResponseWriter,
+	r *http.Request,
+	signup *repository.SocialSignup,
+	username string,
+	email string,
+	inviteCode string,
+) error {
+	attempt := RegistrationAttempt{
+		App:   signup.App,
+		Email: email,
+		Ip:    util.GetRealIp(r),
+	}
+	if err := screenRegistration(s.registrationPolicy.RiskChecks, s.eventRepo, riskStageSocial, attempt); err != nil {
+		return err
+	}
+	invite, err := admitRegistration(s.registrationPolicy, s.inviteRepo, email, inviteCode)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	user := &repository.User{
+		Username:  username,
+		Email:     email,
+		Role:      repository.RoleMember,
+		CreatedAt: now,
+		LastLogin: now,
+		Attr:      "{}",
+	}
+	identity := &repository.Identity{
+		Provider:  signup.Provider,
+		Subject:   signup.Subject,
+		Email:     signup.Email,
+		CreatedAt: now,
+	}
+	if err := saveNewUserWithIdentity(s.userRepo, user, identity); err != nil {
+		releaseInvite(s.inviteRepo, invite)
+		return err
+	}
+	recordRegistration(s.registrationPolicy.RiskChecks, attempt)
+
+	s.eventRepo.Save(
+		EventRegister,
+		&struct {
+			App        string `json:"app"`
+			ActorUser  int64  `json:"actor_user"`
+			TargetUser int64  `json:"target_user"`
+			Provider   string `json:"provider"`
+			Ip         string `json:"ip"`
+			inviteDetail
+		}{
+			App:          signup.App,
+			ActorUser:    user.ID,
+			TargetUser:   user.ID,
+			Provider:     signup.Provider,
+			Ip:           attempt.Ip,
+			inviteDetail: newInviteDetail(invite),
+		},
+	)
+
+	return util.RespondAuthTokens(w, r, util.TokenOptions{
+		App:              signup.App,
+		UserId:           user.ID,
+		Username:         user.Username,
+		Role:             user.Role,
+		CreatedAt:        user.CreatedAt,
+		WithRefreshToken: true,
+	})
+}
+
+func (s *socialService) login(
+	w http.ResponseWriter,
+	r *http.Request,
+	app string,
+	provider string,
+	user *repository.User,
+) error {
+	restoreExpiredRole(s.userRepo, s.eventRepo, user)
+	if err := checkNotBanned(s.eventRepo, user); err != nil {
+		return err
+	}
+
+	user.LastLogin = time.Now()
+	s.userRepo.UpdateLastLogin(user)
+
+	s.eventRepo.Save(
+		EventLogin,
+		&struct {
+			App        string `json:"app"`
+			ActorUser  int64  `json:"actor_user"`
+			TargetUser int64  `json:"target_user"`
+			Provider   string `json:"provider"`
+			Ip         string `json:"ip"`
+		}{
+			App:        app,
+			ActorUser:  user.ID,
+			TargetUser: user.ID,
+			Provider:   provider,
+			Ip:         util.GetRealIp(r),
+		},
+	)
+	return util.RespondAuthTokens(w, r, util.TokenOptions{
+		App:              app,
+		UserId:           user.ID,
+		Username:         user.Username,
+		Role:             user.Role,
+		CreatedAt:        user.CreatedAt,
+		WithRefreshToken: true,
+	})
+}
+
+func (s *socialService) saveIdentity(identity *repository.Identity) error {
+	err := s.identityRepo.Save(identity)
+	if err != nil {
+		if util.IsUniqueConstraintViolation(err, "auth_identity_provider_subject_key") {
+			slog.Error("Identity already linked", "provider", identity.Provider)
+			return util.Conflict(util.CodeIdentityTaken)
+		} else if util.IsUniqueConstraintViolation(err, "auth_identity_user_id_provider_key") {
+			slog.Error("Provider already linked", "user_id", identity.UserID, "provider", identity.Provider)
+			return util.Conflict(util.CodeIdentityAlreadyLinked)
+		} else {
+			slog.Error("Failed to save identity", "error", err)
+			return util.InternalServerError(util.CodeIdentitySaveFailed)
+		}
+	}
+	return nil
+}
+
+func (s *socialService) link(
+	w http.ResponseWriter,
+	userId int64,
+	provider string,
+	profile *infra.ExternalProfile,
+	identity *repository.Identity,
+) error {
+	if identity != nil {
+		if identity.UserID != userId {
+			slog.Error("Identity linked to another user", "provider", provider, "user_id", userId)
+			return util.Conflict(util.CodeIdentityTaken)
+		}
+		return util.RespondJson(w, newIdentityView(identity))
+	}
+
+	identity = &repository.Identity{
+		UserID:    userId,
+		Provider:  provider,
+		Subject:   profile.Subject,
+		Email:     profile.Email,
+		CreatedAt: time.Now(),
+	}
+	if err := s.saveIdentity(identity); err != nil {
+		return err
+	}
+
+	s.eventRepo.Save(
+		EventLinkIdentity,
+		&identityDetail{
+			ActorUser:  userId,
+			TargetUser: userId,
+			Provider:   provider,
+			Subject:    profile.Subject,
+		},
+	)
+	return util.RespondJson(w, newIdentityView(identity))
+}
+
+func (s *socialService) ListIdentities(w http.ResponseWriter, r *http.Request) error {
+	principal := util.GetPrincipal(r)
+
+	identities, err := s.identityRepo.ListByUser(principal.UserId)
+	if err != nil {
+		slog.Error("Failed to list identities", "user_id", principal.UserId, "error", err)
+		return util.InternalServerError(util.CodeIdentityQueryFailed)
+	}
+
+	views := make([]IdentityView, 0, len(identities))
+	for _, identity := range identities {
+		views = append(views, newIdentityView(identity))
+	}
+	return util.RespondJson(w, views)
+}
+
+// 绑定需要先登录，因此返回授权地址由前端跳转，回调时根据state绑定到当前用户
+func (s *socialService) Link(w http.ResponseWriter, r *http.Request) error {
+	principal := util.GetPrincipal(r)
+	provider, err := s.provider(r)
+	if err != nil {
+		return err
+	}
+
+	url, err := s.authCodeUrl(w, provider, &repository.SocialLogin{LinkUserId: principal.UserId})
+	if err != nil {
+		return err
+	}
+	return util.RespondJson(w, struct {
+		Url string `json:"url"`
+	}{
+		Url: url,
+	})
+}
+
+func (s *socialService) Unlink(w http.ResponseWriter, r *http.Request) error {
+	principal := util.GetPrincipal(r)
+
+	req, err := util.Body[struct {
+		Provider string `json:"provider" validate:"required"`
+	}](r)
+	if err != nil {
+		slog.Error("Request body parse error", "error", err)
+		return err
+	}
+
+	// 目录账号的绑定由登录时自动维护，不能解绑
+	if _, ok := s.providers[req.Provider]; !ok {
+		return util.NotFound(util.CodeIdentityNotFound)
+	}
+
+	user, err := s.userRepo.FindById(principal.UserId)
+	if err != nil || user == nil {
+		slog.Error("User lookup failed", "user_id", principal.UserId, "error", err)
+		return util.InternalServerError(util.CodeUserQueryFailed)
+	}
+	identities, err := s.identityRepo.ListByUser(user.ID)
+	if err != nil {
+		slog.Error("Failed to list identities", "user_id", user.ID, "error", err)
+		return util.InternalServerError(util.CodeIdentityQueryFailed)
+	}
+
+	var identity *repository.Identity
+	for _, i := range identities {
+		if i.Provider == req.Provider {
+			identity = i
+		}
+	}
+	if identity == nil {
+		return util.NotFound(util.CodeIdentityNotFound)
+	}
+	// 通过第三方注册的用户没有密码，不能解绑最后一个登录方式
+	if user.Password == "" && len(identities) == 1 {
+		return util.BadRequest(util.CodeIdentityLastLogin)
+	}
+
+	if err := s.identityRepo.Delete(user.ID, identity.Provider); err != nil {
+		slog.Error("Failed to delete identity", "user_id", user.ID, "error", err)
+		return util.InternalServerError(util.CodeIdentityDeleteFailed)
+	}
+
+	s.eventRepo.Save(
+		EventUnlinkIdentity,
+		&identityDetail{
+			ActorUser:  user.ID,
+			TargetUser: user.ID,
+			Provider:   identity.Provider,
+			Subject:    identity.Subject,
+		},
+	)
+	return util.RespondJson(w, newIdentityView(identity))
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"auth/internal/repository"
+	"time"
+)
+
+const (
+	EventStrikeUser    string = "strike-user"
+	EventRetractStrike string = "retract-strike"
+)
+
+type StrikePolicy struct {
+	Period            time.Duration // 警告的有效期，过期后不再计数
+	RestrictThreshold int64         // 有效警告达到该数量时限制用户
+	BanThreshold      int64         // 有效警告达到该数量时临时封禁用户
+	BanDuration       time.Duration
+}
+
+var DefaultStrikePolicy = StrikePolicy{
+	Period:            100 * 24 * time.Hour,
+	RestrictThreshold: 3,
+	BanThreshold:      5,
+	BanDuration:       30 * 24 * time.Hour,
+}
+
+type StrikeView struct {
+	Id          int64      `json:"id"`
+	Reason      string     `json:"reason"`
+	Evidence    string     `json:"evidence"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	Active      bool       `json:"active"`
+	RetractedAt *time.Time `json:"retracted_at,omitempty"`
+}
+
+func newStrikeView(strike *repository.Strike, policy StrikePolicy) StrikeView {
+	expiresAt := strike.CreatedAt.Add(policy.Period)
+	return StrikeView{
+		Id:          strike.ID,
+		Reason:      strike.Reason,
+		Evidence:    strike.Evidence,
+		CreatedAt:   strike.CreatedAt,
+		ExpiresAt:   expiresAt,
+		Active:      strike.RetractedAt == nil && time.Now().Before(expiresAt),
+		RetractedAt: strike.RetractedAt,
+	}
+}
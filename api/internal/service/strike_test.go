@@ -0,0 +1,131 @@
+package service
+
+import (
+	"auth/internal/repository"
+	"auth/internal/util"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+type memoryStrikeRepository struct {
+	strikes []*repository.Strike
+}
+
+func (r *memoryStrikeRepository) ListByUser(userId int64) ([]*repository.Strike, error) {
+	var strikes []*repository.Strike
+	for _, strike := range r.strikes {
+		if strike.UserID == userId {
+			strikes = append(strikes, strike)
+		}
+	}
+	return strikes, nil
+}
+
+func (r *memoryStrikeRepository) FindById(id int64) (*repository.Strike, error) {
+	for _, strike := range r.strikes {
+		if strike.ID == id {
+			return strike, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryStrikeRepository) CountActive(userId int64, since time.Time) (int64, error) {
+	var count int64
+	for _, strike := range r.strikes {
+		if strike.UserID == userId && strike.RetractedAt == nil && strike.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryStrikeRepository) Save(strike *repository.Strike) error {
+	strike.ID = int64(len(r.strikes) + 1)
+	r.strikes = append(r.strikes, strike)
+	return nil
+}
+
+func (r *memoryStrikeRepository) Retract(strike *repository.Strike) error {
+	return nil
+}
+
+func TestStrikeEscalation(t *testing.T) {
+	users := memoryUserRepository{}
+	alice := users.add("alice", repository.RoleMember)
+	strikes := &memoryStrikeRepository{}
+	// 已过期和已撤回的警告不计数
+	strikes.Save(&repository.Strike{UserID: alice.ID, CreatedAt: time.Now().Add(-DefaultStrikePolicy.Period - time.Hour)})
+	retractedAt := time.Now()
+	strikes.Save(&repository.Strike{UserID: alice.ID, CreatedAt: time.Now(), RetractedAt: &retractedAt})
+
+	events := &memoryEventRepository{}
+	sessions := memorySessionRepository{}
+	s := newTestAdminService(users)
+	s.eventRepo = events
+	s.sessionRepo = sessions
+	s.strikeRepo = strikes
+
+	moderator := &util.Principal{UserId: 100, Role: repository.RoleModerator}
+	admin := &util.Principal{UserId: 101, Role: repository.RoleAdmin, Permissions: []string{repository.PermUserBan}}
+	strike := func(principal *util.Principal) error {
+		body := `{"username":"alice","reason":"spam","evidence":"link"}`
+		return s.StrikeUser(httptest.NewRecorder(), adminRequest("POST", "/user/strike", body, principal))
+	}
+
+	for i := range 2 {
+		requireCode(t, strike(moderator), "")
+		if alice.Role != repository.RoleMember {
+			t.Fatalf("expected member after %d strikes, got %s", i+1, alice.Role)
+		}
+	}
+	requireCode(t, strike(moderator), "")
+	if alice.Role != repository.RoleRestricted || alice.RoleExpiresAt != nil {
+		t.Fatalf("expected permanent restriction after 3 strikes, got %s", alice.Role)
+	}
+
+	// 版主没有封禁权限，达到封禁次数后仍只是限制
+	requireCode(t, strike(moderator), "")
+	requireCode(t, strike(moderator), "")
+	if alice.Role != repository.RoleRestricted {
+		t.Fatalf("expected moderator strikes to stop at restriction, got %s", alice.Role)
+	}
+
+	requireCode(t, strike(admin), "")
+	if alice.Role != repository.RoleBanned || alice.RoleExpiresAt == nil ||
+		alice.RoleExpiresAt.Before(time.Now().Add(DefaultStrikePolicy.BanDuration-time.Minute)) {
+		t.Fatalf("expected temporary ban, got %s until %v", alice.Role, alice.RoleExpiresAt)
+	}
+	if _, revoked := sessions[alice.ID]; !revoked {
+		t.Error("expected sessions to be revoked on ban")
+	}
+	requireCode(t, strike(admin), util.CodeStrikeNotAllowed)
+
+	want := []string{
+		EventStrikeUser, EventStrikeUser, EventStrikeUser, EventRestrictUser,
+		EventStrikeUser, EventStrikeUser, EventStrikeUser, EventBanUser,
+	}
+	if !slices.Equal(events.actions(), want) {
+		t.Errorf("expected events %v, got %v", want, events.actions())
+	}
+}
+
+func TestNewStrikeView(t *testing.T) {
+	policy := StrikePolicy{Period: 24 * time.Hour}
+	now := time.Now()
+
+	view := newStrikeView(&repository.Strike{CreatedAt: now.Add(-time.Hour)}, policy)
+	if !view.Active || !view.ExpiresAt.Equal(now.Add(23*time.Hour)) {
+		t.Errorf("expected active strike, got %+v", view)
+	}
+	view = newStrikeView(&repository.Strike{CreatedAt: now.Add(-25 * time.Hour)}, policy)
+	if view.Active {
+		t.Errorf("expected expired strike, got %+v", view)
+	}
+	view = newStrikeView(&repository.Strike{CreatedAt: now, RetractedAt: &now}, policy)
+	if view.Active || view.RetractedAt == nil {
+		t.Errorf("expected retracted strike, got %+v", view)
+	}
+}
@@ -0,0 +1,23 @@
+package util
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 在time.ParseDuration的基础上支持以d为单位的天数，例如"7d"
+func ParseDuration(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, BadRequest(CodeDurationInvalid)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, BadRequest(CodeDurationInvalid)
+	}
+	return d, nil
+}
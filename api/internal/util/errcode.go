@@ -0,0 +1,289 @@
+package util
+
+// 错误码是对外稳定的接口，客户端据此判断错误类型，修改文案时不要修改错误码
+// 各语言的文案以错误码为键，见i18n.go
+const (
+	CodeInternalError        = "internal_error"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeInvalidJson          = "invalid_json"
+	CodeValidationFailed     = "validation_failed"
+	CodeResponseEncodeFailed = "response_encode_failed"
+	CodeRateLimited          = "rate_limited"
+
+	CodeQueryInvalidTime   = "query_invalid_time"
+	CodeQueryInvalidNumber = "query_invalid_number"
+	CodeQueryOutOfRange    = "query_out_of_range"
+	CodeSortFieldInvalid   = "sort_field_invalid"
+	CodeSortOrderInvalid   = "sort_order_invalid"
+	CodeCursorInvalid      = "cursor_invalid"
+	CodeDurationInvalid    = "duration_invalid"
+
+	CodeUsernameInvalidSpace = "username_invalid_space"
+	CodeUsernameInvalidChar  = "username_invalid_char"
+	CodeUsernameInvalidAt    = "username_invalid_at"
+	CodePasswordInvalidChar  = "password_invalid_char"
+	CodePasswordInvalidSpace = "password_invalid_space"
+
+	CodeAccessTokenMissing           = "access_token_missing"
+	CodeAccessTokenInvalid           = "access_token_invalid"
+	CodeAccessTokenRevoked           = "access_token_revoked"
+	CodeAccessTokenAudienceInvalid   = "access_token_audience_invalid"
+	CodeAccessTokenIssueFailed       = "access_token_issue_failed"
+	CodeRefreshTokenMissing          = "refresh_token_missing"
+	CodeRefreshTokenInvalid          = "refresh_token_invalid"
+	CodeRefreshTokenRevoked          = "refresh_token_revoked"
+	CodeRefreshTokenAppMismatch      = "refresh_token_app_mismatch"
+	CodeRefreshTokenIssueFailed      = "refresh_token_issue_failed"
+	CodeSessionQueryFailed           = "session_query_failed"
+	CodeSessionRevokeFailed          = "session_revoke_failed"
+	CodePermissionQueryFailed        = "permission_query_failed"
+	CodePermissionDenied             = "permission_denied"
+	CodeUserBannedPermanent          = "user_banned_permanent"
+	CodeUserBannedUntil              = "user_banned_until"
+	CodePasswordIncorrect            = "password_incorrect"
+	CodePasswordHashFailed           = "password_hash_failed"
+	CodePasswordResetFailed          = "password_reset_failed"
+	CodeOtpInvalid                   = "otp_invalid"
+	CodeOtpTypeInvalid               = "otp_type_invalid"
+	CodeOtpCreateFailed              = "otp_create_failed"
+	CodeOtpSendFailed                = "otp_send_failed"
+	CodeEmailCheckFailed             = "email_check_failed"
+	CodeEmailTaken                   = "email_taken"
+	CodeUsernameTaken                = "username_taken"
+	CodeUserCreateFailed             = "user_create_failed"
+	CodeUserQueryFailed              = "user_query_failed"
+	CodeUserNotFound                 = "user_not_found"
+	CodeEventQueryFailed             = "event_query_failed"
+	CodeRoleUpdateFailed             = "role_update_failed"
+	CodeRoleTransitionInvalid        = "role_transition_invalid"
+	CodeRoleUnchanged                = "role_unchanged"
+	CodeRoleSelfChange               = "role_self_change"
+	CodeRoleAdminRequired            = "role_admin_required"
+	CodeRoleLastAdmin                = "role_last_admin"
+	CodeAdminQueryFailed             = "admin_query_failed"
+	CodeUserNotSanctioned            = "user_not_sanctioned"
+	CodeRoleSanctioned               = "role_sanctioned"
+	CodeStrikeNotAllowed             = "strike_not_allowed"
+	CodeStrikeSaveFailed             = "strike_save_failed"
+	CodeStrikeQueryFailed            = "strike_query_failed"
+	CodeStrikeCountFailed            = "strike_count_failed"
+	CodeStrikeNotFound               = "strike_not_found"
+	CodeStrikeAlreadyRetracted       = "strike_already_retracted"
+	CodeStrikeRetractFailed          = "strike_retract_failed"
+	CodeClientAuthFailed             = "client_auth_failed"
+	CodeClientQueryFailed            = "client_query_failed"
+	CodeClientCreateFailed           = "client_create_failed"
+	CodeClientDisableFailed          = "client_disable_failed"
+	CodeClientNotFound               = "client_not_found"
+	CodeClientIdTaken                = "client_id_taken"
+	CodeClientIdInvalid              = "client_id_invalid"
+	CodeTokenMissing                 = "token_missing"
+	CodeTokenNotRevocable            = "token_not_revocable"
+	CodeTokenClientMismatch          = "token_client_mismatch"
+	CodeTokenRevokeFailed            = "token_revoke_failed"
+	CodeTokenStatusQueryFailed       = "token_status_query_failed"
+	CodeGrantTypeUnsupported         = "grant_type_unsupported"
+	CodePersonalTokenQueryFailed     = "personal_token_query_failed"
+	CodePersonalTokenCreateFailed    = "personal_token_create_failed"
+	CodePersonalTokenRevokeFailed    = "personal_token_revoke_failed"
+	CodePersonalTokenNotFound        = "personal_token_not_found"
+	CodePersonalTokenLifetimeInvalid = "personal_token_lifetime_invalid"
+	CodeScopeInvalid                 = "scope_invalid"
+	CodeSocialProviderUnknown        = "social_provider_unknown"
+	CodeSocialAppMissing             = "social_app_missing"
+	CodeSocialStateInvalid           = "social_state_invalid"
+	CodeSocialStateFailed            = "social_state_failed"
+	CodeSocialAuthorizationDenied    = "social_authorization_denied"
+	CodeSocialProviderFailed         = "social_provider_failed"
+	CodeSocialEmailTaken             = "social_email_taken"
+	CodeSignupTicketInvalid          = "signup_ticket_invalid"
+	CodeIdentityQueryFailed          = "identity_query_failed"
+	CodeIdentitySaveFailed           = "identity_save_failed"
+	CodeIdentityDeleteFailed         = "identity_delete_failed"
+	CodeIdentityTaken                = "identity_taken"
+	CodeIdentityAlreadyLinked        = "identity_already_linked"
+	CodeIdentityNotFound             = "identity_not_found"
+	CodeIdentityLastLogin            = "identity_last_login"
+	CodeDirectoryEmailMissing        = "directory_email_missing"
+	CodeDirectoryUserConflict        = "directory_user_conflict"
+	CodeDirectoryPasswordManaged     = "directory_password_managed"
+	CodeRegistrationClosed           = "registration_closed"
+	CodeRegistrationEmailDenied      = "registration_email_denied"
+	CodeInviteRequired               = "invite_required"
+	CodeInviteInvalid                = "invite_invalid"
+	CodeInviteQueryFailed            = "invite_query_failed"
+	CodeInviteCreateFailed           = "invite_create_failed"
+	CodeInviteRevokeFailed           = "invite_revoke_failed"
+	CodeInviteNotFound               = "invite_not_found"
+	CodeInviteUsesInvalid            = "invite_uses_invalid"
+	CodeRegistrationDisposableEmail  = "registration_disposable_email"
+	CodeRegistrationEmailNoMx        = "registration_email_no_mx"
+	CodeRegistrationIpBlocked        = "registration_ip_blocked"
+	CodeRegistrationTooFrequent      = "registration_too_frequent"
+	CodeChallengeRequired            = "challenge_required"
+	CodeChallengeInvalid             = "challenge_invalid"
+	CodeChallengeIssueFailed         = "challenge_issue_failed"
+	CodeChallengeVerifyFailed        = "challenge_verify_failed"
+)
+
+// 校验器标签对应的文案，参数依次为字段名和标签参数
+const (
+	CodeValidateRequired = "validate.required"
+	CodeValidateEmail    = "validate.email"
+	CodeValidateMin      = "validate.min"
+	CodeValidateMax      = "validate.max"
+	CodeValidateLen      = "validate.len"
+	CodeValidateNumeric  = "validate.numeric"
+	CodeValidateAlphanum = "validate.alphanum"
+	CodeValidateOneof    = "validate.oneof"
+	CodeValidateDefault  = "validate.default"
+)
+
+var messagesZhCN = map[string]string{
+	CodeInternalError:        "%s",
+	CodeUnsupportedMediaType: "expected content-type application/json",
+	CodeInvalidJson:          "invalid JSON format",
+	CodeValidationFailed:     "%s",
+	CodeResponseEncodeFailed: "failed to encode response",
+	CodeRateLimited:          "操作过于频繁，请稍后再试",
+
+	CodeQueryInvalidTime:   "%s必须是RFC3339格式的时间",
+	CodeQueryInvalidNumber: "%s必须是数字",
+	CodeQueryOutOfRange:    "%s必须在%d到%d之间",
+	CodeSortFieldInvalid:   "不支持的排序字段",
+	CodeSortOrderInvalid:   "排序方向只能是asc或desc",
+	CodeCursorInvalid:      "无效的分页游标",
+	CodeDurationInvalid:    "无效的时长",
+
+	CodeUsernameInvalidSpace: "用户名前后不能有空格",
+	CodeUsernameInvalidChar:  "用户名只能包含可打印字符",
+	CodeUsernameInvalidAt:    "用户名不能包含@字符",
+	CodePasswordInvalidChar:  "密码只能包含可打印字符",
+	CodePasswordInvalidSpace: "密码不能包含空格",
+
+	CodeAccessTokenMissing:           "缺少访问令牌",
+	CodeAccessTokenInvalid:           "无效的访问令牌",
+	CodeAccessTokenRevoked:           "访问令牌已失效，请重新登录",
+	CodeAccessTokenAudienceInvalid:   "访问令牌不能用于该服务",
+	CodeAccessTokenIssueFailed:       "无法创建访问令牌",
+	CodeRefreshTokenMissing:          "缺少刷新令牌",
+	CodeRefreshTokenInvalid:          "无效的刷新令牌",
+	CodeRefreshTokenRevoked:          "刷新令牌已失效，请重新登录",
+	CodeRefreshTokenAppMismatch:      "刷新令牌不属于该应用",
+	CodeRefreshTokenIssueFailed:      "无法创建刷新令牌",
+	CodeSessionQueryFailed:           "查询会话状态失败",
+	CodeSessionRevokeFailed:          "撤销用户会话失败",
+	CodePermissionQueryFailed:        "查询权限失败",
+	CodePermissionDenied:             "权限不足",
+	CodeUserBannedPermanent:          "账号已被永久封禁，原因：%s",
+	CodeUserBannedUntil:              "账号已被封禁，原因：%s，解封时间：%s",
+	CodePasswordIncorrect:            "密码错误",
+	CodePasswordHashFailed:           "密码哈希失败",
+	CodePasswordResetFailed:          "密码重置失败",
+	CodeOtpInvalid:                   "无效验证码",
+	CodeOtpTypeInvalid:               "无效的请求类型",
+	CodeOtpCreateFailed:              "创建验证码失败",
+	CodeOtpSendFailed:                "发送验证邮件失败",
+	CodeEmailCheckFailed:             "邮件检查失败",
+	CodeEmailTaken:                   "邮箱已被占用",
+	CodeUsernameTaken:                "用户名已被占用",
+	CodeUserCreateFailed:             "创建用户失败",
+	CodeUserQueryFailed:              "查询用户失败",
+	CodeUserNotFound:                 "用户不存在",
+	CodeEventQueryFailed:             "查询事件失败",
+	CodeRoleUpdateFailed:             "更新用户角色失败",
+	CodeRoleTransitionInvalid:        "不能将用户从%s变更为%s",
+	CodeRoleUnchanged:                "用户已是该角色",
+	CodeRoleSelfChange:               "不能修改自己的角色",
+	CodeRoleAdminRequired:            "只有管理员可以授予或撤销管理员角色",
+	CodeRoleLastAdmin:                "不能撤销最后一位管理员",
+	CodeAdminQueryFailed:             "查询管理员失败",
+	CodeUserNotSanctioned:            "用户未被限制或封禁",
+	CodeRoleSanctioned:               "用户处于限制或封禁中，请先通过 /admin/user/restore 解除",
+	CodeStrikeNotAllowed:             "不能警告该用户",
+	CodeStrikeSaveFailed:             "记录警告失败",
+	CodeStrikeQueryFailed:            "查询警告失败",
+	CodeStrikeCountFailed:            "查询用户违规记录失败",
+	CodeStrikeNotFound:               "警告不存在",
+	CodeStrikeAlreadyRetracted:       "警告已被撤销",
+	CodeStrikeRetractFailed:          "撤销警告失败",
+	CodeClientAuthFailed:             "客户端认证失败",
+	CodeClientQueryFailed:            "查询客户端失败",
+	CodeClientCreateFailed:           "创建客户端失败",
+	CodeClientDisableFailed:          "停用客户端失败",
+	CodeClientNotFound:               "客户端不存在",
+	CodeClientIdTaken:                "客户端ID已被占用",
+	CodeClientIdInvalid:              "客户端ID只能包含小写字母、数字、下划线和连字符，长度为2到64",
+	CodeTokenMissing:                 "缺少令牌",
+	CodeTokenNotRevocable:            "该令牌签发较早，无法单独撤销",
+	CodeTokenClientMismatch:          "只能撤销签发给本客户端的令牌",
+	CodeTokenRevokeFailed:            "撤销令牌失败",
+	CodeTokenStatusQueryFailed:       "查询令牌状态失败",
+	CodeGrantTypeUnsupported:         "不支持的授权类型",
+	CodePersonalTokenQueryFailed:     "查询个人令牌失败",
+	CodePersonalTokenCreateFailed:    "创建个人令牌失败",
+	CodePersonalTokenRevokeFailed:    "撤销个人令牌失败",
+	CodePersonalTokenNotFound:        "个人令牌不存在",
+	CodePersonalTokenLifetimeInvalid: "个人令牌有效期不能超过365天",
+	CodeScopeInvalid:                 "无效的权限范围：%s",
+	CodeSocialProviderUnknown:        "不支持的第三方登录方式",
+	CodeSocialAppMissing:             "缺少应用参数app",
+	CodeSocialStateInvalid:           "第三方登录请求无效或已过期，请重新登录",
+	CodeSocialStateFailed:            "保存第三方登录请求失败",
+	CodeSocialAuthorizationDenied:    "第三方授权未完成",
+	CodeSocialProviderFailed:         "无法从第三方获取账号信息",
+	CodeSocialEmailTaken:             "该邮箱已注册，请使用原账号登录后绑定第三方账号",
+	CodeSignupTicketInvalid:          "注册请求无效或已过期，请重新登录",
+	CodeIdentityQueryFailed:          "查询第三方账号失败",
+	CodeIdentitySaveFailed:           "绑定第三方账号失败",
+	CodeIdentityDeleteFailed:         "解绑第三方账号失败",
+	CodeIdentityTaken:                "该第三方账号已绑定其他用户",
+	CodeIdentityAlreadyLinked:        "已绑定该登录方式的其他账号，请先解绑",
+	CodeIdentityNotFound:             "未绑定该登录方式",
+	CodeIdentityLastLogin:            "这是唯一的登录方式，请先设置密码",
+	CodeDirectoryEmailMissing:        "目录中的账号没有邮箱，请联系管理员",
+	CodeDirectoryUserConflict:        "用户名已被本地账号占用，请联系管理员",
+	CodeDirectoryPasswordManaged:     "该账号的密码由目录管理，请在目录中修改",
+	CodeRegistrationClosed:           "暂不开放注册",
+	CodeRegistrationEmailDenied:      "不支持使用该邮箱域名注册",
+	CodeInviteRequired:               "注册需要邀请码",
+	CodeInviteInvalid:                "邀请码无效、已过期或已用完",
+	CodeInviteQueryFailed:            "查询邀请码失败",
+	CodeInviteCreateFailed:           "创建邀请码失败",
+	CodeInviteRevokeFailed:           "撤销邀请码失败",
+	CodeInviteNotFound:               "邀请码不存在",
+	CodeInviteUsesInvalid:            "邀请码可用次数必须在1到1000之间",
+	CodeRegistrationDisposableEmail:  "不支持使用临时邮箱注册",
+	CodeRegistrationEmailNoMx:        "该邮箱域名无法接收邮件",
+	CodeRegistrationIpBlocked:        "当前网络不允许注册",
+	CodeRegistrationTooFrequent:      "当前网络注册过于频繁，请稍后再试",
+	CodeChallengeRequired:            "请先完成人机验证",
+	CodeChallengeInvalid:             "人机验证未通过",
+	CodeChallengeIssueFailed:         "生成人机验证失败",
+	CodeChallengeVerifyFailed:        "人机验证服务不可用",
+
+	CodeValidateRequired: "%s不能为空",
+	CodeValidateEmail:    "%s必须是有效的邮箱地址",
+	CodeValidateMin:      "%s至少需要%s个字符",
+	CodeValidateMax:      "%s不能超过%s个字符",
+	CodeValidateLen:      "%s长度必须为%s位",
+	CodeValidateNumeric:  "%s必须是数字",
+	CodeValidateAlphanum: "%s只能包含字母和数字",
+	CodeValidateOneof:    "%s必须是以下值之一：%s",
+	CodeValidateDefault:  "%s验证失败(%s)",
+
+	"field.app":       "应用名",
+	"field.email":     "邮箱",
+	"field.username":  "用户名",
+	"field.password":  "密码",
+	"field.otp":       "验证码",
+	"field.reason":    "原因",
+	"field.role":      "角色",
+	"field.evidence":  "证据",
+	"field.type":      "类型",
+	"field.id":        "编号",
+	"field.client_id": "客户端ID",
+	"field.name":      "名称",
+	"field.scopes":    "权限范围",
+	"field.duration":  "有效期",
+}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"crypto/hmac"
 	"crypto/pbkdf2"
 	"crypto/rand"
 	"crypto/sha256"
@@ -96,3 +97,10 @@ func validatePbkdf2(hashedPassword, password string) (VerifyResult, error) {
 		return VerifyResult{Valid: true, Obsolete: obsolete}, nil
 	}
 }
+
+// 从已有的密钥派生用于其他用途的密钥，不同label得到的密钥互不相同
+func DeriveSecret(secret string, label string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(label))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
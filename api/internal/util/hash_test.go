@@ -22,3 +22,13 @@ func TestHashBasic(t *testing.T) {
 		t.Errorf("Validate succeeded for incorrect password, error: %v", err)
 	}
 }
+
+func TestDeriveSecret(t *testing.T) {
+	derived := DeriveSecret("secret", "challenge")
+	if derived == "secret" || derived != DeriveSecret("secret", "challenge") {
+		t.Errorf("unexpected derived secret %q", derived)
+	}
+	if derived == DeriveSecret("secret", "other") || derived == DeriveSecret("other", "challenge") {
+		t.Error("expected different labels and secrets to derive different keys")
+	}
+}
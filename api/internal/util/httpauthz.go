@@ -0,0 +1,140 @@
+package util
+
+import (
+	"auth/internal/repository"
+	"auth/pkg/authclient"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Principal = authclient.Principal
+
+// 校验访问令牌和用户会话的Verifier，permRepo为nil时不加载角色权限。
+// audiences限制令牌可以来自哪些应用，为空时不限制。
+// 签名密钥在构造时读取，需在设置AccessTokenSecret之后调用
+func NewAccessTokenVerifier(
+	permRepo repository.PermissionRepository,
+	sessionRepo repository.SessionRepository,
+	audiences []string,
+) *authclient.Verifier {
+	verifier := &authclient.Verifier{
+		Keys:      authclient.HMAC(AccessTokenSecret),
+		Audiences: audiences,
+		IsRevoked: func(ctx context.Context, jti string) (bool, error) {
+			if RevokedTokens == nil {
+				return false, nil
+			}
+			return RevokedTokens.IsTokenRevoked(jti)
+		},
+		Opaque: func(ctx context.Context, token string) (*Principal, error) {
+			if VerifyPersonalToken == nil {
+				return nil, authclient.ErrTokenInvalid
+			}
+			// 撤销名单由IsRevoked检查
+			info, err := VerifyPersonalToken(token)
+			if err != nil {
+				return nil, authclient.ErrTokenInvalid
+			}
+			return &Principal{
+				UserId:    info.UserId,
+				App:       info.App,
+				Username:  info.Username,
+				Role:      info.Role,
+				TokenId:   info.Id,
+				IssuedAt:  info.IssuedAt,
+				ExpiresAt: info.ExpiresAt,
+				Scopes:    info.Scopes,
+			}, nil
+		},
+		LegacySubject: func(ctx context.Context, username string, issuedAt time.Time) (int64, error) {
+			if LookupLegacySubject == nil {
+				return 0, authclient.ErrTokenInvalid
+			}
+			userId, err := LookupLegacySubject(username, issuedAt)
+			if err != nil {
+				return 0, authclient.ErrTokenInvalid
+			}
+			return userId, nil
+		},
+		Validate: func(ctx context.Context, principal *Principal) error {
+			// 机器令牌的权限即其scope，不关联用户会话和角色
+			if principal.IsClient() {
+				if IsClientActive != nil {
+					active, err := IsClientActive(principal.ClientId)
+					if err != nil {
+						return InternalServerError(CodeClientQueryFailed)
+					}
+					if !active {
+						slog.Error("Client disabled", "client_id", principal.ClientId)
+						return Unauthorized(CodeAccessTokenRevoked)
+					}
+				}
+				principal.UserId = repository.SystemUserId
+				return nil
+			}
+			// 个人令牌的角色每次从数据库读取，封禁时直接拒绝，不随会话撤销失效
+			if IsPersonalToken(principal) {
+				return nil
+			}
+			// 角色变更或封禁后，之前签发的令牌立即失效
+			revokedAt, err := sessionRepo.UserSessionsRevokedAt(principal.UserId)
+			if err != nil {
+				return InternalServerError(CodeSessionQueryFailed)
+			}
+			if repository.SessionRevoked(principal.IssuedAt, revokedAt) {
+				slog.Error("Access token revoked", "user_id", principal.UserId)
+				return Unauthorized(CodeAccessTokenRevoked)
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			slog.Error("Access token verification failed", "error", err)
+			RespondError(w, r, authError(err))
+		},
+	}
+
+	if permRepo != nil {
+		verifier.Permissions = func(ctx context.Context, principal *Principal) ([]string, error) {
+			permissions, err := permRepo.ListByRole(principal.Role)
+			if err != nil {
+				slog.Error("Failed to list permissions", "role", principal.Role, "error", err)
+				return nil, InternalServerError(CodePermissionQueryFailed)
+			}
+			return permissions, nil
+		}
+	}
+	return verifier
+}
+
+// 将authclient返回的错误转换为带错误码的HttpError
+func authError(err error) error {
+	var httpErr *HttpError
+	switch {
+	case errors.As(err, &httpErr):
+		return httpErr
+	case errors.Is(err, authclient.ErrTokenMissing):
+		return Unauthorized(CodeAccessTokenMissing)
+	case errors.Is(err, authclient.ErrTokenInvalid):
+		return Unauthorized(CodeAccessTokenInvalid)
+	case errors.Is(err, authclient.ErrTokenRevoked):
+		return Unauthorized(CodeAccessTokenRevoked)
+	case errors.Is(err, authclient.ErrAudience):
+		return Unauthorized(CodeAccessTokenAudienceInvalid)
+	case errors.Is(err, authclient.ErrForbidden):
+		return Forbidden(CodePermissionDenied)
+	default:
+		return InternalServerError(CodeInternalError, err.Error())
+	}
+}
+
+func IsPersonalToken(principal *Principal) bool {
+	return strings.HasPrefix(principal.TokenId, PersonalTokenIdPrefix)
+}
+
+func GetPrincipal(r *http.Request) *Principal {
+	return authclient.FromContext(r.Context())
+}
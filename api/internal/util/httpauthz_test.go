@@ -0,0 +1,117 @@
+package util
+
+import (
+	"auth/internal/repository"
+	"auth/pkg/authclient"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+type stubPermissionRepository map[string][]string
+
+func (r stubPermissionRepository) ListByRole(role string) ([]string, error) {
+	return r[role], nil
+}
+
+type stubSessionRepository map[int64]time.Time
+
+func (r stubSessionRepository) RevokeUserSessions(userId int64) error {
+	r[userId] = time.Now()
+	return nil
+}
+
+func (r stubSessionRepository) UserSessionsRevokedAt(userId int64) (time.Time, error) {
+	return r[userId], nil
+}
+
+func TestRequirePermission(t *testing.T) {
+	permissions := stubPermissionRepository{
+		repository.RoleModerator: {repository.PermUserRead, repository.PermUserRestrict},
+	}
+	sessions := stubSessionRepository{}
+
+	var principal *Principal
+	handler := NewAccessTokenVerifier(permissions, sessions, nil).Middleware(authclient.RequirePermission(repository.PermUserRestrict))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal = GetPrincipal(r)
+		}),
+	)
+	serve := func(token string) (int, string) {
+		principal = nil
+		r := httptest.NewRequest("POST", "/admin/user/restrict", nil)
+		r.Header.Set("Accept", "application/json")
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		var envelope errorEnvelope
+		json.Unmarshal(w.Body.Bytes(), &envelope)
+		return w.Code, envelope.Code
+	}
+
+	moderator := issueTestTokens(t, TokenOptions{App: "novel", UserId: 1, Username: "mod", Role: repository.RoleModerator})
+	if status, _ := serve(moderator.AccessToken); status != http.StatusOK || principal == nil {
+		t.Fatalf("expected moderator to pass, got %d", status)
+	}
+	if principal.UserId != 1 || !slices.Equal(principal.Permissions, permissions[repository.RoleModerator]) {
+		t.Errorf("unexpected principal %+v", principal)
+	}
+
+	member := issueTestTokens(t, TokenOptions{App: "novel", UserId: 2, Username: "member", Role: repository.RoleMember})
+	if status, code := serve(member.AccessToken); status != http.StatusForbidden || code != CodePermissionDenied {
+		t.Errorf("expected member to be denied, got %d %s", status, code)
+	}
+	if status, code := serve(""); status != http.StatusUnauthorized || code != CodeAccessTokenMissing {
+		t.Errorf("expected missing token, got %d %s", status, code)
+	}
+	if status, code := serve("garbage"); status != http.StatusUnauthorized || code != CodeAccessTokenInvalid {
+		t.Errorf("expected invalid token, got %d %s", status, code)
+	}
+
+	// 角色变更后旧令牌中的角色不再可信
+	sessions[1] = time.Now().Add(time.Second)
+	if status, code := serve(moderator.AccessToken); status != http.StatusUnauthorized || code != CodeAccessTokenRevoked {
+		t.Errorf("expected revoked token, got %d %s", status, code)
+	}
+	if principal != nil {
+		t.Error("handler called with revoked token")
+	}
+}
+
+func TestAuthenticatePersonalTokenAfterSessionRevoked(t *testing.T) {
+	VerifyPersonalToken = func(token string) (*TokenInfo, error) {
+		if token != PersonalTokenPrefix+"secret" {
+			return nil, errors.New("unknown token")
+		}
+		return &TokenInfo{
+			Type:      TokenTypePersonal,
+			Id:        PersonalTokenIdPrefix + "1",
+			UserId:    1,
+			App:       PersonalTokenApp,
+			Role:      repository.RoleMember,
+			IssuedAt:  time.Now().Add(-time.Hour),
+			ExpiresAt: time.Now().Add(time.Hour),
+			Scopes:    []string{},
+		}, nil
+	}
+	defer func() { VerifyPersonalToken = nil }()
+	sessions := stubSessionRepository{1: time.Now()}
+
+	var principal *Principal
+	handler := NewAccessTokenVerifier(nil, sessions, nil).Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal = GetPrincipal(r)
+	}))
+	r := httptest.NewRequest("GET", "/auth/strikes", nil)
+	r.Header.Set("Authorization", "Bearer "+PersonalTokenPrefix+"secret")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || principal == nil || !IsPersonalToken(principal) {
+		t.Errorf("expected personal token to pass after session revocation, got %d", w.Code)
+	}
+}
@@ -2,23 +2,73 @@ package util
 
 import (
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
+	"reflect"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
 
+// 单个字段的校验错误，作为validation_failed错误的详情返回
+type FieldError struct {
+	Field   string `json:"field"`
+	Tag     string `json:"tag"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// 取字段在JSON中的名称，找不到时退回结构体字段名
+func jsonFieldName(t reflect.Type, ve validator.FieldError) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct {
+		if field, ok := t.FieldByName(ve.StructField()); ok {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name != "" && name != "-" {
+				return name
+			}
+		}
+	}
+	return ve.Field()
+}
+
+var validationCodes = map[string]string{
+	"required": CodeValidateRequired,
+	"email":    CodeValidateEmail,
+	"min":      CodeValidateMin,
+	"max":      CodeValidateMax,
+	"len":      CodeValidateLen,
+	"numeric":  CodeValidateNumeric,
+	"alphanum": CodeValidateAlphanum,
+	"oneof":    CodeValidateOneof,
+}
+
+func validationMessage(lang, field string, ve validator.FieldError) string {
+	fieldName := field
+	if name, ok := catalogs[lang]["field."+field]; ok {
+		fieldName = name
+	}
+
+	code, ok := validationCodes[ve.Tag()]
+	if !ok {
+		return Translate(lang, CodeValidateDefault, fieldName, ve.Tag())
+	}
+	switch ve.Tag() {
+	case "min", "max", "len", "oneof":
+		return Translate(lang, code, fieldName, ve.Param())
+	default:
+		return Translate(lang, code, fieldName)
+	}
+}
+
 func Body[T any](r *http.Request) (T, error) {
 	var zero T
 
 	contentType := r.Header.Get("Content-Type")
 	if contentType != "" && contentType != "application/json" {
-		return zero, &HttpError{
-			StatusCode: http.StatusUnsupportedMediaType,
-			Message:    "expected content-type application/json",
-		}
+		return zero, NewHttpError(http.StatusUnsupportedMediaType, CodeUnsupportedMediaType)
 	}
 
 	// 限制读取的最大字节数为1MB
@@ -29,55 +79,27 @@ func Body[T any](r *http.Request) (T, error) {
 	// 解码JSON
 	var result T
 	if err := json.NewDecoder(limitedReader).Decode(&result); err != nil {
-		return zero, BadRequest("invalid JSON format")
+		return zero, BadRequest(CodeInvalidJson)
 	}
 
 	// 验证JSON
 	validate := validator.New(validator.WithRequiredStructEnabled())
 	if err := validate.Struct(result); err != nil {
-		validationErrorToMessage := func(ve validator.FieldError) string {
-			fieldName := ve.Field()
-			switch fieldName {
-			case "App":
-				fieldName = "应用名"
-			case "Email":
-				fieldName = "邮箱"
-			case "Username":
-				fieldName = "用户名"
-			case "Password":
-				fieldName = "密码"
-			case "Otp":
-				fieldName = "验证码"
-			default:
-				fieldName = strings.ToLower(fieldName)
-			}
-
-			switch ve.Tag() {
-			case "required":
-				return fmt.Sprintf("%s不能为空", fieldName)
-			case "email":
-				return fmt.Sprintf("%s必须是有效的邮箱地址", fieldName)
-			case "min":
-				return fmt.Sprintf("%s至少需要%s个字符", fieldName, ve.Param())
-			case "max":
-				return fmt.Sprintf("%s不能超过%s个字符", fieldName, ve.Param())
-			case "len":
-				return fmt.Sprintf("%s长度必须为%s位", fieldName, ve.Param())
-			case "numeric":
-				return fmt.Sprintf("%s必须是数字", fieldName)
-			case "alphanum":
-				return fmt.Sprintf("%s只能包含字母和数字", fieldName)
-			default:
-				return fmt.Sprintf("%s验证失败(%s)", fieldName, ve.Tag())
-			}
-		}
-
+		lang := RequestLang(r)
 		errors := err.(validator.ValidationErrors)
-		messages := make([]string, len(errors))
+		texts := make([]string, len(errors))
+		fields := make([]FieldError, len(errors))
 		for i, ve := range errors {
-			messages[i] = validationErrorToMessage(ve)
+			field := jsonFieldName(reflect.TypeOf(result), ve)
+			texts[i] = validationMessage(lang, field, ve)
+			fields[i] = FieldError{
+				Field:   field,
+				Tag:     ve.Tag(),
+				Param:   ve.Param(),
+				Message: texts[i],
+			}
 		}
-		return zero, BadRequest(strings.Join(messages, "; "))
+		return zero, BadRequest(CodeValidationFailed, strings.Join(texts, "; ")).WithDetails(fields)
 	}
 
 	return result, nil
@@ -2,8 +2,16 @@ package util
 
 import (
 	"auth/internal/repository"
+	"auth/pkg/authclient"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,59 +21,237 @@ import (
 var (
 	RefreshTokenSecret string
 	AccessTokenSecret  string
+	// 令牌撤销名单，parseClaims据此拒绝已撤销的jti，未设置时不检查
+	RevokedTokens repository.TokenRepository
+	// 个人令牌保存在数据库中，由服务层校验，未设置时不接受个人令牌
+	VerifyPersonalToken func(token string) (*TokenInfo, error)
+	// 检查客户端是否未被停用，停用后其已签发的机器令牌立即失效，未设置时不检查
+	IsClientActive func(clientId string) (bool, error)
+	// 早期签发的访问令牌以用户名作为sub，据此查询用户ID，未设置时拒绝此类令牌。
+	// 同名用户创建于令牌签发之后时说明原账号已不存在，应返回错误
+	LookupLegacySubject func(username string, issuedAt time.Time) (int64, error)
 )
 
+var errTokenRevoked = errors.New("token revoked")
+
+// 无法查询撤销名单，令牌是否有效未知，调用方应返回服务端错误而不是令牌无效
+var ErrTokenStatusUnavailable = errors.New("token revocation status unavailable")
+
 const (
+	PersonalTokenPrefix    = authclient.PersonalTokenPrefix
+	PersonalTokenApp       = "personal"
 	RefreshTokenCookieName = "refresh-token"
+	RefreshTokenParamName  = "refresh_token"
 )
 
+// 个人令牌的jti，JWT的jti不含连字符，不会与之混淆
+const PersonalTokenIdPrefix = "pat-"
+
 type refreshClaim struct {
 	jwt.RegisteredClaims
 }
 
-type accessClaim struct {
-	jwt.RegisteredClaims
-	Role      string           `json:"role"`
-	CreatedAt *jwt.NumericDate `json:"crat"`
+func (c *refreshClaim) TokenId() string {
+	return c.ID
 }
 
-func VerifyRefreshToken(r *http.Request) (string, error) {
-	cookie, err := r.Cookie(RefreshTokenCookieName)
+// 访问令牌的声明定义在公开的authclient包中，供其他服务校验
+type accessClaim = authclient.Claims
 
-	if err != nil {
-		return "", Unauthorized("缺少刷新令牌")
+type tokenClaims interface {
+	jwt.Claims
+	TokenId() string
+}
+
+// 浏览器通过Cookie携带刷新令牌，其他客户端通过表单或JSON请求体中的refresh_token携带
+func refreshTokenFromRequest(r *http.Request) string {
+	if cookie, err := r.Cookie(RefreshTokenCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
 	}
 
-	claims, err := parseClaims(cookie.Value, RefreshTokenSecret, &refreshClaim{})
-	if err != nil {
-		return "", Unauthorized("无效的刷新令牌")
+	contentType, _, _ := strings.Cut(r.Header.Get("Content-Type"), ";")
+	switch strings.TrimSpace(contentType) {
+	case "application/x-www-form-urlencoded":
+		return r.PostFormValue(RefreshTokenParamName)
+	case "application/json":
+		var body struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		defer r.Body.Close()
+		if json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&body) == nil {
+			return body.RefreshToken
+		}
 	}
+	return ""
+}
 
-	return claims.Subject, nil
+// 刷新令牌绑定签发时的应用，只能为该应用换取访问令牌
+type RefreshSession struct {
+	UserId    int64
+	App       string
+	TokenId   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
 }
 
-func VerifyAccessToken(r *http.Request, requireAdmin bool) (string, error) {
-	tokenString := r.Header.Get("Authorization")
+func VerifyRefreshToken(r *http.Request) (*RefreshSession, error) {
+	tokenString := refreshTokenFromRequest(r)
+
+	if tokenString == "" {
+		return nil, Unauthorized(CodeRefreshTokenMissing)
+	}
 
-	if (tokenString == "") || !strings.HasPrefix(tokenString, "Bearer ") {
-		return "", Unauthorized("缺少访问令牌")
+	claims, err := parseClaims(tokenString, RefreshTokenSecret, &refreshClaim{})
+	if errors.Is(err, ErrTokenStatusUnavailable) {
+		slog.Error("Failed to check refresh token revocation", "error", err)
+		return nil, InternalServerError(CodeTokenStatusQueryFailed)
+	} else if errors.Is(err, errTokenRevoked) {
+		return nil, Unauthorized(CodeRefreshTokenRevoked)
+	} else if err != nil {
+		return nil, Unauthorized(CodeRefreshTokenInvalid)
 	}
 
-	claims, err := parseClaims(tokenString[len("Bearer "):], AccessTokenSecret, &accessClaim{})
+	// 早期签发的刷新令牌没有记录应用，无法确定其归属，需要重新登录
+	userId, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil || claims.IssuedAt == nil || claims.ExpiresAt == nil || len(claims.Audience) != 1 {
+		return nil, Unauthorized(CodeRefreshTokenInvalid)
+	}
+	return &RefreshSession{
+		UserId:    userId,
+		App:       claims.Audience[0],
+		TokenId:   claims.ID,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
+
+func inspectPersonalToken(tokenString string) (*TokenInfo, error) {
+	if VerifyPersonalToken == nil {
+		return nil, jwt.ErrTokenUnverifiable
+	}
+	info, err := VerifyPersonalToken(tokenString)
 	if err != nil {
-		return "", Unauthorized("无效的访问令牌")
+		return nil, err
+	}
+	if err := checkTokenRevoked(info.Id); err != nil {
+		return nil, err
 	}
+	return info, nil
+}
 
-	if requireAdmin && claims.Role != repository.RoleAdmin {
-		return "", Unauthorized("权限不足")
+const (
+	TokenTypeAccess   = "access_token"
+	TokenTypeRefresh  = "refresh_token"
+	TokenTypePersonal = "personal_token"
+)
+
+type TokenInfo struct {
+	Type      string
+	Id        string
+	UserId    int64
+	ClientId  string
+	Scopes    []string
+	App       string
+	Username  string
+	Role      string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// 解析任意类型的令牌，hint为调用方猜测的令牌类型，仅影响尝试的顺序
+func InspectToken(tokenString string, hint string) (*TokenInfo, error) {
+	if strings.HasPrefix(tokenString, PersonalTokenPrefix) {
+		return inspectPersonalToken(tokenString)
 	}
 
-	return claims.Subject, nil
+	inspectAccess := func() (*TokenInfo, error) {
+		claims, err := parseClaims(tokenString, AccessTokenSecret, &accessClaim{})
+		if err != nil {
+			return nil, err
+		}
+		info, err := newTokenInfo(TokenTypeAccess, &claims.RegisteredClaims, claims.ClientId != "")
+		if errors.Is(err, errLegacySubject) {
+			info, err = newLegacyTokenInfo(&claims.RegisteredClaims)
+			claims.Username = claims.Subject
+		}
+		if err != nil {
+			return nil, err
+		}
+		info.Username = claims.Username
+		info.Role = claims.Role
+		info.ClientId = claims.ClientId
+		info.Scopes = strings.Fields(claims.Scope)
+		return info, nil
+	}
+	inspectRefresh := func() (*TokenInfo, error) {
+		claims, err := parseClaims(tokenString, RefreshTokenSecret, &refreshClaim{})
+		if err != nil {
+			return nil, err
+		}
+		return newTokenInfo(TokenTypeRefresh, &claims.RegisteredClaims, false)
+	}
+
+	inspects := []func() (*TokenInfo, error){inspectAccess, inspectRefresh}
+	if hint == TokenTypeRefresh {
+		slices.Reverse(inspects)
+	}
+	var err error
+	for _, inspect := range inspects {
+		var info *TokenInfo
+		if info, err = inspect(); err == nil {
+			return info, nil
+		}
+		if errors.Is(err, ErrTokenStatusUnavailable) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+func newTokenInfo(tokenType string, claims *jwt.RegisteredClaims, isClient bool) (*TokenInfo, error) {
+	if claims.IssuedAt == nil || claims.ExpiresAt == nil {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	info := &TokenInfo{
+		Type:      tokenType,
+		Id:        claims.ID,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	if !isClient {
+		userId, err := strconv.ParseInt(claims.Subject, 10, 64)
+		if err != nil {
+			return nil, errLegacySubject
+		}
+		info.UserId = userId
+	}
+	if len(claims.Audience) > 0 {
+		info.App = claims.Audience[0]
+	}
+	return info, nil
+}
+
+var errLegacySubject = fmt.Errorf("%w: legacy subject", jwt.ErrTokenInvalidClaims)
+
+// 早期访问令牌的sub是用户名，没有jti
+func newLegacyTokenInfo(claims *jwt.RegisteredClaims) (*TokenInfo, error) {
+	if LookupLegacySubject == nil || claims.Subject == "" || claims.IssuedAt == nil {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	userId, err := LookupLegacySubject(claims.Subject, claims.IssuedAt.Time)
+	if err != nil {
+		return nil, err
+	}
+	legacy := *claims
+	legacy.Subject = strconv.FormatInt(userId, 10)
+	return newTokenInfo(TokenTypeAccess, &legacy, false)
 }
 
 type TokenPolicy struct {
 	RefreshTokenLifetime time.Duration
 	AccessTokenLifetime  time.Duration
+	// 刷新令牌放在响应体中而不是Cookie中，供无法使用Cookie的原生和第三方客户端
+	RefreshTokenInBody bool
 }
 
 var defaultTokenPolicy = TokenPolicy{
@@ -73,13 +259,29 @@ var defaultTokenPolicy = TokenPolicy{
 	AccessTokenLifetime:  time.Hour * 24 * 7,
 }
 var thirdPartyTokenPolicy = TokenPolicy{
+	RefreshTokenLifetime: time.Hour * 24 * 100,
+	AccessTokenLifetime:  time.Hour * 24,
+	RefreshTokenInBody:   true,
+}
+
+// 只能接收纯文本的旧版第三方客户端拿不到刷新令牌，只能签发长期访问令牌
+var legacyThirdPartyTokenPolicy = TokenPolicy{
 	RefreshTokenLifetime: 0,
 	AccessTokenLifetime:  time.Hour * 24 * 100,
 }
 
-func getTokenPolicy(app string) TokenPolicy {
+// 刷新令牌放在响应体中的客户端每次刷新都换发新的刷新令牌，
+// 避免泄露的令牌在整个有效期内都可以使用
+func RotatesRefreshToken(r *http.Request, app string) bool {
+	return getTokenPolicy(app, AcceptsJson(r)).RefreshTokenInBody
+}
+
+func getTokenPolicy(app string, acceptsJson bool) TokenPolicy {
 	switch app {
 	case "legado":
+		if !acceptsJson {
+			return legacyThirdPartyTokenPolicy
+		}
 		return thirdPartyTokenPolicy
 	default:
 		return defaultTokenPolicy
@@ -88,27 +290,119 @@ func getTokenPolicy(app string) TokenPolicy {
 
 type TokenOptions struct {
 	App              string
+	UserId           int64
 	Username         string
 	Role             string
 	CreatedAt        time.Time
+	Scopes           []string
 	WithRefreshToken bool
 }
 
-func RespondAuthTokens(w http.ResponseWriter, opts TokenOptions) error {
-	policy := getTokenPolicy(opts.App)
+type TokenUser struct {
+	Id        int64     `json:"id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TokenResponse struct {
+	AccessToken      string     `json:"access_token"`
+	RefreshToken     string     `json:"refresh_token,omitempty"`
+	TokenType        string     `json:"token_type"`
+	ExpiresIn        int64      `json:"expires_in"`
+	RefreshExpiresIn int64      `json:"refresh_expires_in,omitempty"`
+	Scope            string     `json:"scope,omitempty"`
+	User             *TokenUser `json:"user,omitempty"`
+}
+
+// 接受JSON的客户端得到令牌及其元数据，旧客户端仍只收到访问令牌文本
+func RespondAuthTokens(w http.ResponseWriter, r *http.Request, opts TokenOptions) error {
+	policy := getTokenPolicy(opts.App, AcceptsJson(r))
+
+	response := TokenResponse{
+		TokenType: "Bearer",
+		ExpiresIn: int64(policy.AccessTokenLifetime.Seconds()),
+		Scope:     strings.Join(opts.Scopes, " "),
+		User: &TokenUser{
+			Id:        opts.UserId,
+			Username:  opts.Username,
+			Role:      opts.Role,
+			CreatedAt: opts.CreatedAt,
+		},
+	}
 
 	if opts.WithRefreshToken && policy.RefreshTokenLifetime > 0 {
 		refreshToken, err := issueRefreshToken(opts, policy)
 		if err != nil {
 			return err
 		}
-		attachRefreshToken(w, refreshToken, int(policy.RefreshTokenLifetime.Seconds()))
+		if policy.RefreshTokenInBody {
+			response.RefreshToken = refreshToken
+		} else {
+			attachRefreshToken(w, refreshToken, int(policy.RefreshTokenLifetime.Seconds()))
+		}
+		response.RefreshExpiresIn = int64(policy.RefreshTokenLifetime.Seconds())
 	}
 	accessToken, err := issueAccessToken(opts, policy)
 	if err != nil {
 		return err
 	}
-	return RespondText(w, accessToken)
+
+	if !AcceptsJson(r) {
+		return RespondText(w, accessToken)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	response.AccessToken = accessToken
+	return RespondJson(w, response)
+}
+
+// 机器令牌有效期较短，停用客户端后旧令牌很快失效
+const clientTokenLifetime = time.Hour
+
+// 客户端凭据模式（RFC 6749 4.4）签发的令牌，sub和aud均为client_id
+func RespondClientToken(w http.ResponseWriter, clientId string, scopes []string) error {
+	issuedAt := time.Now()
+	scope := strings.Join(scopes, " ")
+
+	claims := accessClaim{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        rand.Text(),
+			Subject:   clientId,
+			Audience:  jwt.ClaimStrings{clientId},
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(clientTokenLifetime)),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+		},
+		ClientId: clientId,
+		Scope:    scope,
+	}
+
+	token, err := jwt.
+		NewWithClaims(jwt.SigningMethodHS256, claims).
+		SignedString([]byte(AccessTokenSecret))
+	if err != nil {
+		slog.Error("Failed to sign client token", "client_id", clientId, "error", err)
+		return InternalServerError(CodeAccessTokenIssueFailed)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	return RespondJson(w, TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(clientTokenLifetime.Seconds()),
+		Scope:       scope,
+	})
+}
+
+// 撤销刷新令牌，通过请求体提交的刷新令牌不会随Cookie一起清除
+func RevokeRefreshToken(session *RefreshSession) error {
+	if session.TokenId == "" || RevokedTokens == nil {
+		return nil
+	}
+	if err := RevokedTokens.RevokeToken(session.TokenId, session.ExpiresAt); err != nil {
+		slog.Error("Failed to revoke refresh token", "user_id", session.UserId, "error", err)
+		return InternalServerError(CodeTokenRevokeFailed)
+	}
+	return nil
 }
 
 func RespondLogout(w http.ResponseWriter) error {
@@ -122,11 +416,13 @@ func issueAccessToken(opts TokenOptions, policy TokenPolicy) (string, error) {
 
 	claims := accessClaim{
 		RegisteredClaims: jwt.RegisteredClaims{
-			Subject:   opts.Username,
+			ID:        rand.Text(),
+			Subject:   strconv.FormatInt(opts.UserId, 10),
 			Audience:  jwt.ClaimStrings{opts.App},
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(issuedAt),
 		},
+		Username:  opts.Username,
 		Role:      opts.Role,
 		CreatedAt: jwt.NewNumericDate(opts.CreatedAt),
 	}
@@ -136,7 +432,7 @@ func issueAccessToken(opts TokenOptions, policy TokenPolicy) (string, error) {
 		SignedString([]byte(AccessTokenSecret))
 	if err != nil {
 		slog.Error("Failed to sign access token", "error", err)
-		return "", InternalServerError("无法创建访问令牌")
+		return "", InternalServerError(CodeAccessTokenIssueFailed)
 	}
 
 	return token, nil
@@ -148,7 +444,9 @@ func issueRefreshToken(opts TokenOptions, policy TokenPolicy) (string, error) {
 
 	claims := refreshClaim{
 		RegisteredClaims: jwt.RegisteredClaims{
-			Subject:   opts.Username,
+			ID:        rand.Text(),
+			Subject:   strconv.FormatInt(opts.UserId, 10),
+			Audience:  jwt.ClaimStrings{opts.App},
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(issuedAt),
 		},
@@ -159,7 +457,7 @@ func issueRefreshToken(opts TokenOptions, policy TokenPolicy) (string, error) {
 		SignedString([]byte(RefreshTokenSecret))
 	if err != nil {
 		slog.Error("Failed to sign refresh token", "error", err)
-		return "", InternalServerError("无法创建刷新令牌")
+		return "", InternalServerError(CodeRefreshTokenIssueFailed)
 	}
 	return token, nil
 
@@ -178,7 +476,7 @@ func attachRefreshToken(w http.ResponseWriter, token string, maxAge int) {
 	http.SetCookie(w, cookie)
 }
 
-func parseClaims[T jwt.Claims](
+func parseClaims[T tokenClaims](
 	tokenString string,
 	secret string,
 	claims T,
@@ -199,5 +497,24 @@ func parseClaims[T jwt.Claims](
 		return zero, jwt.ErrTokenInvalidClaims
 	}
 
+	if err := checkTokenRevoked(validClaims.TokenId()); err != nil {
+		return zero, err
+	}
+
 	return validClaims, nil
 }
+
+// 早期签发的令牌没有jti，只能通过撤销用户会话使其失效
+func checkTokenRevoked(jti string) error {
+	if jti == "" || RevokedTokens == nil {
+		return nil
+	}
+	revoked, err := RevokedTokens.IsTokenRevoked(jti)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrTokenStatusUnavailable, err)
+	}
+	if revoked {
+		return errTokenRevoked
+	}
+	return nil
+}
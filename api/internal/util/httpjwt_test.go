@@ -0,0 +1,180 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func issueTestTokens(t *testing.T, opts TokenOptions) TokenResponse {
+	t.Helper()
+	r := httptest.NewRequest("POST", "/login", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	if err := RespondAuthTokens(w, r, opts); err != nil {
+		t.Fatal(err)
+	}
+	var response TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestInspectTokenUserId(t *testing.T) {
+	response := issueTestTokens(t, TokenOptions{
+		App:      "novel",
+		UserId:   42,
+		Username: "alice",
+		Role:     "member",
+	})
+
+	info, err := InspectToken(response.AccessToken, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Type != TokenTypeAccess || info.UserId != 42 || info.Username != "alice" || info.App != "novel" || info.Id == "" {
+		t.Errorf("unexpected token info %+v", info)
+	}
+}
+
+// 早期签发的访问令牌以用户名作为sub，按签发时间查询当时使用该用户名的用户
+func TestInspectLegacyToken(t *testing.T) {
+	issuedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaim{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "alice",
+			Audience:  jwt.ClaimStrings{"novel"},
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(24 * time.Hour)),
+		},
+		Role: "member",
+	}).SignedString([]byte(AccessTokenSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := InspectToken(token, ""); err == nil {
+		t.Error("expected legacy token to be rejected without a lookup")
+	}
+
+	var lookedUp time.Time
+	LookupLegacySubject = func(username string, at time.Time) (int64, error) {
+		lookedUp = at
+		if username != "alice" {
+			return 0, errors.New("user not found")
+		}
+		return 7, nil
+	}
+	defer func() { LookupLegacySubject = nil }()
+
+	info, err := InspectToken(token, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UserId != 7 || info.Username != "alice" || info.Id != "" {
+		t.Errorf("unexpected token info %+v", info)
+	}
+	if !lookedUp.Equal(issuedAt) {
+		t.Errorf("expected lookup at %v, got %v", issuedAt, lookedUp)
+	}
+
+	LookupLegacySubject = func(username string, at time.Time) (int64, error) {
+		return 0, errors.New("token issued before user was created")
+	}
+	if _, err := InspectToken(token, ""); err == nil {
+		t.Error("expected legacy token of a recreated user to be rejected")
+	}
+}
+
+func TestRespondAuthTokens(t *testing.T) {
+	opts := TokenOptions{App: "novel", UserId: 42, Username: "alice", Role: "member", WithRefreshToken: true}
+	respond := func(opts TokenOptions, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/login", nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		if err := RespondAuthTokens(w, r, opts); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+	refreshCookie := func(w *httptest.ResponseRecorder) bool {
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.Name == RefreshTokenCookieName && cookie.HttpOnly {
+				return true
+			}
+		}
+		return false
+	}
+
+	w := respond(opts, "application/json")
+	var response TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.TokenType != "Bearer" || response.AccessToken == "" ||
+		response.ExpiresIn != int64(defaultTokenPolicy.AccessTokenLifetime.Seconds()) ||
+		response.RefreshExpiresIn != int64(defaultTokenPolicy.RefreshTokenLifetime.Seconds()) ||
+		response.User == nil || response.User.Id != 42 || response.User.Username != "alice" {
+		t.Errorf("unexpected token response %+v", response)
+	}
+	// 浏览器客户端的刷新令牌只放在Cookie中
+	if response.RefreshToken != "" || !refreshCookie(w) {
+		t.Error("expected refresh token in cookie only")
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Error("expected token response not to be cached")
+	}
+
+	// 旧客户端只收到访问令牌文本
+	w = respond(opts, "")
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("expected text response, got %s", w.Header().Get("Content-Type"))
+	}
+	if info, err := InspectToken(w.Body.String(), ""); err != nil || info.UserId != 42 {
+		t.Errorf("expected access token in text response, got %q", w.Body.String())
+	}
+	if !refreshCookie(w) {
+		t.Error("expected refresh token cookie for text response")
+	}
+
+	// 只能接收文本的第三方客户端得到长期访问令牌，没有刷新令牌
+	opts.App = "legado"
+	w = respond(opts, "")
+	if refreshCookie(w) {
+		t.Error("expected no refresh token for legacy text clients")
+	}
+	info, err := InspectToken(w.Body.String(), "")
+	if err != nil || info.ExpiresAt.Sub(info.IssuedAt) != legacyThirdPartyTokenPolicy.AccessTokenLifetime {
+		t.Errorf("expected long lived access token, got %+v %v", info, err)
+	}
+}
+
+// 升级前签发的刷新令牌没有记录应用，不能确定应为哪个应用签发访问令牌
+func TestVerifyRefreshTokenWithoutApp(t *testing.T) {
+	now := time.Now()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaim{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "42",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}).SignedString([]byte(RefreshTokenSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("POST", "/refresh", nil)
+	r.AddCookie(&http.Cookie{Name: RefreshTokenCookieName, Value: token})
+	_, err = VerifyRefreshToken(r)
+	var httpErr *HttpError
+	if !errors.As(err, &httpErr) || httpErr.Code != CodeRefreshTokenInvalid {
+		t.Errorf("expected %s, got %v", CodeRefreshTokenInvalid, err)
+	}
+}
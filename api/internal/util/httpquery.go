@@ -0,0 +1,54 @@
+package util
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func QueryString(r *http.Request, key string) *string {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func QueryTime(r *http.Request, key string) (*time.Time, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, BadRequest(CodeQueryInvalidTime, key)
+	}
+	return &t, nil
+}
+
+// 参数未提供时返回nil，用于0也是有效取值的参数
+func QueryOptionalInt(r *http.Request, key string, min, max int64) (*int64, error) {
+	if r.URL.Query().Get(key) == "" {
+		return nil, nil
+	}
+	n, err := QueryInt(r, key, 0, min, max)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+func QueryInt(r *http.Request, key string, fallback, min, max int64) (int64, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, BadRequest(CodeQueryInvalidNumber, key)
+	}
+	if n < min || n > max {
+		return 0, BadRequest(CodeQueryOutOfRange, key, min, max)
+	}
+	return n, nil
+}
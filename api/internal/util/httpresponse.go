@@ -1,77 +1,137 @@
 package util
 
 import (
+	"context"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 type HttpError struct {
 	StatusCode int
+	Code       string
 	Message    string
+	Details    any
+	args       []any
 }
 
 func (e *HttpError) Error() string {
 	return fmt.Sprintf("[%d] %s", e.StatusCode, e.Message)
 }
 
-func NewHttpError(statusCode int, message string) *HttpError {
+// 附加结构化的错误详情，仅在JSON格式的响应中返回
+func (e *HttpError) WithDetails(details any) *HttpError {
+	e.Details = details
+	return e
+}
+
+// Message使用默认语言，便于记录日志；响应时按请求的语言重新格式化
+func NewHttpError(statusCode int, code string, args ...any) *HttpError {
 	return &HttpError{
 		StatusCode: statusCode,
-		Message:    message,
+		Code:       code,
+		Message:    Translate(DefaultLang, code, args...),
+		args:       args,
 	}
 }
 
-func BadRequest(message string) *HttpError {
-	return NewHttpError(http.StatusBadRequest, message)
+func (e *HttpError) Localize(lang string) string {
+	if e.Code == "" {
+		return e.Message
+	}
+	return Translate(lang, e.Code, e.args...)
+}
+
+func BadRequest(code string, args ...any) *HttpError {
+	return NewHttpError(http.StatusBadRequest, code, args...)
+}
+
+func Unauthorized(code string, args ...any) *HttpError {
+	return NewHttpError(http.StatusUnauthorized, code, args...)
 }
 
-func Unauthorized(message string) *HttpError {
-	return NewHttpError(http.StatusUnauthorized, message)
+func Forbidden(code string, args ...any) *HttpError {
+	return NewHttpError(http.StatusForbidden, code, args...)
 }
 
-func NotFound(message string) *HttpError {
-	return NewHttpError(http.StatusNotFound, message)
+func NotFound(code string, args ...any) *HttpError {
+	return NewHttpError(http.StatusNotFound, code, args...)
 }
 
-func Conflict(message string) *HttpError {
-	return NewHttpError(http.StatusConflict, message)
+func Conflict(code string, args ...any) *HttpError {
+	return NewHttpError(http.StatusConflict, code, args...)
 }
 
-func InternalServerError(message string) *HttpError {
-	return NewHttpError(http.StatusInternalServerError, message)
+func TooManyRequests(code string, args ...any) *HttpError {
+	return NewHttpError(http.StatusTooManyRequests, code, args...)
+}
+
+func InternalServerError(code string, args ...any) *HttpError {
+	return NewHttpError(http.StatusInternalServerError, code, args...)
 }
 
 func EH(f func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		err := f(w, r)
 		if err != nil {
-			RespondError(w, err)
+			RespondError(w, r, err)
 			return
 		}
 	}
 }
 
-// 修复http.Error的额外换行符问题
-func RespondError(w http.ResponseWriter, err error) {
-	var code int
-	var message string
+type jsonResponsesKey struct{}
+
+// 新版本的路由始终返回JSON，不依赖客户端的Accept请求头
+func JsonResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), jsonResponsesKey{}, true)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// 客户端是否在Accept中声明接受JSON，旧客户端默认仍返回纯文本
+func AcceptsJson(r *http.Request) bool {
+	if force, _ := r.Context().Value(jsonResponsesKey{}).(bool); force {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
 
+// 修复http.Error的额外换行符问题
+func RespondError(w http.ResponseWriter, r *http.Request, err error) {
 	httpErr := &HttpError{}
-	if errors.As(err, &httpErr) {
-		code = httpErr.StatusCode
-		message = httpErr.Message
-	} else {
-		code = http.StatusInternalServerError
-		message = err.Error()
+	if !errors.As(err, &httpErr) {
+		httpErr = InternalServerError(CodeInternalError, err.Error())
 	}
 
+	message := httpErr.Localize(RequestLang(r))
+
 	h := w.Header()
 	h.Del("Content-Length")
-	h.Set("Content-Type", "text/plain; charset=utf-8")
+	h.Add("Vary", "Accept-Language")
 	h.Set("X-Content-Type-Options", "nosniff")
-	w.WriteHeader(code)
+
+	if AcceptsJson(r) {
+		h.Set("Content-Type", "application/json")
+		w.WriteHeader(httpErr.StatusCode)
+		json.NewEncoder(w).Encode(struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Details any    `json:"details,omitempty"`
+		}{
+			Code:    httpErr.Code,
+			Message: message,
+			Details: httpErr.Details,
+		})
+		return
+	}
+
+	h.Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(httpErr.StatusCode)
 	fmt.Fprint(w, message)
 }
 
@@ -88,7 +148,19 @@ func RespondJson[T any](w http.ResponseWriter, response T) error {
 	h.Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		return InternalServerError("failed to encode response")
+		return InternalServerError(CodeResponseEncodeFailed)
+	}
+	return nil
+}
+
+func RespondCsv(w http.ResponseWriter, filename string, records [][]string) error {
+	h := w.Header()
+	h.Set("Content-Type", "text/csv; charset=utf-8")
+	h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	writer := csv.NewWriter(w)
+	if err := writer.WriteAll(records); err != nil {
+		return InternalServerError(CodeResponseEncodeFailed)
 	}
 	return nil
 }
@@ -0,0 +1,89 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcceptsJson(t *testing.T) {
+	tests := []struct {
+		accept string
+		json   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"text/html,application/xhtml+xml", false},
+		{"application/json", true},
+		{"text/plain, application/json;q=0.9", true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", tt.accept)
+		if json := AcceptsJson(r); json != tt.json {
+			t.Errorf("AcceptsJson(%q) = %v, want %v", tt.accept, json, tt.json)
+		}
+	}
+
+	// 新版本的路由不看Accept请求头
+	var forced bool
+	handler := JsonResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forced = AcceptsJson(r)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !forced {
+		t.Error("expected JsonResponses to force JSON")
+	}
+}
+
+type errorEnvelope struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details"`
+}
+
+func respondError(r *http.Request, err error) (*httptest.ResponseRecorder, errorEnvelope) {
+	w := httptest.NewRecorder()
+	RespondError(w, r, err)
+	var envelope errorEnvelope
+	json.Unmarshal(w.Body.Bytes(), &envelope)
+	return w, envelope
+}
+
+func TestRespondErrorJson(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/json")
+	r.Header.Set("Accept-Language", "en")
+
+	w, envelope := respondError(r, NotFound(CodeUserNotFound).WithDetails(map[string]any{"user_id": 1}))
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if envelope.Code != CodeUserNotFound ||
+		envelope.Message != Translate(LangEn, CodeUserNotFound) ||
+		envelope.Details["user_id"] != float64(1) {
+		t.Errorf("unexpected envelope %+v", envelope)
+	}
+
+	// 不是HttpError的错误作为内部错误返回
+	w, envelope = respondError(r, errors.New("boom"))
+	if w.Code != http.StatusInternalServerError || envelope.Code != CodeInternalError {
+		t.Errorf("unexpected response %d %+v", w.Code, envelope)
+	}
+}
+
+func TestRespondErrorText(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	RespondError(w, r, NotFound(CodeUserNotFound).WithDetails(map[string]any{"user_id": 1}))
+
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	// 纯文本响应只有消息，没有错误码和详情
+	if body := w.Body.String(); body != Translate(LangZhCN, CodeUserNotFound) {
+		t.Errorf("unexpected body %q", body)
+	}
+}
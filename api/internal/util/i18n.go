@@ -0,0 +1,89 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	LangZhCN string = "zh-CN"
+	LangEn   string = "en"
+
+	DefaultLang = LangZhCN
+)
+
+// 各语言的文案，键为错误码；新增语言（如zh-TW、ja）时在此注册
+var catalogs = map[string]map[string]string{
+	LangZhCN: messagesZhCN,
+	LangEn:   messagesEn,
+}
+
+// 语言的主标签到默认语言的映射，如zh-HK回退到zh-CN
+var baseLangs = map[string]string{
+	"zh": LangZhCN,
+	"en": LangEn,
+}
+
+// 将语言标签匹配到已支持的语言，不支持时返回空字符串
+func matchLang(tag string) string {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return ""
+	}
+	for lang := range catalogs {
+		if strings.EqualFold(lang, tag) {
+			return lang
+		}
+	}
+	base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+	return baseLangs[base]
+}
+
+// 请求使用的语言，lang参数优先于Accept-Language
+func RequestLang(r *http.Request) string {
+	if lang := matchLang(r.URL.Query().Get("lang")); lang != "" {
+		return lang
+	}
+
+	type candidate struct {
+		tag string
+		q   float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{tag, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	for _, c := range candidates {
+		if lang := matchLang(c.tag); lang != "" {
+			return lang
+		}
+	}
+	return DefaultLang
+}
+
+// 按语言格式化文案，缺失时依次回退到默认语言和错误码本身
+func Translate(lang, code string, args ...any) string {
+	message, ok := catalogs[lang][code]
+	if !ok {
+		message, ok = catalogs[DefaultLang][code]
+	}
+	if !ok {
+		return code
+	}
+	return fmt.Sprintf(message, args...)
+}
@@ -0,0 +1,43 @@
+package util
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestLang(t *testing.T) {
+	tests := []struct {
+		target         string
+		acceptLanguage string
+		lang           string
+	}{
+		{"/", "", LangZhCN},
+		{"/", "en-US,en;q=0.9", LangEn},
+		{"/", "fr-FR, en;q=0.5, zh;q=0.8", LangZhCN},
+		{"/", "fr-FR", LangZhCN},
+		{"/", "zh-TW", LangZhCN},
+		{"/", "en;q=0", LangZhCN},
+		{"/?lang=en", "zh-CN", LangEn},
+		{"/?lang=xx", "en", LangEn},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.target, nil)
+		if tt.acceptLanguage != "" {
+			r.Header.Set("Accept-Language", tt.acceptLanguage)
+		}
+		if lang := RequestLang(r); lang != tt.lang {
+			t.Errorf("RequestLang(%q, %q) = %q, want %q", tt.target, tt.acceptLanguage, lang, tt.lang)
+		}
+	}
+}
+
+func TestCatalogsComplete(t *testing.T) {
+	for lang, catalog := range catalogs {
+		for code := range catalogs[DefaultLang] {
+			if _, ok := catalog[code]; !ok {
+				t.Errorf("%s is missing message for %s", lang, code)
+			}
+		}
+	}
+}
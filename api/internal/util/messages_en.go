@@ -0,0 +1,150 @@
+package util
+
+var messagesEn = map[string]string{
+	CodeInternalError:        "%s",
+	CodeUnsupportedMediaType: "expected content-type application/json",
+	CodeInvalidJson:          "invalid JSON format",
+	CodeValidationFailed:     "%s",
+	CodeResponseEncodeFailed: "failed to encode response",
+	CodeRateLimited:          "too many requests, please try again later",
+
+	CodeQueryInvalidTime:   "%s must be an RFC3339 timestamp",
+	CodeQueryInvalidNumber: "%s must be a number",
+	CodeQueryOutOfRange:    "%s must be between %d and %d",
+	CodeSortFieldInvalid:   "unsupported sort field",
+	CodeSortOrderInvalid:   "sort order must be asc or desc",
+	CodeCursorInvalid:      "invalid page cursor",
+	CodeDurationInvalid:    "invalid duration",
+
+	CodeUsernameInvalidSpace: "username must not start or end with spaces",
+	CodeUsernameInvalidChar:  "username may only contain printable characters",
+	CodeUsernameInvalidAt:    "username must not contain @",
+	CodePasswordInvalidChar:  "password may only contain printable characters",
+	CodePasswordInvalidSpace: "password must not contain spaces",
+
+	CodeAccessTokenMissing:           "missing access token",
+	CodeAccessTokenInvalid:           "invalid access token",
+	CodeAccessTokenRevoked:           "access token has been revoked, please sign in again",
+	CodeAccessTokenAudienceInvalid:   "access token is not valid for this service",
+	CodeAccessTokenIssueFailed:       "failed to issue access token",
+	CodeRefreshTokenMissing:          "missing refresh token",
+	CodeRefreshTokenInvalid:          "invalid refresh token",
+	CodeRefreshTokenRevoked:          "refresh token has been revoked, please sign in again",
+	CodeRefreshTokenAppMismatch:      "refresh token was issued to a different app",
+	CodeRefreshTokenIssueFailed:      "failed to issue refresh token",
+	CodeSessionQueryFailed:           "failed to query session state",
+	CodeSessionRevokeFailed:          "failed to revoke user sessions",
+	CodePermissionQueryFailed:        "failed to query permissions",
+	CodePermissionDenied:             "permission denied",
+	CodeUserBannedPermanent:          "account is permanently banned, reason: %s",
+	CodeUserBannedUntil:              "account is banned, reason: %s, until: %s",
+	CodePasswordIncorrect:            "incorrect password",
+	CodePasswordHashFailed:           "failed to hash password",
+	CodePasswordResetFailed:          "failed to reset password",
+	CodeOtpInvalid:                   "invalid verification code",
+	CodeOtpTypeInvalid:               "invalid request type",
+	CodeOtpCreateFailed:              "failed to create verification code",
+	CodeOtpSendFailed:                "failed to send verification email",
+	CodeEmailCheckFailed:             "failed to check email",
+	CodeEmailTaken:                   "email is already in use",
+	CodeUsernameTaken:                "username is already taken",
+	CodeUserCreateFailed:             "failed to create user",
+	CodeUserQueryFailed:              "failed to query user",
+	CodeUserNotFound:                 "user not found",
+	CodeEventQueryFailed:             "failed to query events",
+	CodeRoleUpdateFailed:             "failed to update user role",
+	CodeRoleTransitionInvalid:        "cannot change user from %s to %s",
+	CodeRoleUnchanged:                "user already has this role",
+	CodeRoleSelfChange:               "cannot change your own role",
+	CodeRoleAdminRequired:            "only admins can grant or revoke the admin role",
+	CodeRoleLastAdmin:                "cannot demote the last admin",
+	CodeAdminQueryFailed:             "failed to query admins",
+	CodeUserNotSanctioned:            "user is not restricted or banned",
+	CodeRoleSanctioned:               "user is restricted or banned, lift the sanction with /admin/user/restore first",
+	CodeStrikeNotAllowed:             "this user cannot receive strikes",
+	CodeStrikeSaveFailed:             "failed to record strike",
+	CodeStrikeQueryFailed:            "failed to query strikes",
+	CodeStrikeCountFailed:            "failed to count user strikes",
+	CodeStrikeNotFound:               "strike not found",
+	CodeStrikeAlreadyRetracted:       "strike has already been retracted",
+	CodeStrikeRetractFailed:          "failed to retract strike",
+	CodeClientAuthFailed:             "client authentication failed",
+	CodeClientQueryFailed:            "failed to query client",
+	CodeClientCreateFailed:           "failed to create client",
+	CodeClientDisableFailed:          "failed to disable client",
+	CodeClientNotFound:               "client not found",
+	CodeClientIdTaken:                "client id is already taken",
+	CodeClientIdInvalid:              "client id may only contain lowercase letters, digits, underscores and hyphens, 2 to 64 characters",
+	CodeTokenMissing:                 "missing token",
+	CodeTokenNotRevocable:            "this token predates revocation support and cannot be revoked individually",
+	CodeTokenClientMismatch:          "only tokens issued to this client can be revoked",
+	CodeTokenRevokeFailed:            "failed to revoke token",
+	CodeTokenStatusQueryFailed:       "failed to query token status",
+	CodeGrantTypeUnsupported:         "unsupported grant type",
+	CodePersonalTokenQueryFailed:     "failed to query personal tokens",
+	CodePersonalTokenCreateFailed:    "failed to create personal token",
+	CodePersonalTokenRevokeFailed:    "failed to revoke personal token",
+	CodePersonalTokenNotFound:        "personal token not found",
+	CodePersonalTokenLifetimeInvalid: "personal token lifetime must not exceed 365 days",
+	CodeScopeInvalid:                 "invalid scope: %s",
+	CodeSocialProviderUnknown:        "unsupported sign-in provider",
+	CodeSocialAppMissing:             "missing app parameter",
+	CodeSocialStateInvalid:           "sign-in request is invalid or has expired, please try again",
+	CodeSocialStateFailed:            "failed to save sign-in request",
+	CodeSocialAuthorizationDenied:    "authorization with the provider was not completed",
+	CodeSocialProviderFailed:         "failed to fetch account from the provider",
+	CodeSocialEmailTaken:             "this email is already registered, sign in and link the provider from your account instead",
+	CodeSignupTicketInvalid:          "sign-up request is invalid or has expired, please sign in again",
+	CodeIdentityQueryFailed:          "failed to query linked accounts",
+	CodeIdentitySaveFailed:           "failed to link account",
+	CodeIdentityDeleteFailed:         "failed to unlink account",
+	CodeIdentityTaken:                "this account is already linked to another user",
+	CodeIdentityAlreadyLinked:        "another account from this provider is already linked, unlink it first",
+	CodeIdentityNotFound:             "no account linked for this provider",
+	CodeIdentityLastLogin:            "this is your only way to sign in, set a password first",
+	CodeDirectoryEmailMissing:        "the directory account has no email, contact an administrator",
+	CodeDirectoryUserConflict:        "the username is already used by a local account, contact an administrator",
+	CodeDirectoryPasswordManaged:     "the password of this account is managed by the directory, change it there",
+	CodeRegistrationClosed:           "registration is closed",
+	CodeRegistrationEmailDenied:      "registration with this email domain is not allowed",
+	CodeInviteRequired:               "an invite code is required to register",
+	CodeInviteInvalid:                "invite code is invalid, expired or used up",
+	CodeInviteQueryFailed:            "failed to query invites",
+	CodeInviteCreateFailed:           "failed to create invite",
+	CodeInviteRevokeFailed:           "failed to revoke invite",
+	CodeInviteNotFound:               "invite not found",
+	CodeInviteUsesInvalid:            "invite uses must be between 1 and 1000",
+	CodeRegistrationDisposableEmail:  "registration with a disposable email address is not allowed",
+	CodeRegistrationEmailNoMx:        "this email domain cannot receive mail",
+	CodeRegistrationIpBlocked:        "registration is not allowed from this network",
+	CodeRegistrationTooFrequent:      "too many registrations from this network, please try again later",
+	CodeChallengeRequired:            "please complete the challenge first",
+	CodeChallengeInvalid:             "challenge verification failed",
+	CodeChallengeIssueFailed:         "failed to issue challenge",
+	CodeChallengeVerifyFailed:        "challenge verification is unavailable",
+
+	CodeValidateRequired: "%s is required",
+	CodeValidateEmail:    "%s must be a valid email address",
+	CodeValidateMin:      "%s must be at least %s characters",
+	CodeValidateMax:      "%s must be at most %s characters",
+	CodeValidateLen:      "%s must be exactly %s characters",
+	CodeValidateNumeric:  "%s must be numeric",
+	CodeValidateAlphanum: "%s may only contain letters and digits",
+	CodeValidateOneof:    "%s must be one of: %s",
+	CodeValidateDefault:  "%s failed validation (%s)",
+
+	"field.app":       "app",
+	"field.email":     "email",
+	"field.username":  "username",
+	"field.password":  "password",
+	"field.otp":       "verification code",
+	"field.reason":    "reason",
+	"field.role":      "role",
+	"field.evidence":  "evidence",
+	"field.type":      "type",
+	"field.id":        "id",
+	"field.client_id": "client id",
+	"field.name":      "name",
+	"field.scopes":    "scopes",
+	"field.duration":  "duration",
+}
@@ -1,8 +1,12 @@
 package util
 
 import (
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
 	"time"
 
 	"github.com/go-chi/httplog/v3"
@@ -11,23 +15,94 @@ import (
 
 func RateLimiter(limit int) func(next http.Handler) http.Handler {
 	return httprate.Limit(limit, time.Hour,
-		httprate.WithKeyFuncs(httprate.KeyByRealIP),
+		httprate.WithKeyFuncs(func(r *http.Request) (string, error) {
+			return GetRealIp(r), nil
+		}),
 		httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
-			http.Error(w, "操作过于频繁，请稍后再试", http.StatusTooManyRequests)
+			RespondError(w, r, TooManyRequests(CodeRateLimited))
 		}),
 	)
 }
 
+// 反向代理的地址，只有来自这些地址的请求才采用X-Forwarded-For和X-Real-Ip，
+// 为空时直接使用连接的对端地址
+var TrustedProxies []netip.Prefix
+
+// entries为IP地址或CIDR网段，例如203.0.113.7、10.0.0.0/8
+func ParseIpPrefixes(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ip prefix: %q", entry)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ip address: %q", entry)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// 解析可能带端口的地址
+func parseAddr(value string) (netip.Addr, bool) {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+func isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// 客户端的IP地址，不带端口。请求头可以由客户端任意伪造，
+// 因此只在对端是可信代理时采用，并从X-Forwarded-For的右侧跳过可信代理取第一个地址
 func GetRealIp(r *http.Request) string {
-	if ip := r.Header.Get("True-Client-IP"); ip != "" {
-		return ip
-	} else if ip := r.Header.Get("X-Real-Ip"); ip != "" {
-		return ip
-	} else if ip := r.Header.Get("X-Forwarded-For"); ip != "" {
-		return ip
-	} else {
+	remote, ok := parseAddr(r.RemoteAddr)
+	if !ok {
 		return r.RemoteAddr
 	}
+	if !isTrustedProxy(remote) {
+		return remote.String()
+	}
+
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseAddr(hops[i])
+		if !ok {
+			break
+		}
+		if !isTrustedProxy(addr) {
+			return addr.String()
+		}
+		remote = addr
+	}
+	if len(hops) == 0 {
+		if addr, ok := parseAddr(r.Header.Get("X-Real-Ip")); ok {
+			return addr.String()
+		}
+	}
+	return remote.String()
 }
 
 func isDebugHeaderSet(r *http.Request) bool {
@@ -0,0 +1,51 @@
+package util
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestGetRealIp(t *testing.T) {
+	TrustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	defer func() { TrustedProxies = nil }()
+
+	cases := []struct {
+		remote  string
+		headers map[string]string
+		ip      string
+	}{
+		// 不是来自代理的请求忽略请求头
+		{"192.0.2.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.9", "X-Real-Ip": "203.0.113.9", "True-Client-IP": "203.0.113.9"}, "192.0.2.1"},
+		{"10.0.0.2:1234", map[string]string{"X-Forwarded-For": "203.0.113.9"}, "203.0.113.9"},
+		// 客户端伪造的左侧地址不被采用
+		{"10.0.0.2:1234", map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.9, 10.0.0.3"}, "203.0.113.9"},
+		{"10.0.0.2:1234", map[string]string{"X-Real-Ip": "203.0.113.9"}, "203.0.113.9"},
+		{"10.0.0.2:1234", map[string]string{"X-Forwarded-For": "garbage, 10.0.0.3"}, "10.0.0.3"},
+		{"10.0.0.2:1234", nil, "10.0.0.2"},
+		{"[::ffff:192.0.2.1]:1234", nil, "192.0.2.1"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remote
+		for key, value := range c.headers {
+			r.Header.Set(key, value)
+		}
+		if ip := GetRealIp(r); ip != c.ip {
+			t.Errorf("%s %v: expected %s, got %s", c.remote, c.headers, c.ip, ip)
+		}
+	}
+}
+
+func TestParseIpPrefixes(t *testing.T) {
+	prefixes, err := ParseIpPrefixes([]string{"10.0.0.1", "172.16.0.0/12", "::ffff:192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prefixes) != 3 || prefixes[0].Bits() != 32 || prefixes[2] != netip.MustParsePrefix("192.0.2.1/32") {
+		t.Errorf("unexpected prefixes %v", prefixes)
+	}
+	if _, err := ParseIpPrefixes([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("expected invalid prefix error")
+	}
+}
@@ -5,10 +5,17 @@ import (
 	"auth/internal/repository"
 	"auth/internal/service"
 	"auth/internal/util"
+	"context"
+	"database/sql"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -31,10 +38,56 @@ func envInt(key string, fallback int) int {
 	return fallback
 }
 
-func main() {
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	slog.SetDefault(logger)
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if value, ok := os.LookupEnv(key); ok {
+		d, err := util.ParseDuration(value)
+		if err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
+// 逗号分隔的列表，未设置时为空
+func envList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(env(key, ""), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
 
+// 命令行和HTTP服务共用的部分，只连接数据库和Redis，不访问其他外部服务
+type application struct {
+	db                *sql.DB
+	userRepo          repository.UserRepository
+	eventRepo         repository.EventRepository
+	otpRepo           repository.OtpRepository
+	sessionRepo       repository.SessionRepository
+	strikeRepo        repository.StrikeRepository
+	clientRepo        repository.ClientRepository
+	tokenRepo         repository.TokenRepository
+	personalTokenRepo repository.PersonalTokenRepository
+	identityRepo      repository.IdentityRepository
+	socialRepo        repository.SocialRepository
+	inviteRepo        repository.InviteRepository
+	velocityRepo      repository.VelocityRepository
+	strikePolicy      service.StrikePolicy
+	adminService      service.AdminService
+}
+
+// HTTP服务额外需要的服务，可能需要访问LDAP、OIDC等外部服务
+type server struct {
+	*application
+	authService      service.AuthService
+	challengeService service.ChallengeService
+	oauthService     service.OAuthService
+	socialService    service.SocialService
+}
+
+func newApplication() *application {
 	// util
 	util.RefreshTokenSecret = env("REFRESH_TOKEN_SECRET", "secret")
 	util.AccessTokenSecret = env("ACCESS_TOKEN_SECRET", "secret")
@@ -53,29 +106,287 @@ func main() {
 		env("RDB_USER", "auth"),
 		env("RDB_PASSWORD", ""),
 	)
-	email := infra.NewEmailClient(
-		env("SMTP_MAIL", ""),
-		env("SMTP_SERVER", ""),
-		env("SMTP_PASSWORD", ""),
-	)
 
 	// repository
 	userRepo := repository.NewUserRepository(db)
 	eventRepo := repository.NewEventRepository(db)
-	otpRepo := repository.NewOtpRepository(rdb)
+	sessionRepo := repository.NewSessionRepository(rdb)
+	strikeRepo := repository.NewStrikeRepository(db)
+	permRepo := repository.NewPermissionRepository(db)
+	clientRepo := repository.NewClientRepository(db)
+	tokenRepo := repository.NewTokenRepository(rdb)
+	inviteRepo := repository.NewInviteRepository(db)
+
+	util.RevokedTokens = tokenRepo
+	util.IsClientActive = func(clientId string) (bool, error) {
+		client, err := clientRepo.FindByClientId(clientId)
+		if err != nil {
+			return false, err
+		}
+		return client != nil && client.DisabledAt == nil, nil
+	}
+	util.LookupLegacySubject = func(username string, issuedAt time.Time) (int64, error) {
+		user, err := userRepo.FindByUsername(username)
+		if err != nil {
+			return 0, err
+		}
+		if user == nil {
+			return 0, fmt.Errorf("user not found: %s", username)
+		}
+		// 令牌签发给的是之前使用该用户名的账号
+		if issuedAt.Before(user.CreatedAt.Truncate(time.Second)) {
+			return 0, fmt.Errorf("token issued before user was created: %s", username)
+		}
+		return user.ID, nil
+	}
 
 	// service
-	authService := service.NewAuthService(
+	strikePolicy := service.StrikePolicy{
+		Period:            envDuration("STRIKE_PERIOD", service.DefaultStrikePolicy.Period),
+		RestrictThreshold: int64(envInt("STRIKE_RESTRICT_THRESHOLD", int(service.DefaultStrikePolicy.RestrictThreshold))),
+		BanThreshold:      int64(envInt("STRIKE_BAN_THRESHOLD", int(service.DefaultStrikePolicy.BanThreshold))),
+		BanDuration:       envDuration("STRIKE_BAN_DURATION", service.DefaultStrikePolicy.BanDuration),
+	}
+	adminService := service.NewAdminService(
+		util.NewAccessTokenVerifier(permRepo, sessionRepo, envList("ADMIN_AUDIENCES")),
 		userRepo,
 		eventRepo,
-		otpRepo,
+		sessionRepo,
+		strikeRepo,
+		clientRepo,
+		inviteRepo,
+		strikePolicy,
+	)
+
+	return &application{
+		db:                db,
+		userRepo:          userRepo,
+		eventRepo:         eventRepo,
+		otpRepo:           repository.NewOtpRepository(rdb),
+		sessionRepo:       sessionRepo,
+		strikeRepo:        strikeRepo,
+		clientRepo:        clientRepo,
+		tokenRepo:         tokenRepo,
+		personalTokenRepo: repository.NewPersonalTokenRepository(db),
+		identityRepo:      repository.NewIdentityRepository(db),
+		socialRepo:        repository.NewSocialRepository(rdb),
+		inviteRepo:        inviteRepo,
+		velocityRepo:      repository.NewVelocityRepository(rdb),
+		strikePolicy:      strikePolicy,
+		adminService:      adminService,
+	}
+}
+
+func newServer(app *application) *server {
+	// util
+	trustedProxies, err := util.ParseIpPrefixes(envList("TRUSTED_PROXIES"))
+	if err != nil {
+		slog.Error("Invalid TRUSTED_PROXIES", "error", err)
+		os.Exit(1)
+	}
+	util.TrustedProxies = trustedProxies
+
+	// infra
+	email := infra.NewEmailClient(
+		env("SMTP_MAIL", ""),
+		env("SMTP_SERVER", ""),
+		env("SMTP_PASSWORD", ""),
+	)
+
+	// service
+	verifier := util.NewAccessTokenVerifier(nil, app.sessionRepo, nil)
+	registrationPolicy := service.RegistrationPolicy{
+		Mode:           env("REGISTRATION_MODE", service.DefaultRegistrationPolicy.Mode),
+		AllowedDomains: envList("REGISTRATION_ALLOWED_DOMAINS"),
+		DeniedDomains:  envList("REGISTRATION_DENIED_DOMAINS"),
+		RiskChecks:     registrationRiskChecks(app.velocityRepo),
+	}
+	if err := registrationPolicy.Validate(); err != nil {
+		slog.Error("Invalid REGISTRATION_MODE", "error", err)
+		os.Exit(1)
+	}
+	challengePolicy := service.ChallengePolicy{
+		Mode:       env("CHALLENGE_MODE", service.DefaultChallengePolicy.Mode),
+		Difficulty: envInt("CHALLENGE_DIFFICULTY", service.DefaultChallengePolicy.Difficulty),
+		Threshold:  int64(envInt("CHALLENGE_THRESHOLD", int(service.DefaultChallengePolicy.Threshold))),
+		Window:     envDuration("CHALLENGE_WINDOW", service.DefaultChallengePolicy.Window),
+		TTL:        service.DefaultChallengePolicy.TTL,
+	}
+	if err := challengePolicy.Validate(); err != nil {
+		slog.Error("Invalid challenge policy", "error", err)
+		os.Exit(1)
+	}
+	var captcha infra.CaptchaVerifier
+	if provider := env("CAPTCHA_PROVIDER", ""); provider != "" {
+		var err error
+		captcha, err = infra.NewCaptchaVerifier(provider, env("CAPTCHA_SITE_KEY", ""), env("CAPTCHA_SECRET", ""))
+		if err != nil {
+			slog.Error("Invalid CAPTCHA_PROVIDER", "error", err)
+			os.Exit(1)
+		}
+	}
+	challengeService := service.NewChallengeService(
+		app.velocityRepo,
+		challengePolicy,
+		// 未配置时从访问令牌密钥派生，不直接用JWT的签名密钥签名挑战
+		env("CHALLENGE_SECRET", util.DeriveSecret(util.AccessTokenSecret, "challenge")),
+		captcha,
+	)
+	var authenticators []service.Authenticator
+	if ldapUrl := env("LDAP_URL", ""); ldapUrl != "" {
+		groupRoles, err := service.ParseGroupRoles(env("LDAP_GROUP_ROLES", ""))
+		if err != nil {
+			slog.Error("Invalid LDAP_GROUP_ROLES", "error", err)
+			os.Exit(1)
+		}
+		directory := infra.NewLdapDirectory(infra.LdapConfig{
+			Url:          ldapUrl,
+			BindDN:       env("LDAP_BIND_DN", ""),
+			BindPassword: env("LDAP_BIND_PASSWORD", ""),
+			BaseDN:       env("LDAP_BASE_DN", ""),
+			UserFilter:   env("LDAP_USER_FILTER", ""),
+			UsernameAttr: env("LDAP_USERNAME_ATTR", ""),
+			EmailAttr:    env("LDAP_EMAIL_ATTR", ""),
+			GroupAttr:    env("LDAP_GROUP_ATTR", ""),
+			StartTLS:     env("LDAP_START_TLS", "") == "true",
+		})
+		authenticators = append(authenticators, service.NewLdapAuthenticator(
+			directory,
+			app.userRepo,
+			app.identityRepo,
+			app.eventRepo,
+			app.sessionRepo,
+			groupRoles,
+		))
+	}
+	authService := service.NewAuthService(
+		app.userRepo,
+		app.eventRepo,
+		app.otpRepo,
+		app.sessionRepo,
+		app.strikeRepo,
+		app.personalTokenRepo,
+		app.inviteRepo,
+		app.identityRepo,
+		app.strikePolicy,
+		registrationPolicy,
 		email,
+		challengeService,
+		verifier,
+		authenticators...,
 	)
-	adminService := service.NewAdminService(
-		userRepo,
-		eventRepo,
+	util.VerifyPersonalToken = authService.VerifyPersonalToken
+	oauthService := service.NewOAuthService(
+		app.clientRepo,
+		app.tokenRepo,
+		app.sessionRepo,
+		app.personalTokenRepo,
+		app.eventRepo,
+	)
+	socialService := service.NewSocialService(
+		app.userRepo,
+		app.eventRepo,
+		app.otpRepo,
+		verifier,
+		app.identityRepo,
+		app.socialRepo,
+		app.inviteRepo,
+		registrationPolicy,
+		identityProviders(),
+		env("SOCIAL_CALLBACK_URL", "http://localhost:3000/v1/social/{provider}/callback"),
 	)
 
+	return &server{
+		application:      app,
+		authService:      authService,
+		challengeService: challengeService,
+		oauthService:     oauthService,
+		socialService:    socialService,
+	}
+}
+
+// 只启用配置了客户端ID的第三方登录方式
+func identityProviders() []infra.IdentityProvider {
+	var providers []infra.IdentityProvider
+	if clientId := env("GITHUB_CLIENT_ID", ""); clientId != "" {
+		providers = append(providers, infra.NewGitHubProvider(clientId, env("GITHUB_CLIENT_SECRET", "")))
+	}
+	if clientId := env("GOOGLE_CLIENT_ID", ""); clientId != "" {
+		providers = append(providers, infra.NewGoogleProvider(clientId, env("GOOGLE_CLIENT_SECRET", "")))
+	}
+	if clientId := env("QQ_CLIENT_ID", ""); clientId != "" {
+		providers = append(providers, infra.NewQQProvider(clientId, env("QQ_CLIENT_SECRET", "")))
+	}
+	if issuer := env("OIDC_ISSUER", ""); issuer != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		provider, err := infra.NewOIDCProvider(
+			ctx,
+			env("OIDC_NAME", "oidc"),
+			issuer,
+			env("OIDC_CLIENT_ID", ""),
+			env("OIDC_CLIENT_SECRET", ""),
+		)
+		if err != nil {
+			slog.Error("Failed to load OIDC provider", "issuer", issuer, "error", err)
+		} else {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
+
+// 临时邮箱和IP黑名单始终启用，MX检查需要能访问DNS，默认关闭
+func registrationRiskChecks(velocityRepo repository.VelocityRepository) []service.RiskCheck {
+	disposableDomains := append(slices.Clone(service.DefaultDisposableDomains), envList("REGISTRATION_DISPOSABLE_DOMAINS")...)
+	if path := env("REGISTRATION_DISPOSABLE_DOMAINS_FILE", ""); path != "" {
+		domains, err := service.ReadDomainList(path)
+		if err != nil {
+			slog.Error("Failed to read REGISTRATION_DISPOSABLE_DOMAINS_FILE", "path", path, "error", err)
+			os.Exit(1)
+		}
+		disposableDomains = append(disposableDomains, domains...)
+	}
+	ipCheck, err := service.NewIpReputationCheck(envList("REGISTRATION_BLOCKED_IPS"))
+	if err != nil {
+		slog.Error("Invalid REGISTRATION_BLOCKED_IPS", "error", err)
+		os.Exit(1)
+	}
+
+	checks := []service.RiskCheck{
+		service.NewDisposableEmailCheck(disposableDomains),
+		ipCheck,
+	}
+	if env("REGISTRATION_CHECK_MX", "") == "true" {
+		checks = append(checks, service.NewMxCheck(net.DefaultResolver, 5*time.Second))
+	}
+	if limit := envInt("REGISTRATION_SUBNET_LIMIT", 10); limit > 0 {
+		checks = append(checks, service.NewSubnetVelocityCheck(
+			velocityRepo,
+			int64(limit),
+			envDuration("REGISTRATION_SUBNET_WINDOW", time.Hour),
+		))
+	}
+	return checks
+}
+
+func serve(app *server) {
+	if err := infra.Migrate(app.db); err != nil {
+		slog.Error("Failed to migrate database", "error", err)
+		os.Exit(1)
+	}
+
+	// 定时恢复到期的临时封禁和限制
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := app.adminService.ExpireRoles(); err != nil {
+				slog.Error("Failed to expire roles", "error", err)
+			}
+		}
+	}()
+
 	// router
 	router := chi.NewRouter()
 	router.Use(middleware.Recoverer)
@@ -86,8 +397,60 @@ func main() {
 	})
 	router.Route("/v1", func(router chi.Router) {
 		router.Use(util.RequestLogger())
-		router.Route("/auth", authService.Use)
-		router.Route("/admin", adminService.Use)
+		router.Route("/auth", app.authService.Use)
+		router.Route("/challenge", app.challengeService.Use)
+		router.Route("/admin", app.adminService.Use)
+		router.Route("/oauth", app.oauthService.Use)
+		router.Route("/social", app.socialService.Use)
+	})
+	// v2与v1路由相同，但令牌和错误始终以JSON返回
+	router.Route("/v2", func(router chi.Router) {
+		router.Use(util.RequestLogger())
+		router.Use(util.JsonResponses)
+		router.Route("/auth", app.authService.Use)
+		router.Route("/challenge", app.challengeService.Use)
+		router.Route("/admin", app.adminService.Use)
+		router.Route("/social", app.socialService.Use)
 	})
 	http.ListenAndServe(":3000", router)
 }
+
+const usage = `用法:
+  auth serve                                   启动HTTP服务(默认)
+  auth migrate                                 执行数据库迁移
+  auth user create --username U --email E [--role R]
+                                               创建用户，密码从标准输入读取
+  auth user set-password --username U          重置密码，密码从标准输入读取
+  auth user ban --username U --reason R [--duration 7d]
+  auth client create --client-id C --name N [--scopes user:read,user:ban]
+`
+
+func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	slog.SetDefault(logger)
+
+	command := "serve"
+	args := os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	var err error
+	switch command {
+	case "serve":
+		serve(newServer(newApplication()))
+	case "migrate":
+		err = runMigrate(newApplication(), args)
+	case "user":
+		err = runUser(newApplication(), args)
+	case "client":
+		err = runClient(newApplication(), args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,196 @@
+package authclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 提供校验令牌签名所需的密钥
+type KeySource interface {
+	Key(ctx context.Context, token *jwt.Token) (any, error)
+	// 接受的签名算法，防止算法混淆攻击
+	Methods() []string
+}
+
+type hmacKeys struct {
+	secret []byte
+}
+
+// 与认证服务共享的HMAC密钥，即其ACCESS_TOKEN_SECRET
+func HMAC(secret string) KeySource {
+	return &hmacKeys{secret: []byte(secret)}
+}
+
+func (k *hmacKeys) Key(ctx context.Context, token *jwt.Token) (any, error) {
+	return k.secret, nil
+}
+
+func (k *hmacKeys) Methods() []string {
+	return []string{jwt.SigningMethodHS256.Alg()}
+}
+
+const (
+	defaultJwksTTL = time.Hour
+	// 遇到未知kid时最多每分钟重新拉取一次，避免伪造的kid打满密钥服务
+	jwksMinRefreshInterval = time.Minute
+)
+
+type jwksKeys struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]any
+	fetchedAt time.Time
+}
+
+// 从JWKS地址拉取公钥并缓存ttl，ttl为0时使用默认的1小时
+func JWKS(url string, ttl time.Duration) KeySource {
+	if ttl <= 0 {
+		ttl = defaultJwksTTL
+	}
+	return &jwksKeys{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (k *jwksKeys) Methods() []string {
+	return []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+}
+
+func (k *jwksKeys) Key(ctx context.Context, token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, ok := k.keys[kid]
+	stale := time.Since(k.fetchedAt) > k.ttl
+	if ok && !stale {
+		return key, nil
+	}
+	if stale || time.Since(k.fetchedAt) > jwksMinRefreshInterval {
+		keys, err := k.fetch(ctx)
+		if err != nil {
+			// 拉取失败时继续使用旧的密钥
+			if ok {
+				return key, nil
+			}
+			return nil, err
+		}
+		k.keys = keys
+		k.fetchedAt = time.Now()
+		key, ok = keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k *jwksKeys) fetch(ctx context.Context) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		publicKey, err := key.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[key.Kid] = publicKey
+	}
+	return keys, nil
+}
+
+func (key jwk) publicKey() (any, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch key.Kty {
+	case "RSA":
+		n, err := decode(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(key.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", key.Crv)
+		}
+		x, err := decode(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+}
@@ -0,0 +1,79 @@
+package authclient
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+)
+
+// 对已通过校验的令牌的附加要求，不满足时返回ErrForbidden
+type Requirement func(principal *Principal) error
+
+func RequireRole(roles ...string) Requirement {
+	return func(principal *Principal) error {
+		if !slices.Contains(roles, principal.Role) {
+			return ErrForbidden
+		}
+		return nil
+	}
+}
+
+func RequirePermission(permission string) Requirement {
+	return func(principal *Principal) error {
+		if !principal.HasPermission(permission) {
+			return ErrForbidden
+		}
+		return nil
+	}
+}
+
+// 只接受用户令牌，拒绝客户端凭据签发的机器令牌
+func RequireUser() Requirement {
+	return func(principal *Principal) error {
+		if principal.IsClient() {
+			return ErrForbidden
+		}
+		return nil
+	}
+}
+
+// 校验令牌并检查全部要求，通过后将Principal放入请求的context
+func (v *Verifier) Middleware(requirements ...Requirement) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := v.Authenticate(r)
+			if err == nil {
+				for _, requirement := range requirements {
+					if err = requirement(principal); err != nil {
+						break
+					}
+				}
+			}
+			if err != nil {
+				v.handleError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), principal)))
+		})
+	}
+}
+
+func (v *Verifier) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if v.ErrorHandler != nil {
+		v.ErrorHandler(w, r, err)
+		return
+	}
+
+	switch {
+	case errors.Is(err, ErrForbidden):
+		http.Error(w, "forbidden", http.StatusForbidden)
+	case errors.Is(err, ErrTokenMissing),
+		errors.Is(err, ErrTokenInvalid),
+		errors.Is(err, ErrTokenRevoked),
+		errors.Is(err, ErrAudience):
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	default:
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,71 @@
+// Package authclient 供其他服务校验本服务签发的访问令牌。
+//
+// 典型用法：
+//
+//	verifier := &authclient.Verifier{
+//		Keys:      authclient.HMAC(os.Getenv("ACCESS_TOKEN_SECRET")),
+//		Audiences: []string{"novel"},
+//	}
+//	router.With(verifier.Middleware(authclient.RequireRole("admin"))).Get("/admin", handler)
+//
+// 处理函数中通过authclient.FromContext(r.Context())获取当前用户。
+package authclient
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 访问令牌中的声明，与认证服务签发时使用的结构一致
+type Claims struct {
+	jwt.RegisteredClaims
+	Username  string           `json:"username"`
+	Role      string           `json:"role"`
+	CreatedAt *jwt.NumericDate `json:"crat"`
+	// 客户端凭据签发的令牌不属于任何用户，以client_id区分，权限由scope给出
+	ClientId string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+func (c *Claims) TokenId() string {
+	return c.ID
+}
+
+type Principal struct {
+	UserId    int64
+	ClientId  string
+	App       string
+	Username  string
+	Role      string
+	TokenId   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	// 令牌自身限定的权限范围，用户登录签发的令牌为nil，表示不限制
+	Scopes []string
+	// 由Verifier.Permissions加载，机器令牌即其Scopes
+	Permissions []string
+}
+
+// 是否为客户端凭据签发的机器令牌
+func (p *Principal) IsClient() bool {
+	return p.ClientId != ""
+}
+
+func (p *Principal) HasPermission(permission string) bool {
+	return slices.Contains(p.Permissions, permission)
+}
+
+type principalKey struct{}
+
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// 未经过Middleware的请求返回nil
+func FromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
@@ -0,0 +1,192 @@
+package authclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrTokenMissing = errors.New("authclient: missing bearer token")
+	ErrTokenInvalid = errors.New("authclient: invalid token")
+	ErrTokenRevoked = errors.New("authclient: token revoked")
+	ErrAudience     = errors.New("authclient: token audience not accepted")
+	ErrForbidden    = errors.New("authclient: permission denied")
+)
+
+// 个人令牌不是JWT，以此前缀区分
+const PersonalTokenPrefix = "pat_"
+
+type Verifier struct {
+	Keys KeySource
+	// JWT的aud必须是其中之一，为空时不检查。
+	// 个人令牌不属于任何应用，不检查aud，其权限由Scopes限定
+	Audiences []string
+	// 允许的时钟偏差
+	Leeway time.Duration
+
+	// 以下均为可选的扩展点
+
+	// 检查jti是否已被撤销，例如查询撤销名单
+	IsRevoked func(ctx context.Context, jti string) (bool, error)
+	// 校验以PersonalTokenPrefix开头的个人令牌，为nil时只接受JWT
+	Opaque func(ctx context.Context, token string) (*Principal, error)
+	// 通过签名校验后的额外检查，例如用户会话是否已被撤销
+	Validate func(ctx context.Context, principal *Principal) error
+	// 早期签发的令牌以用户名作为sub，据此解析出用户ID，为nil时拒绝此类令牌。
+	// 用户名可能已被注销后重新注册，应拒绝签发时间早于该用户创建时间的令牌
+	LegacySubject func(ctx context.Context, username string, issuedAt time.Time) (int64, error)
+	// 加载用户令牌的权限，为nil时用户令牌没有任何权限
+	Permissions func(ctx context.Context, principal *Principal) ([]string, error)
+	// Middleware校验失败时的响应方式，为nil时返回纯文本错误
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// 从Authorization请求头中取出Bearer令牌
+func BearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" || !strings.HasPrefix(header, "Bearer ") {
+		return "", ErrTokenMissing
+	}
+	token := strings.TrimSpace(header[len("Bearer "):])
+	if token == "" {
+		return "", ErrTokenMissing
+	}
+	return token, nil
+}
+
+// 校验令牌本身：签名、有效期、audience和撤销状态，不加载权限
+func (v *Verifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	var principal *Principal
+	// 只有带前缀的令牌才交给Opaque，避免任意字符串都触发一次查询
+	if strings.HasPrefix(token, PersonalTokenPrefix) {
+		if v.Opaque == nil {
+			return nil, ErrTokenInvalid
+		}
+		p, err := v.Opaque(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		principal = p
+	} else {
+		p, err := v.verifyJwt(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		if len(v.Audiences) > 0 && !slices.Contains(v.Audiences, p.App) {
+			return nil, ErrAudience
+		}
+		principal = p
+	}
+
+	if principal.TokenId != "" && v.IsRevoked != nil {
+		revoked, err := v.IsRevoked(ctx, principal.TokenId)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return principal, nil
+}
+
+func (v *Verifier) verifyJwt(ctx context.Context, token string) (*Principal, error) {
+	claims := &Claims{}
+	parsed, err := jwt.ParseWithClaims(token, claims,
+		func(t *jwt.Token) (any, error) {
+			return v.Keys.Key(ctx, t)
+		},
+		jwt.WithValidMethods(v.Keys.Methods()),
+		jwt.WithLeeway(v.Leeway),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !parsed.Valid || claims.IssuedAt == nil {
+		return nil, ErrTokenInvalid
+	}
+
+	principal := &Principal{
+		Username:  claims.Username,
+		Role:      claims.Role,
+		TokenId:   claims.ID,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	if len(claims.Audience) > 0 {
+		principal.App = claims.Audience[0]
+	}
+	// audience为多个时以任一匹配为准
+	if len(v.Audiences) > 0 {
+		for _, aud := range claims.Audience {
+			if slices.Contains(v.Audiences, aud) {
+				principal.App = aud
+				break
+			}
+		}
+	}
+
+	if claims.ClientId != "" {
+		principal.ClientId = claims.ClientId
+		principal.Scopes = strings.Fields(claims.Scope)
+		return principal, nil
+	}
+
+	principal.UserId, err = strconv.ParseInt(claims.Subject, 10, 64)
+	if err == nil {
+		return principal, nil
+	}
+	if v.LegacySubject == nil || claims.Subject == "" {
+		return nil, ErrTokenInvalid
+	}
+	principal.UserId, err = v.LegacySubject(ctx, claims.Subject, principal.IssuedAt)
+	if err != nil {
+		return nil, err
+	}
+	if principal.Username == "" {
+		principal.Username = claims.Subject
+	}
+	return principal, nil
+}
+
+// 校验请求中的令牌，执行Validate并加载权限
+func (v *Verifier) Authenticate(r *http.Request) (*Principal, error) {
+	token, err := BearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := r.Context()
+	principal, err := v.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.Validate != nil {
+		if err := v.Validate(ctx, principal); err != nil {
+			return nil, err
+		}
+	}
+
+	if principal.IsClient() {
+		principal.Permissions = principal.Scopes
+	} else if v.Permissions != nil {
+		permissions, err := v.Permissions(ctx, principal)
+		if err != nil {
+			return nil, err
+		}
+		// 个人令牌等限定了范围的令牌只保留范围内的权限
+		if principal.Scopes != nil {
+			permissions = slices.DeleteFunc(slices.Clone(permissions), func(permission string) bool {
+				return !slices.Contains(principal.Scopes, permission)
+			})
+		}
+		principal.Permissions = permissions
+	}
+	return principal, nil
+}
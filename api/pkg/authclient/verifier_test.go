@@ -0,0 +1,328 @@
+package authclient
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret"
+
+func signHS256(t *testing.T, claims *Claims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func userClaims(aud string) *Claims {
+	now := time.Now()
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "42",
+			Audience:  jwt.ClaimStrings{aud},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			ID:        "jti-1",
+		},
+		Username: "alice",
+		Role:     "admin",
+	}
+}
+
+func TestVerifyHMAC(t *testing.T) {
+	v := &Verifier{Keys: HMAC(testSecret), Audiences: []string{"novel"}}
+
+	principal, err := v.Verify(context.Background(), signHS256(t, userClaims("novel")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.UserId != 42 || principal.Username != "alice" || principal.App != "novel" || principal.TokenId != "jti-1" {
+		t.Errorf("unexpected principal %+v", principal)
+	}
+
+	if _, err := v.Verify(context.Background(), signHS256(t, userClaims("other"))); !errors.Is(err, ErrAudience) {
+		t.Errorf("expected ErrAudience, got %v", err)
+	}
+
+	other := &Verifier{Keys: HMAC("wrong-secret")}
+	if _, err := other.Verify(context.Background(), signHS256(t, userClaims("novel"))); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("expected ErrTokenInvalid, got %v", err)
+	}
+}
+
+func TestVerifyRevoked(t *testing.T) {
+	v := &Verifier{
+		Keys: HMAC(testSecret),
+		IsRevoked: func(ctx context.Context, jti string) (bool, error) {
+			return jti == "jti-1", nil
+		},
+	}
+	if _, err := v.Verify(context.Background(), signHS256(t, userClaims("novel"))); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("expected ErrTokenRevoked, got %v", err)
+	}
+}
+
+func TestVerifyLegacySubject(t *testing.T) {
+	claims := userClaims("novel")
+	claims.Subject = "alice"
+	claims.Username = ""
+	token := signHS256(t, claims)
+
+	v := &Verifier{Keys: HMAC(testSecret)}
+	if _, err := v.Verify(context.Background(), token); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("expected ErrTokenInvalid, got %v", err)
+	}
+
+	v.LegacySubject = func(ctx context.Context, username string, issuedAt time.Time) (int64, error) {
+		if username != "alice" || issuedAt.IsZero() {
+			return 0, ErrTokenInvalid
+		}
+		return 42, nil
+	}
+	principal, err := v.Verify(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.UserId != 42 || principal.Username != "alice" {
+		t.Errorf("unexpected principal %+v", principal)
+	}
+}
+
+func TestVerifyRejectsMalformed(t *testing.T) {
+	opaqueCalls := 0
+	v := &Verifier{
+		Keys: HMAC(testSecret),
+		Opaque: func(ctx context.Context, token string) (*Principal, error) {
+			opaqueCalls++
+			return nil, ErrTokenInvalid
+		},
+	}
+	for _, token := range []string{"garbage", "a.b", "a.b.c.d"} {
+		if _, err := v.Verify(context.Background(), token); !errors.Is(err, ErrTokenInvalid) {
+			t.Errorf("%s: expected ErrTokenInvalid, got %v", token, err)
+		}
+	}
+	if opaqueCalls != 0 {
+		t.Errorf("opaque verifier called %d times for tokens without prefix", opaqueCalls)
+	}
+
+	claims := userClaims("novel")
+	claims.ExpiresAt = nil
+	if _, err := v.Verify(context.Background(), signHS256(t, claims)); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("expected ErrTokenInvalid for token without exp, got %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	v := &Verifier{
+		Keys: HMAC(testSecret),
+		Permissions: func(ctx context.Context, principal *Principal) ([]string, error) {
+			return []string{"user:read"}, nil
+		},
+	}
+
+	var got *Principal
+	handler := v.Middleware(RequirePermission("user:read"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromContext(r.Context())
+	}))
+
+	cases := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"invalid", "Bearer a.b.c", http.StatusUnauthorized},
+		{"user", "Bearer " + signHS256(t, userClaims("novel")), http.StatusOK},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c.header != "" {
+			req.Header.Set("Authorization", c.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != c.status {
+			t.Errorf("%s: expected status %d, got %d", c.name, c.status, rec.Code)
+		}
+	}
+	if got == nil || got.UserId != 42 {
+		t.Errorf("principal not stored in context: %+v", got)
+	}
+}
+
+func TestClientToken(t *testing.T) {
+	claims := userClaims("svc")
+	claims.Subject = "svc"
+	claims.ClientId = "svc"
+	claims.Scope = "user:read user:ban"
+
+	v := &Verifier{Keys: HMAC(testSecret)}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+signHS256(t, claims))
+	principal, err := v.Authenticate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !principal.IsClient() || !principal.HasPermission("user:ban") || principal.HasPermission("roles:write") {
+		t.Errorf("unexpected client principal %+v", principal)
+	}
+	if err := RequireUser()(principal); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected ErrForbidden, got %v", err)
+	}
+}
+
+func TestScopedPermissions(t *testing.T) {
+	rolePermissions := []string{"user:read", "user:ban"}
+	v := &Verifier{
+		Keys: HMAC(testSecret),
+		Opaque: func(ctx context.Context, token string) (*Principal, error) {
+			return &Principal{UserId: 7, Role: "admin", IssuedAt: time.Now(), Scopes: []string{"user:read"}}, nil
+		},
+		Permissions: func(ctx context.Context, principal *Principal) ([]string, error) {
+			return rolePermissions, nil
+		},
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer pat_opaque")
+	principal, err := v.Authenticate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !principal.HasPermission("user:read") || principal.HasPermission("user:ban") {
+		t.Errorf("unexpected permissions %v", principal.Permissions)
+	}
+	if len(rolePermissions) != 2 || rolePermissions[1] != "user:ban" {
+		t.Errorf("role permissions modified: %v", rolePermissions)
+	}
+}
+
+func TestPersonalTokenScopes(t *testing.T) {
+	rolePermissions := []string{"user:read", "user:ban", "event:read"}
+	cases := []struct {
+		name        string
+		scopes      []string
+		permissions []string
+	}{
+		// 没有范围限制的令牌取角色的全部权限
+		{"unscoped", nil, rolePermissions},
+		{"empty scopes", []string{}, []string{}},
+		{"subset", []string{"event:read", "user:read"}, []string{"user:read", "event:read"}},
+		// 范围不能超出角色已有的权限
+		{"beyond role", []string{"user:read", "client:write"}, []string{"user:read"}},
+	}
+	for _, c := range cases {
+		v := &Verifier{
+			Keys: HMAC(testSecret),
+			Opaque: func(ctx context.Context, token string) (*Principal, error) {
+				return &Principal{UserId: 7, Role: "admin", IssuedAt: time.Now(), Scopes: c.scopes}, nil
+			},
+			Permissions: func(ctx context.Context, principal *Principal) ([]string, error) {
+				return rolePermissions, nil
+			},
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer pat_opaque")
+		principal, err := v.Authenticate(req)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if !slices.Equal(principal.Permissions, c.permissions) {
+			t.Errorf("%s: expected permissions %v, got %v", c.name, c.permissions, principal.Permissions)
+		}
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(b []byte) string {
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kid": "k1",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   encode(key.N.Bytes()),
+				"e":   encode(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	defer server.Close()
+
+	sign := func(kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, userClaims("novel"))
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	v := &Verifier{Keys: JWKS(server.URL, time.Hour)}
+	for range 2 {
+		if _, err := v.Verify(context.Background(), sign("k1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("expected keys to be cached, fetched %d times", fetches)
+	}
+
+	// 未知kid在最小刷新间隔内不会重新拉取
+	if _, err := v.Verify(context.Background(), sign("k2")); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("expected ErrTokenInvalid, got %v", err)
+	}
+	if fetches != 1 {
+		t.Errorf("unknown kid triggered refetch, fetched %d times", fetches)
+	}
+
+	// HMAC签名的令牌不能冒充JWKS中的公钥
+	if _, err := v.Verify(context.Background(), signHS256(t, userClaims("novel"))); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("expected ErrTokenInvalid, got %v", err)
+	}
+}
+
+// 个人令牌不属于任何应用，设置了Audiences也应接受
+func TestOpaqueTokenIgnoresAudiences(t *testing.T) {
+	v := &Verifier{
+		Keys:      HMAC(testSecret),
+		Audiences: []string{"novel"},
+		Opaque: func(ctx context.Context, token string) (*Principal, error) {
+			return &Principal{UserId: 7, App: "personal", IssuedAt: time.Now(), Scopes: []string{"user:read"}}, nil
+		},
+	}
+	principal, err := v.Verify(context.Background(), "pat_opaque")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.UserId != 7 {
+		t.Errorf("unexpected principal %+v", principal)
+	}
+
+	if _, err := v.Verify(context.Background(), signHS256(t, userClaims("personal"))); !errors.Is(err, ErrAudience) {
+		t.Errorf("expected JWT with another audience to be rejected, got %v", err)
+	}
+}